@@ -5,17 +5,30 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 
 	"mq-redis/internal/api"
+	"mq-redis/internal/auth"
+	"mq-redis/internal/blob"
 	"mq-redis/internal/config"
+	"mq-redis/internal/envelope"
+	"mq-redis/internal/health"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
 	"mq-redis/internal/postgres"
 	producerkafka "mq-redis/internal/producer/kafka"
+	"mq-redis/internal/quota"
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/schema"
 	redisstore "mq-redis/internal/store/redis"
+	"mq-redis/internal/tenant"
+	"mq-redis/internal/upload"
 )
 
 const connectTimeout = 2 * time.Second
@@ -29,21 +42,20 @@ func main() {
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
+	if config.PrintRequested(os.Args[1:]) {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		return
+	}
 	if err := cfg.ValidateForAPI(); err != nil {
 		log.Fatalf("invalid config: %v", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-	defer func() {
-		if err := redisClient.Close(); err != nil {
-			log.Printf("redis close error: %v", err)
-		}
-	}()
-
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		log.Printf("redis ping failed: %v", err)
@@ -51,7 +63,7 @@ func main() {
 	cancel()
 
 	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-	if err := kafka.CheckConnectivity(ctx, cfg.Kafka.Brokers); err != nil {
+	if err := kafka.CheckConnectivity(ctx, cfg.Kafka); err != nil {
 		log.Printf("kafka connectivity check failed: %v", err)
 	}
 	cancel()
@@ -60,37 +72,173 @@ func main() {
 		log.Printf("postgres dsn missing; skipping connectivity check")
 	} else {
 		ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-		if err := postgres.CheckConnectivity(ctx, cfg.Postgres.DSN); err != nil {
+		if err := postgres.CheckConnectivity(ctx, cfg.Postgres); err != nil {
 			log.Printf("postgres connectivity check failed: %v", err)
 		}
 		cancel()
 	}
 
-	store := redisstore.NewWithClient(redisClient)
-	producer, err := producerkafka.New(cfg.Kafka, nil)
+	keys := cfg.Redis.Keys()
+	store := redisstore.NewWithClient(redisClient, redisstore.WithTTL(cfg.Redis.TTL), redisstore.WithKeys(keys))
+	producer, err := producerkafka.New(cfg.Kafka, nil, producerkafka.WithTenantTopics(cfg.Tenancy.Topics()))
 	if err != nil {
 		log.Printf("kafka producer init failed: %v", err)
 	}
-	if producer != nil {
-		defer func() {
-			if err := producer.Close(); err != nil {
-				log.Printf("kafka producer close error: %v", err)
+
+	keyring, err := envelope.New(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("encryption keyring init failed: %v", err)
+	}
+	if keyring != nil {
+		log.Printf("payload encryption enabled active_key=%s", keyring.ActiveKey())
+	}
+	blobs, err := blob.New(cfg.Blob)
+	if err != nil {
+		log.Fatalf("blob store init failed: %v", err)
+	}
+	schemas := schema.NewRegistry(redisClient, keys)
+	if cfg.API.Schemas.Dir != "" {
+		if err := schemas.LoadDir(cfg.API.Schemas.Dir); err != nil {
+			log.Fatalf("load job schemas: %v", err)
+		}
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
+	if err := schemas.Refresh(ctx); err != nil {
+		log.Printf("schema registry load failed; admin-registered schemas apply after the next refresh: %v", err)
+	}
+	cancel()
+	log.Printf("job schemas loaded types=%d", len(schemas.List()))
+	registry := metrics.NewRegistry()
+	watcher := config.NewWatcher(cfgPath, cfg, config.Config.ValidateForAPI,
+		config.WithIgnored("worker", "retry_dispatcher", "reconciler"))
+	opts := []api.Option{
+		api.WithAuthenticators(auth.FromConfig(cfg.API.Auth)...),
+		api.WithTenants(tenant.NewRegistry(cfg.Tenancy)),
+		api.WithQuota(quota.New(redisClient, quota.WithTTL(cfg.Redis.TTL), quota.WithKeys(keys))),
+		api.WithRateLimit(ratelimit.New(redisClient), cfg.API.RateLimit),
+		api.WithKeys(keys),
+		api.WithCompression(cfg.API.Compression),
+		api.WithEncryption(keyring),
+		api.WithSchemas(schemas, cfg.API.Schemas.AdminClients),
+		api.WithMetrics(registry),
+		api.WithConfigVersion(func() any { return watcher.Version() }, cfg.API.AdminClients),
+	}
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go func() {
+		if err := schemas.Run(backgroundCtx, cfg.API.Schemas.RefreshInterval); err != nil && err != context.Canceled {
+			log.Printf("schema refresh stopped with error: %v", err)
+		}
+	}()
+	if blobs == nil {
+		log.Printf("blob backend not configured; POST /payloads disabled")
+	} else {
+		opts = append(opts, api.WithPayloadUploads(blobs, upload.NewTracker(redisClient, keys), cfg.Blob.MaxBytes))
+		collector, err := upload.NewCollector(redisClient, blobs, cfg.API.Uploads, keys)
+		if err != nil {
+			log.Fatalf("upload collector init failed: %v", err)
+		}
+		go func() {
+			if err := collector.Run(backgroundCtx); err != nil && err != context.Canceled {
+				log.Printf("upload collector stopped with error: %v", err)
 			}
 		}()
 	}
 
-	r := api.NewRouter(store, producer)
-	r.GET("/healthz", func(c *gin.Context) {
-		c.JSON(http.StatusOK, api.JobResponse{Status: "ok"})
+	handler := api.NewHandler(store, producer, opts...)
+	watcher.OnReload(func(next config.Config) {
+		handler.SetRateLimit(next.API.RateLimit)
 	})
+	go watcher.Run(backgroundCtx, cfg.Reload.Interval)
+	checker := health.NewChecker(connectTimeout, dependencyChecks(cfg, redisClient)...)
+	r := handler.Router()
+	health.Register(r, checker)
 
 	server := &http.Server{
 		Addr:    cfg.API.Addr,
 		Handler: r,
 	}
 
-	log.Printf("api listening on %s", cfg.API.Addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("server error: %v", err)
+	// Metrics carry every tenant's name and volume, so they are served on
+	// the ops listener rather than to API clients.
+	opsRouter := health.NewRouter(checker)
+	opsRouter.GET("/metrics", gin.WrapH(registry.Handler()))
+	healthServer := &http.Server{
+		Addr:    cfg.API.HealthAddr,
+		Handler: opsRouter,
+	}
+	go func() {
+		log.Printf("api health listening on %s", healthServer.Addr)
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("health server error: %v", err)
+		}
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("api listening on %s auth=%t", cfg.API.Addr, cfg.API.Auth.Enabled())
+		serverErr <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-stop:
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}
+
+	// Stop accepting requests and let in-flight ones finish, then flush the
+	// producer before closing Redis so accepted jobs are not lost.
+	log.Printf("api shutting down shutdown_timeout=%s", cfg.API.ShutdownTimeout)
+	ctx, cancel = context.WithTimeout(context.Background(), cfg.API.ShutdownTimeout)
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("server shutdown error: %v", err)
+	}
+	if err := healthServer.Shutdown(ctx); err != nil {
+		log.Printf("health server shutdown error: %v", err)
+	}
+	cancel()
+	stopBackground()
+	if producer != nil {
+		if err := producer.Close(); err != nil {
+			log.Printf("kafka producer close error: %v", err)
+		}
+	}
+	if err := redisClient.Close(); err != nil {
+		log.Printf("redis close error: %v", err)
+	}
+	log.Printf("api stopped")
+}
+
+// dependencyChecks marks Redis as non-critical: the API keeps accepting jobs
+// without it, but dedupe fails open, so readiness reports degraded.
+func dependencyChecks(cfg config.Config, redisClient redis.UniversalClient) []health.Check {
+	checks := []health.Check{
+		{
+			Name:     "kafka",
+			Critical: true,
+			Probe: func(ctx context.Context) error {
+				return kafka.CheckConnectivity(ctx, cfg.Kafka)
+			},
+		},
+		{
+			Name:    "redis",
+			Warning: api.WarningDedupeDegraded,
+			Probe: func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			},
+		},
+	}
+	if cfg.Postgres.DSN != "" {
+		checks = append(checks, health.Check{
+			Name: "postgres",
+			Probe: func(ctx context.Context) error {
+				return postgres.CheckConnectivity(ctx, cfg.Postgres)
+			},
+		})
 	}
+	return checks
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/config"
+	"mq-redis/internal/loadgen"
+	producerkafka "mq-redis/internal/producer/kafka"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/state"
+)
+
+func main() {
+	mode := flag.String("mode", "http", "http drives a running API, producer publishes straight to Kafka, memory runs offline against the in-memory store and producer")
+	target := flag.String("target", "http://localhost:8080", "API base URL (http mode)")
+	apiKey := flag.String("api-key", "", "sent as X-API-Key (http mode)")
+	tenant := flag.String("tenant", "", "tenant for published jobs (producer mode)")
+	rate := flag.Float64("rate", loadgen.DefaultRate, "requests per second")
+	duration := flag.Duration("duration", loadgen.DefaultDuration, "how long to submit")
+	concurrency := flag.Int("concurrency", loadgen.DefaultConcurrency, "concurrent submitters")
+	sizes := flag.String("sizes", "256:70,4096:25,65536:5", "payload size mix as bytes:weight,...")
+	dupRatio := flag.Float64("dup-ratio", 0.05, "share of requests that reuse an earlier idempotency key")
+	types := flag.String("types", "", "comma-separated job types to pick from")
+	wait := flag.Duration("wait", loadgen.DefaultWaitTimeout, "how long to wait for completion after submitting; 0 skips it")
+	poll := flag.Duration("poll", loadgen.DefaultPollInterval, "status poll interval")
+	processDelay := flag.Duration("process-delay", 5*time.Millisecond, "simulated processing time (memory mode)")
+	flag.Parse()
+
+	sizeMix, err := loadgen.ParseSizes(*sizes)
+	if err != nil {
+		log.Fatalf("invalid -sizes: %v", err)
+	}
+	cfg := loadgen.Config{
+		Rate:           *rate,
+		Duration:       *duration,
+		Concurrency:    *concurrency,
+		Sizes:          sizeMix,
+		DuplicateRatio: *dupRatio,
+		WaitTimeout:    *wait,
+		PollInterval:   *poll,
+	}
+	if *types != "" {
+		cfg.Types = strings.Split(*types, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var t loadgen.Target
+	switch *mode {
+	case "http":
+		t = &loadgen.HTTPTarget{BaseURL: *target, APIKey: *apiKey}
+	case "memory":
+		gin.SetMode(gin.ReleaseMode)
+		p := loadgen.NewInProcess(*processDelay)
+		defer p.Close()
+		t = p.Target()
+	case "producer":
+		pt, closeFn := producerTarget(*tenant)
+		defer closeFn()
+		t = pt
+	default:
+		log.Fatalf("unknown -mode %q", *mode)
+	}
+
+	log.Printf("loadgen mode=%s rate=%.0f/s duration=%s concurrency=%d dup_ratio=%.2f", *mode, cfg.Rate, cfg.Duration, cfg.Concurrency, cfg.DuplicateRatio)
+	report, err := loadgen.Run(ctx, t, cfg)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("loadgen: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("report encode failed: %v", err)
+	}
+	if report.DedupeErrors > 0 {
+		stop()
+		os.Exit(1)
+	}
+}
+
+// producerTarget publishes with the services' Kafka settings and reads
+// completion from the job status keys the worker writes.
+func producerTarget(tenant string) (*loadgen.ProducerTarget, func()) {
+	cfgPath := os.Getenv("CONFIG_PATH")
+	if cfgPath == "" {
+		cfgPath = "config/config.yaml"
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	if err := cfg.ValidateForRetryDispatcher(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+	producer, err := producerkafka.New(cfg.Kafka, nil, producerkafka.WithTenantTopics(cfg.Tenancy.Topics()))
+	if err != nil {
+		log.Fatalf("kafka producer init failed: %v", err)
+	}
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
+	keys := cfg.Redis.Keys()
+	statuses := func(ctx context.Context, jobID string) (state.State, bool, error) {
+		val, err := redisClient.Get(ctx, keys.JobKey(jobID)).Result()
+		if err == redis.Nil {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return state.State(val), true, nil
+	}
+	closeFn := func() {
+		if err := producer.Close(); err != nil {
+			log.Printf("kafka producer close error: %v", err)
+		}
+		redisClient.Close()
+	}
+	return &loadgen.ProducerTarget{Producer: producer, Tenant: tenant, Statuses: statuses}, closeFn
+}
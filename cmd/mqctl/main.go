@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mq-redis/internal/admin"
+	"mq-redis/internal/config"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/state"
+)
+
+const usage = `usage: mqctl <command> [flags] [args]
+
+commands:
+  inspect <job-id>               show status, attempts, meta, payload, lease and schedule
+  list [-status s] [-limit n]    list jobs, optionally filtered by status
+  retries [-limit n]             show retry:jobs in due order
+  replay-dlq [-all] [job-id...]  requeue dead-lettered jobs
+  cancel <job-id>...             cancel queued or retrying jobs
+  purge [-dry-run]               delete data left behind by expired jobs
+  stats                          print job counts and queue depths
+  config                         print the effective config with secrets redacted
+  validate [config-file]         check a config file for api, worker and retry-dispatcher
+
+The config file is read from CONFIG_PATH (default config/config.yaml);
+MQ_* environment variables override it.
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	cfgPath := os.Getenv("CONFIG_PATH")
+	if cfgPath == "" {
+		cfgPath = "config/config.yaml"
+	}
+	if cmd == "validate" {
+		if err := validate(cfgPath, args); err != nil {
+			log.Printf("mqctl validate: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	if cmd == "config" || cmd == config.PrintFlag {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		return
+	}
+	if err := cfg.ValidateForAdmin(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
+	defer redisClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, admin.New(redisClient, admin.WithTTL(cfg.Redis.TTL), admin.WithKeys(cfg.Redis.Keys())), cmd, args); err != nil {
+		log.Printf("mqctl %s: %v", cmd, err)
+		stop()
+		redisClient.Close()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, a *admin.Admin, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	switch cmd {
+	case "inspect":
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return fmt.Errorf("expected one job id")
+		}
+		job, err := a.Inspect(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(job)
+	case "list":
+		status := fs.String("status", "", "only list jobs in this status")
+		limit := fs.Int("limit", 100, "maximum jobs to list; 0 lists all")
+		fs.Parse(args)
+		if *status != "" && !validState(state.State(*status)) {
+			return fmt.Errorf("unknown status %q", *status)
+		}
+		jobs, err := a.List(ctx, state.State(*status), *limit)
+		if err != nil {
+			return err
+		}
+		return printJSON(jobs)
+	case "retries":
+		limit := fs.Int("limit", 100, "maximum entries to show; 0 shows all")
+		fs.Parse(args)
+		entries, err := a.Retries(ctx, *limit)
+		if err != nil {
+			return err
+		}
+		return printJSON(entries)
+	case "replay-dlq":
+		all := fs.Bool("all", false, "replay every job in dlq status")
+		fs.Parse(args)
+		if *all == (fs.NArg() > 0) {
+			return fmt.Errorf("pass job ids or -all")
+		}
+		results, err := a.ReplayDLQ(ctx, fs.Args())
+		if err != nil {
+			return err
+		}
+		return printResults(results)
+	case "cancel":
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return fmt.Errorf("expected at least one job id")
+		}
+		results := make([]admin.Result, 0, fs.NArg())
+		for _, id := range fs.Args() {
+			res := admin.Result{ID: id, OK: true}
+			if err := a.Cancel(ctx, id); err != nil {
+				res.OK, res.Error = false, err.Error()
+			}
+			results = append(results, res)
+		}
+		return printResults(results)
+	case "purge":
+		dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting")
+		fs.Parse(args)
+		report, err := a.Purge(ctx, *dryRun)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	case "stats":
+		fs.Parse(args)
+		stats, err := a.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(stats)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// validate loads a config file, without connecting to anything, and checks it
+// for every binary that reads it.
+func validate(cfgPath string, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		cfgPath = fs.Arg(0)
+	default:
+		return fmt.Errorf("expected at most one config file")
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+	results := cfg.ValidateRoles()
+	if err := printJSON(results); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if !r.Valid {
+			return fmt.Errorf("%s is not valid for every role", cfgPath)
+		}
+	}
+	return nil
+}
+
+func validState(s state.State) bool {
+	for _, known := range state.AllStates() {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printResults prints per-job results and fails the command if any job was
+// not applied.
+func printResults(results []admin.Result) error {
+	if err := printJSON(results); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if !r.OK {
+			return fmt.Errorf("some jobs were not applied")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"mq-redis/internal/config"
+	"mq-redis/internal/reconcile"
+	"mq-redis/internal/redisclient"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report drifted jobs without repairing them")
+	interval := flag.Duration("interval", -1, "repeat every interval; 0 runs once (default: reconciler.interval)")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Parse()
+
+	cfgPath := os.Getenv("CONFIG_PATH")
+	if cfgPath == "" {
+		cfgPath = "config/config.yaml"
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		log.Fatalf("load config: %v", err)
+	}
+	if *interval >= 0 {
+		cfg.Reconciler.Interval = *interval
+	}
+	if *printConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		return
+	}
+	if err := cfg.ValidateForReconciler(); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
+	defer redisClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	r := reconcile.New(redisClient, cfg.Reconciler, reconcile.WithTTL(cfg.Redis.TTL), reconcile.WithKeys(cfg.Redis.Keys()))
+	for {
+		report, err := r.Run(ctx, *dryRun)
+		if err != nil {
+			log.Printf("reconcile failed: %v", err)
+		}
+		log.Printf("reconcile scanned=%d drifted=%d dry_run=%v", report.Scanned, len(report.Findings), *dryRun)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Printf("report encode failed: %v", err)
+		}
+		if cfg.Reconciler.Interval == 0 {
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.Reconciler.Interval):
+		}
+	}
+}
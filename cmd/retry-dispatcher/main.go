@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 
 	"mq-redis/internal/config"
+	"mq-redis/internal/dispatcher"
+	"mq-redis/internal/health"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/outbox"
 	"mq-redis/internal/postgres"
+	producerkafka "mq-redis/internal/producer/kafka"
+	"mq-redis/internal/redisclient"
 )
 
 const connectTimeout = 2 * time.Second
@@ -26,21 +34,20 @@ func main() {
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
+	if config.PrintRequested(os.Args[1:]) {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		return
+	}
 	if err := cfg.ValidateForRetryDispatcher(); err != nil {
 		log.Fatalf("invalid config: %v", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-	defer func() {
-		if err := redisClient.Close(); err != nil {
-			log.Printf("redis close error: %v", err)
-		}
-	}()
-
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		log.Printf("redis ping failed: %v", err)
@@ -48,7 +55,7 @@ func main() {
 	cancel()
 
 	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-	if err := kafka.CheckConnectivity(ctx, cfg.Kafka.Brokers); err != nil {
+	if err := kafka.CheckConnectivity(ctx, cfg.Kafka); err != nil {
 		log.Printf("kafka connectivity check failed: %v", err)
 	}
 	cancel()
@@ -57,17 +64,136 @@ func main() {
 		log.Printf("postgres dsn missing; skipping connectivity check")
 	} else {
 		ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-		if err := postgres.CheckConnectivity(ctx, cfg.Postgres.DSN); err != nil {
+		if err := postgres.CheckConnectivity(ctx, cfg.Postgres); err != nil {
 			log.Printf("postgres connectivity check failed: %v", err)
 		}
 		cancel()
 	}
 
-	log.Printf("retry-dispatcher starting poll_interval=%s", cfg.RetryDispatcher.PollInterval)
-	log.Printf("retry-dispatcher using redis=%s kafka_brokers=%v", cfg.Redis.Addr, cfg.Kafka.Brokers)
+	watcher := config.NewWatcher(cfgPath, cfg, config.Config.ValidateForRetryDispatcher,
+		config.WithIgnored("api", "worker", "reconciler"))
+	opsRouter := health.NewRouter(health.NewChecker(connectTimeout, dependencyChecks(cfg, redisClient)...))
+	healthServer := &http.Server{
+		Addr:    cfg.RetryDispatcher.HealthAddr,
+		Handler: opsRouter,
+	}
+	go func() {
+		log.Printf("retry-dispatcher health listening on %s", healthServer.Addr)
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("health server error: %v", err)
+		}
+	}()
+
+	// Admin routes have no authentication, so they are only served on an
+	// opted-in loopback listener.
+	var adminServer *http.Server
+	if cfg.RetryDispatcher.AdminAddr != "" {
+		adminRouter := gin.New()
+		adminRouter.GET("/admin/config", func(c *gin.Context) {
+			c.JSON(http.StatusOK, watcher.Version())
+		})
+		adminServer = &http.Server{
+			Addr:    cfg.RetryDispatcher.AdminAddr,
+			Handler: adminRouter,
+		}
+		go func() {
+			log.Printf("retry-dispatcher admin listening on %s", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server error: %v", err)
+			}
+		}()
+	}
+
+	producer, err := producerkafka.New(cfg.Kafka, nil, producerkafka.WithTenantTopics(cfg.Tenancy.Topics()))
+	if err != nil {
+		log.Fatalf("kafka producer init failed: %v", err)
+	}
+	d, err := dispatcher.New(redisClient, producer, cfg.RetryDispatcher.PollInterval, cfg.RetryDispatcher.BatchSize,
+		dispatcher.WithTTL(cfg.Redis.TTL), dispatcher.WithKeys(cfg.Redis.Keys()))
+	if err != nil {
+		log.Fatalf("dispatcher init failed: %v", err)
+	}
+	relay, err := outbox.New(redisClient, producer, cfg.RetryDispatcher.PollInterval, cfg.RetryDispatcher.Outbox,
+		outbox.WithKeys(cfg.Redis.Keys()))
+	if err != nil {
+		log.Fatalf("outbox relay init failed: %v", err)
+	}
+	watcher.OnReload(func(next config.Config) {
+		d.Update(next.RetryDispatcher.PollInterval, next.RetryDispatcher.BatchSize)
+		relay.SetInterval(next.RetryDispatcher.PollInterval)
+	})
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	go watcher.Run(runCtx, cfg.Reload.Interval)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := d.Run(runCtx); err != nil && err != context.Canceled {
+			log.Printf("dispatcher stopped with error: %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := relay.Run(runCtx); err != nil && err != context.Canceled {
+			log.Printf("outbox relay stopped with error: %v", err)
+		}
+	}()
+
+	log.Printf("retry-dispatcher starting poll_interval=%s batch_size=%d", cfg.RetryDispatcher.PollInterval, cfg.RetryDispatcher.BatchSize)
+	log.Printf("retry-dispatcher using redis=%s kafka_brokers=%v", cfg.Redis.Describe(), cfg.Kafka.Brokers)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 	log.Printf("retry-dispatcher shutting down")
+
+	// Finish the current batches before closing the producer and Redis it uses.
+	cancelRun()
+	wg.Wait()
+
+	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
+	if err := healthServer.Shutdown(ctx); err != nil {
+		log.Printf("health server shutdown error: %v", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("admin server shutdown error: %v", err)
+		}
+	}
+	cancel()
+	if err := producer.Close(); err != nil {
+		log.Printf("kafka producer close error: %v", err)
+	}
+	if err := redisClient.Close(); err != nil {
+		log.Printf("redis close error: %v", err)
+	}
+	log.Printf("retry-dispatcher stopped")
+}
+
+func dependencyChecks(cfg config.Config, redisClient redis.UniversalClient) []health.Check {
+	checks := []health.Check{
+		{
+			Name:     "kafka",
+			Critical: true,
+			Probe: func(ctx context.Context) error {
+				return kafka.CheckConnectivity(ctx, cfg.Kafka)
+			},
+		},
+		{
+			Name:     "redis",
+			Critical: true,
+			Probe: func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			},
+		},
+	}
+	if cfg.Postgres.DSN != "" {
+		checks = append(checks, health.Check{
+			Name: "postgres",
+			Probe: func(ctx context.Context) error {
+				return postgres.CheckConnectivity(ctx, cfg.Postgres)
+			},
+		})
+	}
+	return checks
 }
@@ -3,16 +3,26 @@ package main
 import (
 	"context"
 	"log"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 
+	"mq-redis/internal/blob"
 	"mq-redis/internal/config"
+	"mq-redis/internal/envelope"
+	"mq-redis/internal/health"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
 	"mq-redis/internal/postgres"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/throttle"
 	"mq-redis/internal/worker"
 )
 
@@ -27,21 +37,20 @@ func main() {
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
+	if config.PrintRequested(os.Args[1:]) {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("print config: %v", err)
+		}
+		return
+	}
 	if err := cfg.ValidateForWorker(); err != nil {
 		log.Fatalf("invalid config: %v", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-	defer func() {
-		if err := redisClient.Close(); err != nil {
-			log.Printf("redis close error: %v", err)
-		}
-	}()
-
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("redis client init failed: %v", err)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		log.Printf("redis ping failed: %v", err)
@@ -49,7 +58,7 @@ func main() {
 	cancel()
 
 	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-	if err := kafka.CheckConnectivity(ctx, cfg.Kafka.Brokers); err != nil {
+	if err := kafka.CheckConnectivity(ctx, cfg.Kafka); err != nil {
 		log.Printf("kafka connectivity check failed: %v", err)
 	}
 	cancel()
@@ -58,60 +67,172 @@ func main() {
 		log.Printf("postgres dsn missing; skipping connectivity check")
 	} else {
 		ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
-		if err := postgres.CheckConnectivity(ctx, cfg.Postgres.DSN); err != nil {
+		if err := postgres.CheckConnectivity(ctx, cfg.Postgres); err != nil {
 			log.Printf("postgres connectivity check failed: %v", err)
 		}
 		cancel()
 	}
 
-	consumer, err := kafka.NewKafkaGoConsumer(cfg.Kafka, cfg.Worker.GroupID)
+	tenantTopics := slices.Collect(maps.Values(cfg.Tenancy.Topics()))
+	consumer, err := kafka.NewKafkaGoConsumer(cfg.Kafka, cfg.Worker.GroupID, tenantTopics...)
 	if err != nil {
 		log.Fatalf("kafka consumer init failed: %v", err)
 	}
-	defer func() {
-		if err := consumer.Close(); err != nil {
-			log.Printf("kafka consumer close error: %v", err)
-		}
-	}()
 
 	dlqProducer, err := kafka.NewKafkaGoProducer(cfg.Kafka)
 	if err != nil {
 		log.Printf("kafka dlq producer init failed: %v", err)
 	}
-	if dlqProducer != nil {
-		defer func() {
-			if err := dlqProducer.Close(); err != nil {
-				log.Printf("kafka dlq producer close error: %v", err)
-			}
-		}()
+
+	keyring, err := envelope.New(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("encryption keyring init failed: %v", err)
+	}
+	blobs, err := blob.New(cfg.Blob)
+	if err != nil {
+		log.Fatalf("blob resolver init failed: %v", err)
+	}
+	if blobs == nil {
+		log.Printf("blob backend not configured; payload refs reach processors unresolved")
 	}
 
-	runner, err := worker.New(consumer, redisClient, &worker.NoopProcessor{}, dlqProducer, cfg.Kafka.DLQTopic)
+	registry := metrics.NewRegistry()
+	runner, err := worker.New(consumer, redisClient, &worker.NoopProcessor{}, dlqProducer, cfg.Kafka.DLQTopic,
+		worker.WithDrainTimeout(cfg.Worker.DrainTimeout),
+		worker.WithMetrics(registry),
+		worker.WithThrottle(throttle.New(redisClient, cfg.Worker.Throttle, cfg.Redis.Keys())),
+		worker.WithBreaker(cfg.Worker.Breaker),
+		worker.WithIdentity(cfg.Worker.ID),
+		worker.WithLeaseTTL(cfg.Worker.LeaseTTL),
+		worker.WithBlobResolver(blobs, cfg.Blob.MaxBytes),
+		worker.WithKeyring(keyring),
+		worker.WithTTL(cfg.Redis.TTL),
+		worker.WithKeys(cfg.Redis.Keys()),
+		worker.WithRetry(cfg.Worker.Retry),
+	)
 	if err != nil {
 		log.Fatalf("worker init failed: %v", err)
 	}
 
+	watcher := config.NewWatcher(cfgPath, cfg, config.Config.ValidateForWorker,
+		config.WithIgnored("api", "retry_dispatcher", "reconciler"))
+	watcher.OnReload(func(next config.Config) {
+		runner.SetRetry(next.Worker.Retry)
+	})
+
+	opsRouter := health.NewRouter(health.NewChecker(connectTimeout, dependencyChecks(cfg, redisClient)...))
+	opsRouter.GET("/metrics", gin.WrapH(registry.Handler()))
+	healthServer := &http.Server{
+		Addr:    cfg.Worker.HealthAddr,
+		Handler: opsRouter,
+	}
+	go func() {
+		log.Printf("worker health listening on %s", healthServer.Addr)
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("health server error: %v", err)
+		}
+	}()
+
+	// Admin routes have no authentication, so they are only served on an
+	// opted-in loopback listener.
+	var adminServer *http.Server
+	if cfg.Worker.AdminAddr != "" {
+		adminRouter := gin.New()
+		adminRouter.GET("/admin/breakers", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"breakers": runner.Breakers()})
+		})
+		adminRouter.GET("/admin/config", func(c *gin.Context) {
+			c.JSON(http.StatusOK, watcher.Version())
+		})
+		adminServer = &http.Server{
+			Addr:    cfg.Worker.AdminAddr,
+			Handler: adminRouter,
+		}
+		go func() {
+			log.Printf("worker admin listening on %s", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("admin server error: %v", err)
+			}
+		}()
+	}
+
 	runCtx, cancelRun := context.WithCancel(context.Background())
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- runner.Run(runCtx)
 	}()
+	go watcher.Run(runCtx, cfg.Reload.Interval)
 
-	log.Printf("worker starting group=%s concurrency=%d", cfg.Worker.GroupID, cfg.Worker.Concurrency)
-	log.Printf("worker using redis=%s kafka_brokers=%v", cfg.Redis.Addr, cfg.Kafka.Brokers)
+	log.Printf("worker starting id=%s group=%s topics=%v concurrency=%d", runner.ID(), cfg.Worker.GroupID,
+		kafka.ConsumerTopics(cfg.Kafka.JobsTopic, tenantTopics), cfg.Worker.Concurrency)
+	log.Printf("worker using redis=%s kafka_brokers=%v", cfg.Redis.Describe(), cfg.Kafka.Brokers)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
+	// Shutdown order: stop polling, drain the in-flight job, commit offsets
+	// (consumer close), flush the DLQ producer, and only then close Redis,
+	// which the draining job still writes to.
+	log.Printf("worker shutting down drain_timeout=%s", cfg.Worker.DrainTimeout)
 	cancelRun()
 	select {
 	case err := <-errCh:
 		if err != nil && err != context.Canceled {
 			log.Printf("worker stopped with error: %v", err)
 		}
-	case <-time.After(3 * time.Second):
-		log.Printf("worker shutdown timed out")
+	case <-time.After(cfg.Worker.DrainTimeout + connectTimeout):
+		log.Printf("worker drain timed out")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), connectTimeout)
+	if err := healthServer.Shutdown(ctx); err != nil {
+		log.Printf("health server shutdown error: %v", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("admin server shutdown error: %v", err)
+		}
+	}
+	cancel()
+	if err := consumer.Close(); err != nil {
+		log.Printf("kafka consumer close error: %v", err)
+	}
+	if dlqProducer != nil {
+		if err := dlqProducer.Close(); err != nil {
+			log.Printf("kafka dlq producer close error: %v", err)
+		}
+	}
+	if err := redisClient.Close(); err != nil {
+		log.Printf("redis close error: %v", err)
+	}
+	log.Printf("worker stopped")
+}
+
+func dependencyChecks(cfg config.Config, redisClient redis.UniversalClient) []health.Check {
+	checks := []health.Check{
+		{
+			Name:     "kafka",
+			Critical: true,
+			Probe: func(ctx context.Context) error {
+				return kafka.CheckConnectivity(ctx, cfg.Kafka)
+			},
+		},
+		{
+			Name:     "redis",
+			Critical: true,
+			Probe: func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			},
+		},
+	}
+	if cfg.Postgres.DSN != "" {
+		checks = append(checks, health.Check{
+			Name: "postgres",
+			Probe: func(ctx context.Context) error {
+				return postgres.CheckConnectivity(ctx, cfg.Postgres)
+			},
+		})
 	}
-	log.Printf("worker shutting down")
+	return checks
 }
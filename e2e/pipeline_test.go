@@ -0,0 +1,275 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/api"
+	"mq-redis/internal/auth"
+	"mq-redis/internal/dispatcher"
+	"mq-redis/internal/kafka"
+	kafkamemory "mq-redis/internal/kafka/memory"
+	"mq-redis/internal/outbox"
+	producerkafka "mq-redis/internal/producer/kafka"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+	redisstore "mq-redis/internal/store/redis"
+	"mq-redis/internal/tenant"
+	"mq-redis/internal/worker"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+// These tests run API -> Kafka -> worker -> retry -> DLQ in-process, with
+// miniredis and the in-memory broker, so they need no Docker.
+
+const (
+	pipelineJobsTopic = "jobs"
+	pipelineDLQTopic  = "jobs.dlq"
+	pipelineGroup     = "workers"
+	pipelineTimeout   = 5 * time.Second
+)
+
+type processorFunc func(ctx context.Context, jobID string, payload json.RawMessage) error
+
+func (f processorFunc) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	return f(ctx, jobID, payload)
+}
+
+// failWhenAsked fails every job whose payload is {"fail":true}.
+var failWhenAsked = processorFunc(func(ctx context.Context, jobID string, payload json.RawMessage) error {
+	var body struct {
+		Fail bool `json:"fail"`
+	}
+	_ = json.Unmarshal(payload, &body)
+	if body.Fail {
+		return errors.New("processor failed")
+	}
+	return nil
+})
+
+type pipeline struct {
+	broker *kafkamemory.Broker
+	redis  *redis.Client
+	router http.Handler
+	apiKey string
+}
+
+// newPipeline wires the components as the binaries do. With tenants, the API
+// authenticates each client with the key "key-<client>" and the pipeline
+// submits as the first tenant's first client.
+func newPipeline(t *testing.T, processor worker.Processor, tenants ...tenant.Tenant) *pipeline {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	broker := kafkamemory.New()
+	cfg := kafka.Config{Brokers: []string{"in-process"}, JobsTopic: pipelineJobsTopic, DLQTopic: pipelineDLQTopic}
+	tenancy := tenant.Config{Tenants: tenants}
+	producer, err := producerkafka.New(cfg, broker, producerkafka.WithTenantTopics(tenancy.Topics()))
+	if err != nil {
+		t.Fatalf("producer: %v", err)
+	}
+
+	tenantTopics := slices.Collect(maps.Values(tenancy.Topics()))
+	consumer := broker.GroupConsumer(pipelineGroup, kafka.ConsumerTopics(pipelineJobsTopic, tenantTopics)...)
+	w, err := worker.New(consumer, rc, processor, broker, pipelineDLQTopic, worker.WithIdentity("pipeline-worker"))
+	if err != nil {
+		t.Fatalf("worker: %v", err)
+	}
+	d, err := dispatcher.New(rc, producer, 20*time.Millisecond, 100)
+	if err != nil {
+		t.Fatalf("dispatcher: %v", err)
+	}
+	relay, err := outbox.New(rc, producer, 20*time.Millisecond, outbox.Config{Grace: 50 * time.Millisecond, Lease: time.Second, BatchSize: 100})
+	if err != nil {
+		t.Fatalf("outbox relay: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, run := range []func(context.Context) error{w.Run, d.Run, relay.Run} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = run(ctx)
+		}()
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		consumer.Close()
+	})
+
+	p := &pipeline{broker: broker, redis: rc}
+	var opts []api.Option
+	if len(tenants) > 0 {
+		var apiKeys []auth.APIKey
+		for _, tn := range tenants {
+			for _, client := range tn.Clients {
+				apiKeys = append(apiKeys, auth.APIKey{ClientID: client, Key: "key-" + client})
+			}
+		}
+		p.apiKey = apiKeys[0].Key
+		opts = append(opts, api.WithAuthenticators(auth.NewStaticKeys(apiKeys)), api.WithTenants(tenant.NewRegistry(tenancy)))
+	}
+	p.router = api.NewRouter(redisstore.NewWithClient(rc), producer, opts...)
+	return p
+}
+
+func (p *pipeline) serve(req *http.Request) *httptest.ResponseRecorder {
+	if p.apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, p.apiKey)
+	}
+	w := httptest.NewRecorder()
+	p.router.ServeHTTP(w, req)
+	return w
+}
+
+func (p *pipeline) submit(t *testing.T, key, payload string) (int, api.JobResponse) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"idempotency_key": key, "payload": json.RawMessage(payload)})
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := p.serve(req)
+	var resp api.JobResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+func (p *pipeline) status(t *testing.T, jobID string) state.State {
+	t.Helper()
+	w := p.serve(httptest.NewRequest(http.MethodGet, "/jobs/"+jobID, nil))
+	if w.Code != http.StatusOK {
+		return ""
+	}
+	var resp api.JobResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	return state.State(resp.Status)
+}
+
+func (p *pipeline) waitFor(t *testing.T, jobID string, want state.State) {
+	t.Helper()
+	deadline := time.Now().Add(pipelineTimeout)
+	for time.Now().Before(deadline) {
+		if p.status(t, jobID) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s status = %q, want %q", jobID, p.status(t, jobID), want)
+}
+
+func TestPipelineHappyPath(t *testing.T) {
+	p := newPipeline(t, failWhenAsked)
+
+	code, resp := p.submit(t, "happy-1", `{"n":1}`)
+	if code != http.StatusCreated {
+		t.Fatalf("submit status = %d", code)
+	}
+	p.waitFor(t, resp.JobID, state.Done)
+
+	deadline := time.Now().Add(pipelineTimeout)
+	for p.broker.Lag(pipelineGroup, pipelineJobsTopic) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lag := p.broker.Lag(pipelineGroup, pipelineJobsTopic); lag != 0 {
+		t.Fatalf("consumer lag = %d, want 0", lag)
+	}
+	if n := p.redis.ZCard(context.Background(), keys.OutboxKey()).Val(); n != 0 {
+		t.Fatalf("outbox entries = %d, want 0", n)
+	}
+}
+
+func TestPipelineTenantTopicOverride(t *testing.T) {
+	p := newPipeline(t, failWhenAsked, tenant.Tenant{ID: "team-a", Clients: []string{"a-ci"}, JobsTopic: "jobs.team-a"})
+
+	_, ok := p.submit(t, "tenant-1", `{"n":1}`)
+	p.waitFor(t, ok.JobID, state.Done)
+	_, failed := p.submit(t, "tenant-2", `{"fail":true}`)
+	p.waitFor(t, failed.JobID, state.DLQ)
+
+	if n := len(p.broker.Messages(pipelineJobsTopic)); n != 0 {
+		t.Fatalf("shared jobs topic has %d messages, want 0", n)
+	}
+	// Both first attempts, plus the retry the dispatcher routes the same way.
+	if n := len(p.broker.Messages("jobs.team-a")); n != 3 {
+		t.Fatalf("tenant topic has %d messages, want 3", n)
+	}
+	deadline := time.Now().Add(pipelineTimeout)
+	for p.broker.Lag(pipelineGroup, "jobs.team-a") != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lag := p.broker.Lag(pipelineGroup, "jobs.team-a"); lag != 0 {
+		t.Fatalf("tenant topic lag = %d, want 0", lag)
+	}
+}
+
+func TestPipelineDuplicateSubmitPublishesOnce(t *testing.T) {
+	p := newPipeline(t, failWhenAsked)
+
+	_, first := p.submit(t, "dup-1", `{"n":1}`)
+	_, second := p.submit(t, "dup-1", `{"n":1}`)
+	if first.JobID == "" || first.JobID != second.JobID {
+		t.Fatalf("job ids = %q, %q; want the same", first.JobID, second.JobID)
+	}
+	p.waitFor(t, first.JobID, state.Done)
+	if n := len(p.broker.Messages(pipelineJobsTopic)); n != 1 {
+		t.Fatalf("published %d messages, want 1", n)
+	}
+}
+
+func TestPipelineRetryThenDLQ(t *testing.T) {
+	p := newPipeline(t, failWhenAsked)
+
+	_, resp := p.submit(t, "fail-1", `{"fail":true}`)
+	p.waitFor(t, resp.JobID, state.DLQ)
+
+	// First attempt publishes from the API, the retry from the dispatcher.
+	if n := len(p.broker.Messages(pipelineJobsTopic)); n != 2 {
+		t.Fatalf("jobs topic has %d messages, want 2", n)
+	}
+	dlq := p.broker.Messages(pipelineDLQTopic)
+	if len(dlq) != 1 || dlq[0].Key != resp.JobID {
+		t.Fatalf("dlq messages = %+v", dlq)
+	}
+	if attempts := p.redis.Get(context.Background(), keys.AttemptKey(resp.JobID)).Val(); attempts != "2" {
+		t.Fatalf("attempts = %q, want 2", attempts)
+	}
+}
+
+func TestPipelineOutboxRecoversFailedPublish(t *testing.T) {
+	p := newPipeline(t, failWhenAsked)
+
+	p.broker.SetPublishError(errors.New("broker down"))
+	code, resp := p.submit(t, "outbox-1", `{"n":1}`)
+	if code != http.StatusAccepted || resp.Warning != api.WarningPublishPending {
+		t.Fatalf("submit = %d %+v, want 202 publish_pending", code, resp)
+	}
+	if n := len(p.broker.Messages(pipelineJobsTopic)); n != 0 {
+		t.Fatalf("published %d messages while broker was down", n)
+	}
+
+	p.broker.SetPublishError(nil)
+	p.waitFor(t, resp.JobID, state.Done)
+}
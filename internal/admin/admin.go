@@ -0,0 +1,571 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/compress"
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+)
+
+const DefaultScanCount = 500
+
+var (
+	ErrNotFound      = errors.New("job not found")
+	ErrInvalidStatus = errors.New("job is not in a status that allows this operation")
+	ErrPayloadGone   = errors.New("job payload has expired")
+)
+
+// Job is everything Redis holds about one job.
+type Job struct {
+	ID               string            `json:"job_id"`
+	Status           state.State       `json:"status"`
+	StatusTTLSeconds float64           `json:"status_ttl_seconds"`
+	Attempts         int64             `json:"attempts"`
+	Meta             map[string]string `json:"meta,omitempty"`
+	UpdatedAt        *time.Time        `json:"updated_at,omitempty"`
+	Payload          json.RawMessage   `json:"payload,omitempty"`
+	LeaseOwner       string            `json:"lease_owner,omitempty"`
+	RetryDueAt       *time.Time        `json:"retry_due_at,omitempty"`
+	OutboxPending    bool              `json:"outbox_pending"`
+}
+
+type JobSummary struct {
+	ID        string      `json:"job_id"`
+	Status    state.State `json:"status"`
+	Tenant    string      `json:"tenant,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+type RetryEntry struct {
+	ID      string      `json:"job_id"`
+	Status  state.State `json:"status"`
+	DueAt   time.Time   `json:"due_at"`
+	Overdue bool        `json:"overdue"`
+}
+
+type Result struct {
+	ID    string `json:"job_id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type PurgeReport struct {
+	DryRun        bool     `json:"dry_run"`
+	Keys          []string `json:"keys"`
+	RetryEntries  []string `json:"retry_entries"`
+	OutboxEntries []string `json:"outbox_entries"`
+	Workers       []string `json:"workers"`
+}
+
+type Stats struct {
+	Jobs          int                 `json:"jobs"`
+	ByStatus      map[state.State]int `json:"by_status"`
+	RetryTotal    int64               `json:"retry_total"`
+	RetryDue      int64               `json:"retry_due"`
+	OutboxPending int64               `json:"outbox_pending"`
+	Workers       int                 `json:"workers"`
+}
+
+// cancelScript moves a queued or retrying job to cancelled and removes every
+// pending reference to it. Processing jobs are left alone; the worker owns
+// them until they finish.
+var cancelScript = redis.NewScript(`
+local status = redis.call('GET', KEYS[1])
+if not status then
+	return -1
+end
+if status ~= 'queued' and status ~= 'retrying' then
+	return 0
+end
+redis.call('SET', KEYS[1], 'cancelled', 'PX', ARGV[2])
+redis.call('HSET', KEYS[2], 'updated_at', ARGV[3])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[5], ARGV[1])
+return 1
+`)
+
+// replayScript puts a dead-lettered job back through retry:jobs with a fresh
+// attempt budget, so the retry dispatcher republishes it.
+var replayScript = redis.NewScript(`
+local status = redis.call('GET', KEYS[1])
+if not status then
+	return -1
+end
+if status ~= 'dlq' then
+	return 0
+end
+if redis.call('EXISTS', KEYS[3]) == 0 then
+	return -2
+end
+redis.call('SET', KEYS[1], 'queued', 'PX', ARGV[2])
+redis.call('HSET', KEYS[2], 'updated_at', ARGV[4])
+redis.call('DEL', KEYS[4])
+redis.call('ZADD', KEYS[5], ARGV[3], ARGV[1])
+redis.call('ZADD', KEYS[6], ARGV[3], ARGV[1])
+return 1
+`)
+
+// Admin backs the mqctl operator commands. All writes are guarded by the
+// job's current status so they are safe to run against live services.
+type Admin struct {
+	redis     redis.UniversalClient
+	scanCount int64
+	ttl       rediskeys.TTL
+	keys      rediskeys.Keys
+	now       func() time.Time
+}
+
+type Option func(*Admin)
+
+// WithTTL sets the status TTL written by cancel and replay.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(a *Admin) {
+		a.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(a *Admin) {
+		a.keys = keys
+	}
+}
+
+func New(client redis.UniversalClient, opts ...Option) *Admin {
+	a := &Admin{redis: client, scanCount: DefaultScanCount, ttl: rediskeys.DefaultTTL(), now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *Admin) Inspect(ctx context.Context, jobID string) (Job, error) {
+	pipe := a.redis.Pipeline()
+	statusCmd := pipe.Get(ctx, a.keys.JobKey(jobID))
+	ttlCmd := pipe.PTTL(ctx, a.keys.JobKey(jobID))
+	attemptCmd := pipe.Get(ctx, a.keys.AttemptKey(jobID))
+	metaCmd := pipe.HGetAll(ctx, a.keys.JobMetaKey(jobID))
+	dataCmd := pipe.Get(ctx, a.keys.JobDataKey(jobID))
+	leaseCmd := pipe.Get(ctx, a.keys.JobLeaseKey(jobID))
+	retryCmd := pipe.ZScore(ctx, a.keys.RetryJobsKey(), jobID)
+	outboxCmd := pipe.ZScore(ctx, a.keys.OutboxKey(), jobID)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return Job{}, err
+	}
+	if statusCmd.Err() != nil {
+		return Job{}, ErrNotFound
+	}
+
+	job := Job{
+		ID:            jobID,
+		Status:        state.State(statusCmd.Val()),
+		Meta:          metaCmd.Val(),
+		LeaseOwner:    leaseCmd.Val(),
+		OutboxPending: outboxCmd.Err() == nil,
+	}
+	if ttl := ttlCmd.Val(); ttl > 0 {
+		job.StatusTTLSeconds = ttl.Seconds()
+	}
+	job.Attempts, _ = strconv.ParseInt(attemptCmd.Val(), 10, 64)
+	if at, ok := jobmeta.UpdatedAt(job.Meta); ok {
+		job.UpdatedAt = &at
+	}
+	// Compressed snapshots are shown decoded; sealed ones, and any that do
+	// not decode, are left out rather than printed as binary. mqctl holds no
+	// keyring, so encrypted payloads stay unreadable to operators.
+	if dataCmd.Err() == nil && job.Meta[jobmeta.FieldPayloadEncryption] == "" {
+		data, err := compress.Decode(job.Meta[jobmeta.FieldPayloadEncoding], []byte(dataCmd.Val()))
+		if err == nil {
+			job.Payload = json.RawMessage(data)
+		}
+	}
+	if retryCmd.Err() == nil {
+		due := time.UnixMilli(int64(retryCmd.Val()))
+		job.RetryDueAt = &due
+	}
+	return job, nil
+}
+
+// List returns up to limit jobs in the given status; an empty status lists
+// every job. The keyspace is scanned, so order is unspecified.
+func (a *Admin) List(ctx context.Context, status state.State, limit int) ([]JobSummary, error) {
+	out := []JobSummary{}
+	err := a.scanStatuses(ctx, func(ids []string, statuses []state.State) (bool, error) {
+		var matched []JobSummary
+		for i, id := range ids {
+			if status == "" || statuses[i] == status {
+				matched = append(matched, JobSummary{ID: id, Status: statuses[i]})
+			}
+		}
+		if limit > 0 && len(out)+len(matched) > limit {
+			matched = matched[:limit-len(out)]
+		}
+		if len(matched) == 0 {
+			return true, nil
+		}
+		pipe := a.redis.Pipeline()
+		metaCmds := make([]*redis.MapStringStringCmd, len(matched))
+		for i, job := range matched {
+			metaCmds[i] = pipe.HGetAll(ctx, a.keys.JobMetaKey(job.ID))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return false, err
+		}
+		for i, job := range matched {
+			meta := jobmeta.FromFields(metaCmds[i].Val())
+			job.Tenant, job.Type = meta.Tenant, meta.Type
+			if at, ok := jobmeta.UpdatedAt(metaCmds[i].Val()); ok {
+				job.UpdatedAt = &at
+			}
+			out = append(out, job)
+		}
+		return limit <= 0 || len(out) < limit, nil
+	})
+	return out, err
+}
+
+// Retries lists retry:jobs in due order.
+func (a *Admin) Retries(ctx context.Context, limit int) ([]RetryEntry, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	entries, err := a.redis.ZRangeWithScores(ctx, a.keys.RetryJobsKey(), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := a.redis.Pipeline()
+	statusCmds := make([]*redis.StringCmd, len(entries))
+	for i, z := range entries {
+		statusCmds[i] = pipe.Get(ctx, a.keys.JobKey(z.Member.(string)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	now := a.now()
+	out := make([]RetryEntry, 0, len(entries))
+	for i, z := range entries {
+		due := time.UnixMilli(int64(z.Score))
+		out = append(out, RetryEntry{
+			ID:      z.Member.(string),
+			Status:  state.State(statusCmds[i].Val()),
+			DueAt:   due,
+			Overdue: !due.After(now),
+		})
+	}
+	return out, nil
+}
+
+// Cancel stops a job that has not started processing. The worker skips
+// cancelled jobs if a copy is already on Kafka.
+func (a *Admin) Cancel(ctx context.Context, jobID string) error {
+	tenantID, err := a.redis.HGet(ctx, a.keys.JobMetaKey(jobID), jobmeta.FieldTenant).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	keys := []string{
+		a.keys.JobKey(jobID),
+		a.keys.JobMetaKey(jobID),
+		a.keys.RetryJobsKey(),
+		a.keys.OutboxKey(),
+		a.keys.TenantQueuedJobsKey(tenantID),
+	}
+	res, err := cancelScript.Run(ctx, a.redis, keys,
+		jobID, a.ttl.JobStatus.Milliseconds(), jobmeta.FormatUpdatedAt(a.now())).Int64()
+	if err != nil {
+		return err
+	}
+	return scriptResult(res)
+}
+
+// ReplayDLQ requeues dead-lettered jobs. With no ids, every job in dlq
+// status is replayed.
+func (a *Admin) ReplayDLQ(ctx context.Context, jobIDs []string) ([]Result, error) {
+	if len(jobIDs) == 0 {
+		jobs, err := a.List(ctx, state.DLQ, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.ID)
+		}
+	}
+	out := make([]Result, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		res := Result{ID: id, OK: true}
+		if err := a.replay(ctx, id); err != nil {
+			res.OK, res.Error = false, err.Error()
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+func (a *Admin) replay(ctx context.Context, jobID string) error {
+	tenantID, err := a.redis.HGet(ctx, a.keys.JobMetaKey(jobID), jobmeta.FieldTenant).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	now := a.now()
+	keys := []string{
+		a.keys.JobKey(jobID),
+		a.keys.JobMetaKey(jobID),
+		a.keys.JobDataKey(jobID),
+		a.keys.AttemptKey(jobID),
+		a.keys.RetryJobsKey(),
+		a.keys.TenantQueuedJobsKey(tenantID),
+	}
+	res, err := replayScript.Run(ctx, a.redis, keys,
+		jobID, a.ttl.JobStatus.Milliseconds(), now.UnixMilli(), jobmeta.FormatUpdatedAt(now)).Int64()
+	if err != nil {
+		return err
+	}
+	if res == -2 {
+		return ErrPayloadGone
+	}
+	return scriptResult(res)
+}
+
+func scriptResult(res int64) error {
+	switch res {
+	case 1:
+		return nil
+	case 0:
+		return ErrInvalidStatus
+	default:
+		return ErrNotFound
+	}
+}
+
+// companionPrefixes are the per-job keys that outlive nothing on their own:
+// once job:<id> has expired they are garbage.
+var companionPrefixes = []string{
+	rediskeys.JobDataKeyPrefix,
+	rediskeys.JobMetaKeyPrefix,
+	rediskeys.AttemptKeyPrefix,
+	rediskeys.JobLeaseKeyPrefix,
+}
+
+// Purge removes data left behind by expired jobs: companion keys whose status
+// key is gone, retry and outbox entries for unknown jobs, and registry
+// entries for workers that stopped heartbeating.
+func (a *Admin) Purge(ctx context.Context, dryRun bool) (PurgeReport, error) {
+	report := PurgeReport{DryRun: dryRun, Keys: []string{}, RetryEntries: []string{}, OutboxEntries: []string{}, Workers: []string{}}
+
+	scanner, err := redisclient.ScanClient(ctx, a.redis, a.keys)
+	if err != nil {
+		return report, err
+	}
+	var cursor uint64
+	for {
+		keys, next, err := scanner.Scan(ctx, cursor, a.keys.JobScanPattern(), a.scanCount).Result()
+		if err != nil {
+			return report, err
+		}
+		var companions, owners []string
+		for _, key := range keys {
+			if id, ok := a.companionJobID(key); ok {
+				companions = append(companions, key)
+				owners = append(owners, a.keys.JobKey(id))
+			}
+		}
+		orphans, err := a.missing(ctx, owners)
+		if err != nil {
+			return report, err
+		}
+		for i, gone := range orphans {
+			if gone {
+				report.Keys = append(report.Keys, companions[i])
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if report.RetryEntries, err = a.orphanMembers(ctx, a.keys.RetryJobsKey(), a.keys.JobKey); err != nil {
+		return report, err
+	}
+	if report.OutboxEntries, err = a.orphanMembers(ctx, a.keys.OutboxKey(), a.keys.JobKey); err != nil {
+		return report, err
+	}
+	if report.Workers, err = a.orphanMembers(ctx, a.keys.WorkersKey(), a.keys.WorkerHeartbeatKey); err != nil {
+		return report, err
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	pipe := a.redis.Pipeline()
+	for _, key := range report.Keys {
+		pipe.Del(ctx, key)
+	}
+	for _, id := range report.RetryEntries {
+		pipe.ZRem(ctx, a.keys.RetryJobsKey(), id)
+	}
+	for _, id := range report.OutboxEntries {
+		pipe.ZRem(ctx, a.keys.OutboxKey(), id)
+	}
+	for _, id := range report.Workers {
+		pipe.ZRem(ctx, a.keys.WorkersKey(), id)
+	}
+	_, err = pipe.Exec(ctx)
+	return report, err
+}
+
+func (a *Admin) companionJobID(key string) (string, bool) {
+	key = a.keys.Untag(key)
+	for _, prefix := range companionPrefixes {
+		if id, ok := strings.CutPrefix(key, prefix); ok && id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// orphanMembers returns ZSET members whose owning key (ownerKey(member)) no
+// longer exists.
+func (a *Admin) orphanMembers(ctx context.Context, zkey string, ownerKey func(string) string) ([]string, error) {
+	members, err := a.redis.ZRange(ctx, zkey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]string, len(members))
+	for i, m := range members {
+		owners[i] = ownerKey(m)
+	}
+	gone, err := a.missing(ctx, owners)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for i, g := range gone {
+		if g {
+			out = append(out, members[i])
+		}
+	}
+	return out, nil
+}
+
+func (a *Admin) missing(ctx context.Context, keys []string) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	pipe := a.redis.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	out := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		out[i] = cmd.Val() == 0
+	}
+	return out, nil
+}
+
+func (a *Admin) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{ByStatus: make(map[state.State]int)}
+	err := a.scanStatuses(ctx, func(ids []string, statuses []state.State) (bool, error) {
+		for _, s := range statuses {
+			stats.Jobs++
+			stats.ByStatus[s]++
+		}
+		return true, nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	pipe := a.redis.Pipeline()
+	retryTotal := pipe.ZCard(ctx, a.keys.RetryJobsKey())
+	retryDue := pipe.ZCount(ctx, a.keys.RetryJobsKey(), "-inf", strconv.FormatInt(a.now().UnixMilli(), 10))
+	outbox := pipe.ZCard(ctx, a.keys.OutboxKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return stats, err
+	}
+	stats.RetryTotal, stats.RetryDue, stats.OutboxPending = retryTotal.Val(), retryDue.Val(), outbox.Val()
+
+	workers, err := a.redis.ZRange(ctx, a.keys.WorkersKey(), 0, -1).Result()
+	if err != nil {
+		return stats, err
+	}
+	hbKeys := make([]string, len(workers))
+	for i, id := range workers {
+		hbKeys[i] = a.keys.WorkerHeartbeatKey(id)
+	}
+	gone, err := a.missing(ctx, hbKeys)
+	if err != nil {
+		return stats, err
+	}
+	for _, g := range gone {
+		if !g {
+			stats.Workers++
+		}
+	}
+	return stats, nil
+}
+
+// scanStatuses walks job:<id> status keys one SCAN page at a time; fn returns
+// false to stop early.
+func (a *Admin) scanStatuses(ctx context.Context, fn func(ids []string, statuses []state.State) (bool, error)) error {
+	scanner, err := redisclient.ScanClient(ctx, a.redis, a.keys)
+	if err != nil {
+		return err
+	}
+	var cursor uint64
+	for {
+		keys, next, err := scanner.Scan(ctx, cursor, a.keys.JobScanPattern(), a.scanCount).Result()
+		if err != nil {
+			return err
+		}
+		var ids []string
+		pipe := a.redis.Pipeline()
+		var cmds []*redis.StringCmd
+		for _, key := range keys {
+			id, ok := a.keys.StatusKeyJobID(key)
+			if !ok {
+				continue
+			}
+			ids = append(ids, id)
+			cmds = append(cmds, pipe.Get(ctx, key))
+		}
+		if len(cmds) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			var found []string
+			var statuses []state.State
+			for i, cmd := range cmds {
+				if cmd.Err() != nil {
+					continue
+				}
+				found = append(found, ids[i])
+				statuses = append(statuses, state.State(cmd.Val()))
+			}
+			more, err := fn(found, statuses)
+			if err != nil || !more {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/compress"
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+var now = time.Unix(1_700_000_000, 0)
+
+func newAdmin(t *testing.T) (*Admin, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	a := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	a.scanCount = 10
+	a.now = func() time.Time { return now }
+	return a, mr
+}
+
+func seed(mr *miniredis.Miniredis, id, status string) {
+	mr.Set(keys.JobKey(id), status)
+	mr.Set(keys.JobDataKey(id), `{"n":1}`)
+	mr.HSet(keys.JobMetaKey(id), jobmeta.FieldTenant, "team-a", jobmeta.FieldType, "email",
+		jobmeta.FieldUpdatedAt, jobmeta.FormatUpdatedAt(now.Add(-time.Minute)))
+}
+
+func TestInspect(t *testing.T) {
+	a, mr := newAdmin(t)
+	seed(mr, "j1", "retrying")
+	mr.Set(keys.AttemptKey("j1"), "2")
+	mr.Set(keys.JobLeaseKey("j1"), "w1")
+	mr.ZAdd(keys.RetryJobsKey(), float64(now.Add(time.Minute).UnixMilli()), "j1")
+
+	job, err := a.Inspect(context.Background(), "j1")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if job.Status != state.Retrying || job.Attempts != 2 || job.LeaseOwner != "w1" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if job.RetryDueAt == nil || !job.RetryDueAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("retry due = %v", job.RetryDueAt)
+	}
+	if string(job.Payload) != `{"n":1}` || job.OutboxPending {
+		t.Fatalf("payload=%s outbox=%v", job.Payload, job.OutboxPending)
+	}
+
+	if _, err := a.Inspect(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestInspectDecodesCompressedPayload(t *testing.T) {
+	a, mr := newAdmin(t)
+	seed(mr, "j1", "queued")
+	data, codec, _ := compress.Config{Codec: compress.Snappy, MinBytes: 1}.Encode([]byte(`{"n":"` + strings.Repeat("x", 256) + `"}`))
+	mr.Set(keys.JobDataKey("j1"), string(data))
+	mr.HSet(keys.JobMetaKey("j1"), jobmeta.FieldPayloadEncoding, codec)
+
+	job, err := a.Inspect(context.Background(), "j1")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if !strings.HasPrefix(string(job.Payload), `{"n":"xxx`) {
+		t.Fatalf("payload = %q", job.Payload)
+	}
+
+	mr.HSet(keys.JobMetaKey("j1"), jobmeta.FieldPayloadEncryption, "aes-256-gcm")
+	job, err = a.Inspect(context.Background(), "j1")
+	if err != nil || job.Payload != nil {
+		t.Fatalf("sealed payload = %q, %v", job.Payload, err)
+	}
+}
+
+func TestListFiltersByStatus(t *testing.T) {
+	a, mr := newAdmin(t)
+	for _, id := range []string{"a", "b", "c"} {
+		seed(mr, id, "dlq")
+	}
+	seed(mr, "d", "done")
+
+	jobs, err := a.List(context.Background(), state.DLQ, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 dlq jobs, got %+v", jobs)
+	}
+	if jobs[0].Tenant != "team-a" || jobs[0].Type != "email" || jobs[0].UpdatedAt == nil {
+		t.Fatalf("summary missing meta: %+v", jobs[0])
+	}
+
+	jobs, err = a.List(context.Background(), "", 2)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected limit 2, got %d", len(jobs))
+	}
+}
+
+func TestRetries(t *testing.T) {
+	a, mr := newAdmin(t)
+	seed(mr, "late", "retrying")
+	seed(mr, "soon", "retrying")
+	mr.ZAdd(keys.RetryJobsKey(), float64(now.Add(-time.Second).UnixMilli()), "late")
+	mr.ZAdd(keys.RetryJobsKey(), float64(now.Add(time.Hour).UnixMilli()), "soon")
+
+	entries, err := a.Retries(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("retries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "late" || !entries[0].Overdue || entries[1].Overdue {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	a, mr := newAdmin(t)
+	ctx := context.Background()
+	seed(mr, "q", "queued")
+	mr.ZAdd(keys.OutboxKey(), 1, "q")
+	mr.ZAdd(keys.TenantQueuedJobsKey("team-a"), 1, "q")
+	seed(mr, "p", "processing")
+
+	if err := a.Cancel(ctx, "q"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got, _ := mr.Get(keys.JobKey("q")); got != string(state.Cancelled) {
+		t.Fatalf("status = %q", got)
+	}
+	if ok, _ := mr.ZMembers(keys.OutboxKey()); len(ok) != 0 {
+		t.Fatalf("outbox entry not removed: %v", ok)
+	}
+	if ok, _ := mr.ZMembers(keys.TenantQueuedJobsKey("team-a")); len(ok) != 0 {
+		t.Fatalf("quota not released: %v", ok)
+	}
+
+	if err := a.Cancel(ctx, "p"); !errors.Is(err, ErrInvalidStatus) {
+		t.Fatalf("expected ErrInvalidStatus for processing job, got %v", err)
+	}
+	if err := a.Cancel(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestReplayDLQ(t *testing.T) {
+	a, mr := newAdmin(t)
+	seed(mr, "dead", "dlq")
+	mr.Set(keys.AttemptKey("dead"), "5")
+	seed(mr, "expired", "dlq")
+	mr.Del(keys.JobDataKey("expired"))
+	seed(mr, "ok", "done")
+
+	results, err := a.ReplayDLQ(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	byID := map[string]Result{}
+	for _, r := range results {
+		byID[r.ID] = r
+	}
+	if len(results) != 2 || !byID["dead"].OK || byID["expired"].OK {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if got, _ := mr.Get(keys.JobKey("dead")); got != string(state.Queued) {
+		t.Fatalf("status = %q", got)
+	}
+	if mr.Exists(keys.AttemptKey("dead")) {
+		t.Fatalf("attempt counter not reset")
+	}
+	if score, err := mr.ZScore(keys.RetryJobsKey(), "dead"); err != nil || score != float64(now.UnixMilli()) {
+		t.Fatalf("retry score = %v, %v", score, err)
+	}
+
+	results, err = a.ReplayDLQ(context.Background(), []string{"ok"})
+	if err != nil || len(results) != 1 || results[0].OK {
+		t.Fatalf("expected done job to be rejected, got %+v %v", results, err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	a, mr := newAdmin(t)
+	ctx := context.Background()
+	seed(mr, "live", "queued")
+	mr.Set(keys.JobDataKey("gone"), `{}`)
+	mr.HSet(keys.JobMetaKey("gone"), jobmeta.FieldTenant, "team-a")
+	mr.ZAdd(keys.RetryJobsKey(), 1, "gone")
+	mr.ZAdd(keys.OutboxKey(), 1, "gone")
+	mr.ZAdd(keys.OutboxKey(), 1, "live")
+	mr.ZAdd(keys.WorkersKey(), 1, "dead-worker")
+	mr.ZAdd(keys.WorkersKey(), 1, "w1")
+	mr.HSet(keys.WorkerHeartbeatKey("w1"), "last_seen", "1")
+
+	report, err := a.Purge(ctx, true)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if len(report.Keys) != 2 || len(report.RetryEntries) != 1 || len(report.OutboxEntries) != 1 || len(report.Workers) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if !mr.Exists(keys.JobDataKey("gone")) {
+		t.Fatalf("dry run deleted data")
+	}
+
+	if _, err := a.Purge(ctx, false); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if mr.Exists(keys.JobDataKey("gone")) || mr.Exists(keys.JobMetaKey("gone")) {
+		t.Fatalf("orphan keys not deleted")
+	}
+	if !mr.Exists(keys.JobDataKey("live")) {
+		t.Fatalf("live job data deleted")
+	}
+	if members, _ := mr.ZMembers(keys.OutboxKey()); len(members) != 1 || members[0] != "live" {
+		t.Fatalf("outbox = %v", members)
+	}
+	if members, _ := mr.ZMembers(keys.WorkersKey()); len(members) != 1 || members[0] != "w1" {
+		t.Fatalf("workers = %v", members)
+	}
+}
+
+func TestPurgeWithHashTag(t *testing.T) {
+	tagged := rediskeys.Keys{HashTag: "mq"}
+	a, mr := newAdmin(t)
+	WithKeys(tagged)(a)
+	mr.Set(tagged.JobKey("live"), "queued")
+	mr.Set(tagged.JobDataKey("live"), `{"n":1}`)
+	mr.Set(tagged.JobDataKey("gone"), `{}`)
+
+	report, err := a.Purge(context.Background(), false)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if len(report.Keys) != 1 || report.Keys[0] != "{mq}:job:data:gone" {
+		t.Fatalf("purged keys = %v", report.Keys)
+	}
+	if !mr.Exists("{mq}:job:data:live") {
+		t.Fatalf("live job data deleted")
+	}
+	jobs, err := a.List(context.Background(), "", 10)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "live" {
+		t.Fatalf("list = %+v, %v", jobs, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	a, mr := newAdmin(t)
+	seed(mr, "a", "queued")
+	seed(mr, "b", "queued")
+	seed(mr, "c", "retrying")
+	mr.ZAdd(keys.RetryJobsKey(), float64(now.Add(-time.Second).UnixMilli()), "c")
+	mr.ZAdd(keys.RetryJobsKey(), float64(now.Add(time.Hour).UnixMilli()), "x")
+	mr.ZAdd(keys.OutboxKey(), 1, "a")
+	mr.ZAdd(keys.WorkersKey(), 1, "w1")
+	mr.HSet(keys.WorkerHeartbeatKey("w1"), "last_seen", "1")
+	mr.ZAdd(keys.WorkersKey(), 1, "w2")
+
+	stats, err := a.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Jobs != 3 || stats.ByStatus[state.Queued] != 2 || stats.ByStatus[state.Retrying] != 1 {
+		t.Fatalf("unexpected counts: %+v", stats)
+	}
+	if stats.RetryTotal != 2 || stats.RetryDue != 1 || stats.OutboxPending != 1 || stats.Workers != 1 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+}
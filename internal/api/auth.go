@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+)
+
+const clientIDContextKey = "api.client_id"
+
+// Authenticate rejects requests that no authenticator accepts and records the
+// resolved client ID for handlers. The body is buffered so signature schemes
+// can hash it and handlers can still bind it; a body over maxBodyBytes is
+// refused with 413 before any authenticator runs.
+func Authenticate(maxBodyBytes int64, authenticators ...auth.Authenticator) gin.HandlerFunc {
+	return authenticate(authenticators, maxBodyBytes)
+}
+
+// AuthenticateStream is Authenticate for routes whose body is too large to
+// buffer. Authenticators see a nil body; HMAC clients sign X-Content-Sha256
+// and the handler verifies the body against it as it streams.
+func AuthenticateStream(authenticators ...auth.Authenticator) gin.HandlerFunc {
+	return authenticate(authenticators, 0)
+}
+
+// authenticate buffers up to maxBodyBytes of the body; 0 leaves it unread.
+func authenticate(authenticators []auth.Authenticator, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body []byte
+		if maxBodyBytes > 0 {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: ErrPayloadTooLarge})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidJSON})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		for _, a := range authenticators {
+			clientID, ok, err := a.Authenticate(c.Request, body)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			c.Set(clientIDContextKey, clientID)
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: ErrUnauthorized})
+	}
+}
+
+// ClientID returns the authenticated client, or "" for anonymous requests.
+func ClientID(c *gin.Context) string {
+	return c.GetString(clientIDContextKey)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+	memorystore "mq-redis/internal/store/memory"
+)
+
+func newAuthRouter(store Store, producer Producer) *gin.Engine {
+	return NewRouter(store, producer, WithAuthenticators(auth.FromConfig(auth.Config{
+		APIKeys:  []auth.APIKey{{ClientID: "team-a", Key: "key-a"}, {ClientID: "team-b", Key: "key-b"}},
+		HMACKeys: []auth.HMACKey{{ClientID: "team-c", Secret: "secret-c"}},
+	})...))
+}
+
+func postWithKey(r *gin.Engine, apiKey string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostJobs_Unauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	r := newAuthRouter(store, &fakeProducer{})
+
+	body := []byte(`{"idempotency_key":"k1","payload":{"a":1}}`)
+	for _, key := range []string{"", "wrong"} {
+		w := postWithKey(r, key, body)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("key %q: status = %d, want %d", key, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if store.createCalled {
+		t.Fatalf("did not expect CreateJob to be called")
+	}
+}
+
+func TestPostJobs_OversizedBodyRejectedBeforeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	r := newAuthRouter(store, &fakeProducer{})
+
+	body := []byte(`{"idempotency_key":"k1","payload":"` + strings.Repeat("a", MaxPayloadBytes+RequestOverheadBytes) + `"}`)
+	for _, key := range []string{"", "key-a"} {
+		if w := postWithKey(r, key, body); w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), ErrPayloadTooLarge) {
+			t.Fatalf("key %q: status = %d body = %s", key, w.Code, w.Body.String())
+		}
+	}
+	if store.createCalled {
+		t.Fatalf("did not expect CreateJob to be called")
+	}
+}
+
+func TestPostJobs_APIKeyScopesIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	r := newAuthRouter(store, producer)
+
+	w := postWithKey(r, "key-a", []byte(`{"idempotency_key":"k1","payload":{"a":1}}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if store.getKey != "team-a:k1" || store.createKey != "team-a:k1" {
+		t.Fatalf("idempotency key = %q/%q, want team-a:k1", store.getKey, store.createKey)
+	}
+	if store.createMeta.ClientID != "team-a" {
+		t.Fatalf("client id = %q", store.createMeta.ClientID)
+	}
+}
+
+func TestPostJobs_ClientsDoNotCollide(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newAuthRouter(memorystore.New(), &fakeProducer{})
+
+	body := []byte(`{"idempotency_key":"shared","payload":{"a":1}}`)
+	first := postWithKey(r, "key-a", body)
+	second := postWithKey(r, "key-b", body)
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("status = %d/%d", first.Code, second.Code)
+	}
+	if first.Body.String() == second.Body.String() {
+		t.Fatalf("expected distinct jobs per client, got %s", first.Body.String())
+	}
+}
+
+func TestPostJobs_HMAC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	r := newAuthRouter(store, &fakeProducer{})
+
+	body := []byte(`{"idempotency_key":"k1","payload":{"a":1}}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderClientID, "team-c")
+	req.Header.Set(auth.HeaderTimestamp, ts)
+	req.Header.Set(auth.HeaderSignature, auth.Sign([]byte("secret-c"), ts, http.MethodPost, "/jobs", body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(store.createKey, "team-c:") {
+		t.Fatalf("idempotency key = %q", store.createKey)
+	}
+}
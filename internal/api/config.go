@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithConfigVersion serves version() at GET /admin/config to adminClients.
+// Without any, the route is not registered.
+func WithConfigVersion(version func() any, adminClients []string) Option {
+	return func(h *Handler) {
+		h.configVersion = version
+		h.configAdmins = make(map[string]bool, len(adminClients))
+		for _, id := range adminClients {
+			h.configAdmins[id] = true
+		}
+	}
+}
+
+func (h *Handler) GetConfigVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, h.configVersion())
+}
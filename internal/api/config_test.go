@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+)
+
+func TestGetConfigVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(&fakeStore{}, &fakeProducer{},
+		WithAuthenticators(auth.NewStaticKeys([]auth.APIKey{{ClientID: "ops", Key: "key-ops"}, {ClientID: "team-a", Key: "key-a"}})),
+		WithConfigVersion(func() any { return map[string]int{"version": 3} }, []string{"ops"}))
+
+	if w := schemaRequest(r, http.MethodGet, "/admin/config", "key-a", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin status = %d", w.Code)
+	}
+	w := schemaRequest(r, http.MethodGet, "/admin/config", "key-ops", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"version":3`) {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+}
@@ -4,37 +4,173 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 
+	"mq-redis/internal/auth"
+	"mq-redis/internal/blob"
+	"mq-redis/internal/compress"
+	"mq-redis/internal/envelope"
 	"mq-redis/internal/idempotency"
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/metrics"
 	"mq-redis/internal/payload"
+	"mq-redis/internal/quota"
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/rediskeys"
 	"mq-redis/internal/state"
+	"mq-redis/internal/tenant"
 )
 
 type Handler struct {
-	store           Store
-	producer        Producer
-	maxPayloadBytes int
+	store             Store
+	producer          Producer
+	maxPayloadBytes   int
+	authenticators    []auth.Authenticator
+	tenants           *tenant.Registry
+	quota             Quota
+	limiter           RateLimiter
+	keys              rediskeys.Keys
+	rateMu            sync.RWMutex
+	rateLimit         ratelimit.Config
+	metrics           *metrics.Registry
+	submitted         *metrics.CounterVec
+	rejected          *metrics.CounterVec
+	degraded          *metrics.CounterVec
+	rateLimitDegraded *metrics.CounterVec
+	blobs             blob.Store
+	uploads           Uploads
+	maxUploadBytes    int64
+	uploaded          *metrics.CounterVec
+	compression       compress.Config
+	keyring           *envelope.Keyring
+	schemas           Schemas
+	schemaAdmins      map[string]bool
+	configVersion     func() any
+	configAdmins      map[string]bool
 }
 
-func NewHandler(store Store, producer Producer) *Handler {
-	return &Handler{
+type Option func(*Handler)
+
+// WithAuthenticators requires every job request to be accepted by one of the
+// given authenticators. Without any, the API stays anonymous.
+func WithAuthenticators(authenticators ...auth.Authenticator) Option {
+	return func(h *Handler) {
+		h.authenticators = append(h.authenticators, authenticators...)
+	}
+}
+
+// WithTenants maps authenticated clients to tenants for key namespacing,
+// Kafka routing and quotas.
+func WithTenants(registry *tenant.Registry) Option {
+	return func(h *Handler) {
+		h.tenants = registry
+	}
+}
+
+// WithQuota enforces per-tenant queued-job and submit-rate limits.
+func WithQuota(q Quota) Option {
+	return func(h *Handler) {
+		h.quota = q
+	}
+}
+
+// WithCompression compresses payloads above cfg.MinBytes before they are
+// stored and published, recording the codec in the job meta.
+func WithCompression(cfg compress.Config) Option {
+	return func(h *Handler) {
+		h.compression = cfg
+	}
+}
+
+// WithEncryption seals every payload, after compression, with a data key
+// wrapped by the keyring's active KEK. The envelope is bound to the job id.
+func WithEncryption(keyring *envelope.Keyring) Option {
+	return func(h *Handler) {
+		h.keyring = keyring
+	}
+}
+
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(h *Handler) {
+		h.metrics = registry
+	}
+}
+
+func NewHandler(store Store, producer Producer, opts ...Option) *Handler {
+	h := &Handler{
 		store:           store,
 		producer:        producer,
 		maxPayloadBytes: MaxPayloadBytes,
+		tenants:         tenant.NewRegistry(tenant.Config{}),
+		metrics:         metrics.NewRegistry(),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.submitted = h.metrics.Counter("mq_api_jobs_submitted_total", "Jobs accepted by POST /jobs.", "tenant")
+	h.rejected = h.metrics.Counter("mq_api_jobs_rejected_total", "Jobs rejected by POST /jobs.", "tenant", "reason")
+	h.degraded = h.metrics.Counter("mq_api_jobs_dedupe_degraded_total", "Jobs accepted while dedupe failed open.", "tenant")
+	h.rateLimitDegraded = h.metrics.Counter("mq_api_rate_limit_degraded_total", "Rate-limit checks skipped because the limiter failed open.", "rule")
+	h.uploaded = h.metrics.Counter("mq_api_payload_uploads_total", "Payloads stored by POST /payloads.", "tenant")
+	return h
+}
+
+func NewRouter(store Store, producer Producer, opts ...Option) *gin.Engine {
+	return NewHandler(store, producer, opts...).Router()
 }
 
-func NewRouter(store Store, producer Producer) *gin.Engine {
+// Router registers the handler's routes on a new engine. Use it instead of
+// NewRouter to keep the Handler for runtime updates such as SetRateLimit.
+func (h *Handler) Router() *gin.Engine {
 	r := gin.New()
-	h := NewHandler(store, producer)
-	r.POST("/jobs", h.PostJobs)
+	jobs := r.Group("/jobs", h.middleware(false)...)
+	jobs.POST("", h.PostJobs)
+	jobs.GET("/:id", h.GetJob)
+	if h.blobs != nil {
+		r.Group("/payloads", h.middleware(true)...).POST("", h.PostPayloads)
+	}
+	if h.schemas != nil && len(h.schemaAdmins) > 0 {
+		admin := r.Group("/admin/schemas", append(h.middleware(false), requireAdmin(h.schemaAdmins))...)
+		admin.GET("", h.ListSchemas)
+		admin.GET("/:type", h.GetSchema)
+		admin.PUT("/:type", h.PutSchema)
+		admin.DELETE("/:type", h.DeleteSchema)
+	}
+	if h.configVersion != nil && len(h.configAdmins) > 0 {
+		r.GET("/admin/config", append(h.middleware(false), requireAdmin(h.configAdmins), h.GetConfigVersion)...)
+	}
 	return r
 }
 
+// requireAdmin admits only the listed authenticated clients.
+func requireAdmin(admins map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !admins[ClientID(c)] {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: ErrForbidden})
+			return
+		}
+		c.Next()
+	}
+}
+
+// middleware authenticates requests; streamed routes skip body buffering.
+func (h *Handler) middleware(streamed bool) []gin.HandlerFunc {
+	var out []gin.HandlerFunc
+	switch {
+	case len(h.authenticators) == 0:
+	case streamed:
+		out = append(out, AuthenticateStream(h.authenticators...))
+	default:
+		out = append(out, Authenticate(int64(h.maxPayloadBytes)+RequestOverheadBytes, h.authenticators...))
+	}
+	return out
+}
+
 func (h *Handler) PostJobs(c *gin.Context) {
 	var req JobRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -47,6 +183,18 @@ func (h *Handler) PostJobs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrMissingIdempotency})
 		return
 	}
+	req.Type = strings.TrimSpace(req.Type)
+	if !validJobType(req.Type) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidJobType})
+		return
+	}
+	clientID := ClientID(c)
+	t := h.tenants.Resolve(clientID)
+	req.PayloadRef = strings.TrimSpace(req.PayloadRef)
+	if h.foreignUpload(req.PayloadRef, t.ID) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: ErrForbidden})
+		return
+	}
 	decision, jobPayload, err := payload.Normalize(payload.Input{
 		Inline: req.Payload,
 		Ref:    req.PayloadRef,
@@ -75,12 +223,35 @@ func (h *Handler) PostJobs(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrPayloadEncoding})
 		return
 	}
+	if decision == payload.DecisionInline && !h.validPayload(c, t.ID, req.Type, jobPayload) {
+		return
+	}
+	jobPayload, encoding, err := h.compression.Encode(jobPayload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrPayloadEncoding})
+		return
+	}
+
+	idemKey := idempotency.ScopedKey(clientID, req.IdempotencyKey)
+	meta := jobmeta.Meta{
+		ClientID:        clientID,
+		Tenant:          t.ID,
+		Type:            req.Type,
+		PayloadRef:      decision == payload.DecisionRef,
+		PayloadEncoding: encoding,
+	}
+	if h.keyring != nil {
+		meta.PayloadEncryption = envelope.Scheme
+	}
+	if !h.allowRate(c, ratelimit.Dimensions{Client: clientID, Tenant: t.ID, Type: req.Type}) {
+		return
+	}
 
 	ctx := c.Request.Context()
-	jobID, found, err := h.store.GetJobIDByIdempotencyKey(ctx, req.IdempotencyKey)
+	jobID, found, err := h.store.GetJobIDByIdempotencyKey(ctx, t.ID, idemKey)
 	switch idempotency.DecideLookup(found, err) {
 	case idempotency.LookupFailOpen:
-		h.failOpen(c, jobPayload)
+		h.failOpen(c, jobPayload, meta)
 		return
 	case idempotency.LookupError:
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrStore})
@@ -96,10 +267,22 @@ func (h *Handler) PostJobs(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrIDGeneration})
 		return
 	}
-	if err := h.store.CreateJob(ctx, req.IdempotencyKey, jobID, jobPayload); err != nil {
+	jobPayload, ok := h.seal(c, jobID, jobPayload)
+	if !ok {
+		return
+	}
+	if decision == payload.DecisionRef && !h.claimUpload(c, req.PayloadRef) {
+		return
+	}
+	if !h.reserve(c, t, jobID) {
+		h.unclaimUpload(c, decision, req.PayloadRef)
+		return
+	}
+	if err := h.store.CreateJob(ctx, idemKey, jobID, jobPayload, meta); err != nil {
+		h.release(c, t.ID, jobID)
 		switch idempotency.DecideCreate(err) {
 		case idempotency.CreateAlreadyExists:
-			jobID, found, err := h.store.GetJobIDByIdempotencyKey(ctx, req.IdempotencyKey)
+			jobID, found, err := h.store.GetJobIDByIdempotencyKey(ctx, t.ID, idemKey)
 			if idempotency.DecideDuplicate(found, err) == idempotency.DuplicateReturnExisting {
 				c.JSON(http.StatusCreated, JobResponse{JobID: jobID, Status: string(state.Queued)})
 				return
@@ -107,37 +290,121 @@ func (h *Handler) PostJobs(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrStore})
 			return
 		case idempotency.CreateFailOpen:
-			h.failOpenWithJobID(c, jobPayload, jobID)
+			h.failOpenWithJobID(c, jobPayload, jobID, meta)
 			return
 		case idempotency.CreateError:
+			h.unclaimUpload(c, decision, req.PayloadRef)
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrStore})
 			return
 		case idempotency.CreateOK:
 		}
 	}
-	if err := h.producer.Publish(ctx, jobID, jobPayload); err != nil {
-		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrPublish})
+	h.submitted.With(tenant.Label(t.ID)).Inc()
+	// The job is already in the outbox, so a failed publish is not lost: the
+	// relay picks it up after its grace period.
+	if err := h.producer.Publish(ctx, jobID, jobPayload, meta); err != nil {
+		log.Printf("publish failed; leaving job %s to the outbox relay: %v", jobID, err)
+		c.JSON(http.StatusAccepted, JobResponse{
+			JobID:   jobID,
+			Status:  string(state.Queued),
+			Warning: WarningPublishPending,
+		})
 		return
 	}
+	if err := h.store.MarkPublished(ctx, jobID); err != nil {
+		log.Printf("outbox mark failed job_id=%s; relay may publish it again: %v", jobID, err)
+	}
 
 	c.JSON(http.StatusCreated, JobResponse{JobID: jobID, Status: string(state.Queued)})
 }
 
-func (h *Handler) failOpen(c *gin.Context, payload json.RawMessage) {
+// GetJob reports a job's current status. Jobs owned by another tenant are
+// reported as not found.
+func (h *Handler) GetJob(c *gin.Context) {
+	job, found, err := h.store.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrStore})
+		return
+	}
+	if !found || job.Meta.Tenant != h.tenants.Resolve(ClientID(c)).ID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: ErrJobNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{JobID: job.ID, Status: string(job.Status)})
+}
+
+// reserve applies the tenant's quota. Quota storage errors fail open, the
+// same trade-off the API makes for dedupe when Redis is unavailable.
+func (h *Handler) reserve(c *gin.Context, t tenant.Resolved, jobID string) bool {
+	if h.quota == nil {
+		return true
+	}
+	decision, err := h.quota.Reserve(c.Request.Context(), t.ID, jobID, t.Quota)
+	if err != nil {
+		log.Printf("quota check failed; allowing job tenant=%s: %v", tenant.Label(t.ID), err)
+		return true
+	}
+	switch decision {
+	case quota.RejectedQueued:
+		h.rejected.With(tenant.Label(t.ID), ErrQuotaExceeded).Inc()
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: ErrQuotaExceeded})
+		return false
+	case quota.RejectedRate:
+		h.rejected.With(tenant.Label(t.ID), ErrRateLimited).Inc()
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: ErrRateLimited})
+		return false
+	case quota.Allowed:
+	}
+	return true
+}
+
+func (h *Handler) release(c *gin.Context, tenantID, jobID string) {
+	if h.quota == nil {
+		return
+	}
+	if err := h.quota.Release(c.Request.Context(), tenantID, jobID); err != nil {
+		log.Printf("quota release failed tenant=%s job_id=%s: %v", tenant.Label(tenantID), jobID, err)
+	}
+}
+
+func (h *Handler) failOpen(c *gin.Context, payload json.RawMessage, meta jobmeta.Meta) {
 	jobID, err := newJobID()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrIDGeneration})
 		return
 	}
-	h.failOpenWithJobID(c, payload, jobID)
+	payload, ok := h.seal(c, jobID, payload)
+	if !ok {
+		return
+	}
+	h.failOpenWithJobID(c, payload, jobID, meta)
+}
+
+// seal encrypts the payload for jobID when encryption is on. Sealing needs
+// the job id, so it runs once the id is known on each path.
+func (h *Handler) seal(c *gin.Context, jobID string, payload json.RawMessage) (json.RawMessage, bool) {
+	if h.keyring == nil {
+		return payload, true
+	}
+	sealed, err := h.keyring.Seal(payload, []byte(jobID))
+	if err != nil {
+		log.Printf("payload seal failed job_id=%s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrPayloadEncoding})
+		return nil, false
+	}
+	return sealed, true
 }
 
-func (h *Handler) failOpenWithJobID(c *gin.Context, payload json.RawMessage, jobID string) {
-	if err := h.producer.Publish(c.Request.Context(), jobID, payload); err != nil {
+func (h *Handler) failOpenWithJobID(c *gin.Context, payload json.RawMessage, jobID string, meta jobmeta.Meta) {
+	if err := h.producer.Publish(c.Request.Context(), jobID, payload, meta); err != nil {
 		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrPublish})
 		return
 	}
 
+	h.submitted.With(tenant.Label(meta.Tenant)).Inc()
+	h.degraded.With(tenant.Label(meta.Tenant)).Inc()
+
 	c.JSON(http.StatusAccepted, JobResponse{
 		JobID:   jobID,
 		Status:  string(state.Queued),
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -12,10 +13,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"mq-redis/internal/compress"
+	"mq-redis/internal/envelope"
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/state"
 	storeerr "mq-redis/internal/store"
 )
 
 type fakeStore struct {
+	getTenant     string
 	getKey        string
 	getJobID      string
 	getFound      bool
@@ -26,7 +32,11 @@ type fakeStore struct {
 	createKey     string
 	createJobID   string
 	createPayload json.RawMessage
+	createMeta    jobmeta.Meta
 	createErr     error
+	published     []string
+	jobs          map[string]storeerr.Job
+	jobErr        error
 }
 
 type getResult struct {
@@ -35,7 +45,8 @@ type getResult struct {
 	err   error
 }
 
-func (s *fakeStore) GetJobIDByIdempotencyKey(ctx context.Context, key string) (string, bool, error) {
+func (s *fakeStore) GetJobIDByIdempotencyKey(ctx context.Context, tenant, key string) (string, bool, error) {
+	s.getTenant = tenant
 	s.getKey = key
 	if len(s.getResults) > 0 {
 		idx := s.getCalls
@@ -48,23 +59,36 @@ func (s *fakeStore) GetJobIDByIdempotencyKey(ctx context.Context, key string) (s
 	return s.getJobID, s.getFound, s.getErr
 }
 
-func (s *fakeStore) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage) error {
+func (s *fakeStore) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
 	s.createCalled = true
+	s.createMeta = meta
 	s.createKey = key
 	s.createJobID = jobID
 	s.createPayload = payload
 	return s.createErr
 }
 
+func (s *fakeStore) MarkPublished(ctx context.Context, jobID string) error {
+	s.published = append(s.published, jobID)
+	return nil
+}
+
+func (s *fakeStore) GetJob(ctx context.Context, jobID string) (storeerr.Job, bool, error) {
+	job, ok := s.jobs[jobID]
+	return job, ok, s.jobErr
+}
+
 type fakeProducer struct {
 	publishCalled  bool
 	publishJobID   string
 	publishPayload json.RawMessage
+	publishMeta    jobmeta.Meta
 	publishErr     error
 }
 
-func (p *fakeProducer) Publish(ctx context.Context, jobID string, payload json.RawMessage) error {
+func (p *fakeProducer) Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
 	p.publishCalled = true
+	p.publishMeta = meta
 	p.publishJobID = jobID
 	p.publishPayload = payload
 	return p.publishErr
@@ -192,6 +216,66 @@ func TestPostJobs_PayloadRefSuccess(t *testing.T) {
 	if string(store.createPayload) != string(producer.publishPayload) {
 		t.Fatalf("store payload and publish payload mismatch")
 	}
+	if !store.createMeta.PayloadRef {
+		t.Fatalf("ref job not marked in meta")
+	}
+}
+
+func TestPostJobs_Compression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	r := NewRouter(store, producer, WithCompression(compress.Config{Codec: compress.Gzip, MinBytes: 64}))
+
+	inline := `{"text":"` + strings.Repeat("a", 1024) + `"}`
+	body := []byte(`{"idempotency_key":"k1","payload":` + inline + `}`)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if store.createMeta.PayloadEncoding != compress.Gzip || producer.publishMeta.PayloadEncoding != compress.Gzip {
+		t.Fatalf("encoding = %q / %q", store.createMeta.PayloadEncoding, producer.publishMeta.PayloadEncoding)
+	}
+	if len(store.createPayload) >= len(inline) {
+		t.Fatalf("stored %d bytes for a %d byte payload", len(store.createPayload), len(inline))
+	}
+	decoded, err := compress.Decode(store.createMeta.PayloadEncoding, store.createPayload)
+	if err != nil || string(decoded) != inline {
+		t.Fatalf("decoded = %q, %v", decoded, err)
+	}
+}
+
+func TestPostJobs_Encryption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keyring, err := envelope.ParseKeyring([]byte("active: k1\nkeys:\n  - id: k1\n    key: " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)) + "\n"))
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	r := NewRouter(store, producer, WithEncryption(keyring))
+
+	body := []byte(`{"idempotency_key":"k1","payload":{"ssn":"123-45-6789"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if store.createMeta.PayloadEncryption != envelope.Scheme {
+		t.Fatalf("meta = %+v", store.createMeta)
+	}
+	if bytes.Contains(store.createPayload, []byte("123-45-6789")) || !bytes.Equal(store.createPayload, producer.publishPayload) {
+		t.Fatalf("stored payload is not the sealed publish payload")
+	}
+	plain, err := keyring.Open(store.createPayload, []byte(store.createJobID))
+	if err != nil || string(plain) != `{"ssn":"123-45-6789"}` {
+		t.Fatalf("open = %q, %v", plain, err)
+	}
 }
 
 func TestPostJobs_PayloadConflict(t *testing.T) {
@@ -339,8 +423,34 @@ func TestPostJobs_PublishFailure(t *testing.T) {
 
 	r.ServeHTTP(w, req)
 
-	if w.Code != http.StatusServiceUnavailable {
-		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if !strings.Contains(w.Body.String(), WarningPublishPending) {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	if len(store.published) != 0 {
+		t.Fatalf("did not expect outbox entry to be marked published")
+	}
+}
+
+func TestPostJobs_MarksOutboxPublished(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	r := NewRouter(store, &fakeProducer{})
+
+	body := []byte(`{"idempotency_key":"k1","payload":{"a":1}}`)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if len(store.published) != 1 || store.published[0] != store.createJobID {
+		t.Fatalf("published = %v, want [%s]", store.published, store.createJobID)
 	}
 }
 
@@ -361,3 +471,45 @@ func TestPostJobs_StoreFailure(t *testing.T) {
 		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
 	}
 }
+
+func TestGetJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{jobs: map[string]storeerr.Job{
+		"job-1": {ID: "job-1", Status: state.Done},
+		"job-2": {ID: "job-2", Status: state.Queued, Meta: jobmeta.Meta{Tenant: "team-a"}},
+	}}
+	r := NewRouter(store, &fakeProducer{})
+
+	cases := []struct {
+		id   string
+		code int
+	}{
+		{"job-1", http.StatusOK},
+		{"job-2", http.StatusNotFound},
+		{"missing", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+tc.id, nil))
+		if w.Code != tc.code {
+			t.Fatalf("GET %s status = %d, want %d", tc.id, w.Code, tc.code)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var resp JobResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.JobID != tc.id || resp.Status != string(state.Done) {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	}
+
+	store.jobErr = errors.New("down")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/job-1", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
@@ -3,13 +3,48 @@ package api
 import (
 	"context"
 	"encoding/json"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/quota"
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/schema"
+	"mq-redis/internal/store"
+	"mq-redis/internal/tenant"
 )
 
 type Store interface {
-	GetJobIDByIdempotencyKey(ctx context.Context, key string) (jobID string, found bool, err error)
-	CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage) error
+	GetJobIDByIdempotencyKey(ctx context.Context, tenant, key string) (jobID string, found bool, err error)
+	CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage, meta jobmeta.Meta) error
+	MarkPublished(ctx context.Context, jobID string) error
+	GetJob(ctx context.Context, jobID string) (job store.Job, found bool, err error)
 }
 
 type Producer interface {
-	Publish(ctx context.Context, jobID string, payload json.RawMessage) error
+	Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error
+}
+
+type Quota interface {
+	Reserve(ctx context.Context, tenantID, jobID string, limits tenant.Quota) (quota.Decision, error)
+	Release(ctx context.Context, tenantID, jobID string) error
+}
+
+// Uploads tracks POST /payloads objects until a job refers to them.
+type Uploads interface {
+	Track(ctx context.Context, ref string) error
+	Claim(ctx context.Context, ref string) error
+}
+
+// Schemas validates inline payloads per job type and is managed through
+// /admin/schemas.
+type Schemas interface {
+	Validate(jobType string, payload []byte) ([]schema.FieldError, error)
+	Get(jobType string) (schema.Info, bool)
+	List() []schema.Info
+	Put(ctx context.Context, jobType string, raw []byte) error
+	Delete(ctx context.Context, jobType string) error
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, rate float64, burst int64) (ratelimit.Result, error)
+	Refund(ctx context.Context, key string, burst int64) error
 }
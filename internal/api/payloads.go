@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+	"mq-redis/internal/blob"
+	"mq-redis/internal/payload"
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/tenant"
+	"mq-redis/internal/upload"
+)
+
+// WithPayloadUploads serves POST /payloads, which streams bodies of up to
+// maxBytes into store and records them in uploads so unused ones can be
+// collected. Zero maxBytes means blob.DefaultMaxBytes.
+func WithPayloadUploads(store blob.Store, uploads Uploads, maxBytes int64) Option {
+	return func(h *Handler) {
+		h.blobs = store
+		h.uploads = uploads
+		h.maxUploadBytes = maxBytes
+		if h.maxUploadBytes <= 0 {
+			h.maxUploadBytes = blob.DefaultMaxBytes
+		}
+	}
+}
+
+// PostPayloads stores the raw request body and returns the payload_ref,
+// payload_size and payload_hash to submit with POST /jobs. The body is
+// hashed while it streams, so it is never held in memory. Content-Length is
+// required because the size is part of the ref and S3 needs it up front.
+// When X-Content-Sha256 is sent (HMAC clients must send it, as they sign it),
+// a body that does not match is deleted and rejected.
+func (h *Handler) PostPayloads(c *gin.Context) {
+	size := c.Request.ContentLength
+	switch {
+	case size < 0:
+		c.JSON(http.StatusLengthRequired, ErrorResponse{Error: ErrLengthRequired})
+		return
+	case size == 0:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrMissingPayload})
+		return
+	case size > h.maxUploadBytes:
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: ErrPayloadTooLarge})
+		return
+	}
+
+	clientID := ClientID(c)
+	t := h.tenants.Resolve(clientID)
+	if !h.allowRate(c, ratelimit.Dimensions{Client: clientID, Tenant: t.ID}) {
+		return
+	}
+	id, err := newJobID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: ErrIDGeneration})
+		return
+	}
+
+	ctx := c.Request.Context()
+	sum := sha256.New()
+	ref, err := h.blobs.Put(ctx, upload.KeyPrefix+tenant.Label(t.ID)+"/"+id, io.TeeReader(c.Request.Body, sum), size)
+	if err != nil {
+		if errors.Is(err, blob.ErrSizeMismatch) || errors.Is(err, io.ErrUnexpectedEOF) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrPayloadIncomplete})
+			return
+		}
+		log.Printf("payload upload failed tenant=%s: %v", tenant.Label(t.ID), err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrBlobStore})
+		return
+	}
+	digest := hex.EncodeToString(sum.Sum(nil))
+	if declared := c.GetHeader(auth.HeaderContentSHA256); declared != "" && !strings.EqualFold(declared, digest) {
+		if err := h.blobs.Delete(ctx, ref); err != nil {
+			log.Printf("mismatched upload delete failed ref=%s: %v", ref, err)
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrPayloadHash})
+		return
+	}
+	// An untracked upload would never be collected, so it is removed rather
+	// than handed out.
+	if h.uploads != nil {
+		if err := h.uploads.Track(ctx, ref); err != nil {
+			log.Printf("upload tracking failed ref=%s: %v", ref, err)
+			if err := h.blobs.Delete(ctx, ref); err != nil {
+				log.Printf("untracked upload delete failed ref=%s: %v", ref, err)
+			}
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrStore})
+			return
+		}
+	}
+	h.uploaded.With(tenant.Label(t.ID)).Inc()
+	c.JSON(http.StatusCreated, PayloadResponse{
+		PayloadRef:  ref,
+		PayloadSize: size,
+		PayloadHash: "sha256:" + digest,
+	})
+}
+
+// foreignUpload reports a ref into another tenant's uploads. POST /payloads
+// hands out refs under the caller's tenant, and only that tenant may submit
+// them; refs outside the upload prefix are left to the worker's resolver.
+func (h *Handler) foreignUpload(ref, tenantID string) bool {
+	if h.blobs == nil || ref == "" {
+		return false
+	}
+	key, ok := h.blobs.Key(ref)
+	if !ok || !strings.HasPrefix(key, upload.KeyPrefix) {
+		return false
+	}
+	return !strings.HasPrefix(key, upload.KeyPrefix+tenant.Label(tenantID)+"/")
+}
+
+// claimUpload keeps the collector away from an upload a job is about to use.
+// It runs before the job is created: once the job is in the outbox it will
+// be published, and an unclaimed upload could be collected before it runs.
+// A failed claim answers 503 and the job is not created.
+func (h *Handler) claimUpload(c *gin.Context, ref string) bool {
+	if h.uploads == nil {
+		return true
+	}
+	if err := h.uploads.Claim(c.Request.Context(), ref); err != nil {
+		log.Printf("upload claim failed ref=%s: %v", ref, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrStore})
+		return false
+	}
+	return true
+}
+
+// unclaimUpload hands an upload back to the collector when the job that
+// claimed it was not created. A failure only means the object is kept.
+func (h *Handler) unclaimUpload(c *gin.Context, decision payload.Decision, ref string) {
+	if h.uploads == nil || decision != payload.DecisionRef {
+		return
+	}
+	if err := h.uploads.Track(c.Request.Context(), ref); err != nil {
+		log.Printf("upload unclaim failed ref=%s: %v", ref, err)
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+	"mq-redis/internal/blob"
+	"mq-redis/internal/payload"
+	"mq-redis/internal/tenant"
+)
+
+type fakeUploads struct {
+	tracked  map[string]bool
+	trackErr error
+	claimErr error
+}
+
+func (u *fakeUploads) Track(ctx context.Context, ref string) error {
+	if u.trackErr != nil {
+		return u.trackErr
+	}
+	u.tracked[ref] = true
+	return nil
+}
+
+func (u *fakeUploads) Claim(ctx context.Context, ref string) error {
+	if u.claimErr != nil {
+		return u.claimErr
+	}
+	delete(u.tracked, ref)
+	return nil
+}
+
+func postPayload(r http.Handler, body string) *httptest.ResponseRecorder {
+	return postPayloadWithKey(r, "", body)
+}
+
+func postPayloadWithKey(r http.Handler, apiKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payloads", strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostPayloadsThenJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	blobs := blob.NewLocal(t.TempDir())
+	uploads := &fakeUploads{tracked: map[string]bool{}}
+	r := NewRouter(store, &fakeProducer{}, WithPayloadUploads(blobs, uploads, 1024))
+
+	body := `{"large":"payload"}`
+	w := postPayload(r, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+	var resp PayloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	sum := sha256.Sum256([]byte(body))
+	if resp.PayloadSize != int64(len(body)) || resp.PayloadHash != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if !strings.Contains(resp.PayloadRef, "/uploads/default/") || !uploads.tracked[resp.PayloadRef] {
+		t.Fatalf("ref = %s tracked = %v", resp.PayloadRef, uploads.tracked)
+	}
+	data, err := blob.Fetch(context.Background(), blobs, payload.RefPayload{Ref: resp.PayloadRef, Size: resp.PayloadSize, Hash: resp.PayloadHash}, 0)
+	if err != nil || string(data) != body {
+		t.Fatalf("fetch = %q, %v", data, err)
+	}
+
+	job, _ := json.Marshal(map[string]any{"idempotency_key": "k1", "payload_ref": resp.PayloadRef, "payload_size": resp.PayloadSize, "payload_hash": resp.PayloadHash})
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(job))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("job status = %d", w.Code)
+	}
+	if uploads.tracked[resp.PayloadRef] {
+		t.Fatalf("upload not claimed by the job")
+	}
+}
+
+func TestPostPayloadsRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	root := t.TempDir()
+	uploads := &fakeUploads{tracked: map[string]bool{}}
+	r := NewRouter(&fakeStore{}, &fakeProducer{}, WithPayloadUploads(blob.NewLocal(root), uploads, 8))
+
+	if w := postPayload(r, "more than eight bytes"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("too large status = %d", w.Code)
+	}
+	if w := postPayload(r, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty status = %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/payloads", strings.NewReader("x"))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusLengthRequired {
+		t.Fatalf("chunked status = %d", w.Code)
+	}
+
+	uploads.trackErr = errors.New("redis down")
+	if w := postPayload(r, "data"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("untracked status = %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(root + "/uploads/default"); len(entries) != 0 {
+		t.Fatalf("untracked upload left behind: %v", entries)
+	}
+}
+
+func TestPostPayloadsHMACStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	root := t.TempDir()
+	r := NewRouter(&fakeStore{}, &fakeProducer{},
+		WithAuthenticators(auth.NewHMAC([]auth.HMACKey{{ClientID: "team-c", Secret: "secret-c"}}, 0)),
+		WithPayloadUploads(blob.NewLocal(root), &fakeUploads{tracked: map[string]bool{}}, 1024))
+
+	upload := func(body, declared string) *httptest.ResponseRecorder {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/payloads", strings.NewReader(body))
+		req.Header.Set(auth.HeaderClientID, "team-c")
+		req.Header.Set(auth.HeaderTimestamp, ts)
+		req.Header.Set(auth.HeaderContentSHA256, declared)
+		req.Header.Set(auth.HeaderSignature, auth.SignDigest([]byte("secret-c"), ts, http.MethodPost, "/payloads", declared))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	sum := sha256.Sum256([]byte("payload"))
+	digest := hex.EncodeToString(sum[:])
+	if w := upload("payload", digest); w.Code != http.StatusCreated {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+	// A validly signed digest does not vouch for a different body.
+	if w := upload("tampered", digest); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrPayloadHash) {
+		t.Fatalf("mismatch status = %d body = %s", w.Code, w.Body.String())
+	}
+	if entries, _ := os.ReadDir(root + "/uploads/default"); len(entries) != 1 {
+		t.Fatalf("uploads left = %d, want only the matching one", len(entries))
+	}
+}
+
+func TestPostPayloadsDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(&fakeStore{}, &fakeProducer{})
+	if w := postPayload(r, "data"); w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func postRefJob(r http.Handler, apiKey string, ref PayloadResponse) *httptest.ResponseRecorder {
+	job, _ := json.Marshal(map[string]any{"idempotency_key": "k1", "payload_ref": ref.PayloadRef, "payload_size": ref.PayloadSize, "payload_hash": ref.PayloadHash})
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(job))
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostJobsRejectsAnotherTenantsUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	uploads := &fakeUploads{tracked: map[string]bool{}}
+	r := NewRouter(store, &fakeProducer{},
+		WithAuthenticators(auth.NewStaticKeys([]auth.APIKey{{ClientID: "a-ci", Key: "key-a"}, {ClientID: "b-ci", Key: "key-b"}})),
+		WithTenants(tenant.NewRegistry(tenant.Config{Tenants: []tenant.Tenant{
+			{ID: "team-a", Clients: []string{"a-ci"}},
+			{ID: "team-b", Clients: []string{"b-ci"}},
+		}})),
+		WithPayloadUploads(blob.NewLocal(t.TempDir()), uploads, 1024))
+
+	w := postPayloadWithKey(r, "key-a", `{"secret":1}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d body = %s", w.Code, w.Body.String())
+	}
+	var ref PayloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &ref); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	dotted := ref
+	dotted.PayloadRef = strings.Replace(ref.PayloadRef, "/uploads/team-a/", "/uploads/team-b/../team-a/", 1)
+	for _, stolen := range []PayloadResponse{ref, dotted} {
+		if w := postRefJob(r, "key-b", stolen); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrForbidden) {
+			t.Fatalf("ref %s: status = %d body = %s", stolen.PayloadRef, w.Code, w.Body.String())
+		}
+	}
+	if store.createCalled || !uploads.tracked[ref.PayloadRef] {
+		t.Fatalf("created = %v tracked = %v", store.createCalled, uploads.tracked)
+	}
+
+	if w := postRefJob(r, "key-a", ref); w.Code != http.StatusCreated {
+		t.Fatalf("owner status = %d body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPostJobsFailsWhenUploadClaimFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	uploads := &fakeUploads{tracked: map[string]bool{}}
+	r := NewRouter(store, producer, WithPayloadUploads(blob.NewLocal(t.TempDir()), uploads, 1024))
+
+	w := postPayload(r, `{"large":"payload"}`)
+	var ref PayloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &ref); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	uploads.claimErr = errors.New("redis down")
+	if w := postRefJob(r, "", ref); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), ErrStore) {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+	if store.createCalled || producer.publishCalled {
+		t.Fatalf("created = %v published = %v", store.createCalled, producer.publishCalled)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/tenant"
+)
+
+// Job types become part of rate-limit keys and Kafka headers, so they are
+// kept to a conservative charset.
+var jobTypePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func validJobType(jobType string) bool {
+	return jobType == "" || jobTypePattern.MatchString(jobType)
+}
+
+// WithRateLimit applies cfg's token-bucket rules to every submission.
+func WithRateLimit(limiter RateLimiter, cfg ratelimit.Config) Option {
+	return func(h *Handler) {
+		h.limiter = limiter
+		h.rateLimit = cfg
+	}
+}
+
+// WithKeys sets the key layout rate-limit buckets are named in; the default
+// is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(h *Handler) {
+		h.keys = keys
+	}
+}
+
+// SetRateLimit replaces the rules and failure mode for requests that start
+// after it returns. Buckets are keyed by rule name, so an edited rule keeps
+// its current tokens and a renamed one starts full.
+func (h *Handler) SetRateLimit(cfg ratelimit.Config) {
+	h.rateMu.Lock()
+	h.rateLimit = cfg
+	h.rateMu.Unlock()
+}
+
+func (h *Handler) rateLimitConfig() ratelimit.Config {
+	h.rateMu.RLock()
+	defer h.rateMu.RUnlock()
+	return h.rateLimit
+}
+
+// allowRate checks every matching rule and stops at the first exhausted
+// bucket, refunding the tokens earlier rules took so a rejected request costs
+// nothing. Limiter errors follow the configured failure mode: fail open
+// mirrors dedupe_degraded, fail closed answers 503 so clients back off.
+func (h *Handler) allowRate(c *gin.Context, dims ratelimit.Dimensions) bool {
+	if h.limiter == nil {
+		return true
+	}
+	cfg := h.rateLimitConfig()
+	var taken []rateBucket
+	for _, rule := range cfg.Rules {
+		key, ok := rule.Key(h.keys, dims)
+		if !ok {
+			continue
+		}
+		res, err := h.limiter.Allow(c.Request.Context(), key, rule.Rate, rule.Burst)
+		if err != nil {
+			if cfg.FailClosed() {
+				h.refundRate(c, taken)
+				h.rejected.With(tenant.Label(dims.Tenant), ErrRateLimiterDown).Inc()
+				c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrRateLimiterDown})
+				return false
+			}
+			log.Printf("rate limit check failed; allowing job rule=%s tenant=%s: %v", rule.Name, tenant.Label(dims.Tenant), err)
+			h.rateLimitDegraded.With(rule.Name).Inc()
+			continue
+		}
+		if !res.Allowed {
+			h.refundRate(c, taken)
+			h.rejected.With(tenant.Label(dims.Tenant), ErrRateLimited).Inc()
+			c.Header("Retry-After", strconv.FormatInt(ratelimit.RetryAfterSeconds(res.RetryAfter), 10))
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: ErrRateLimited})
+			return false
+		}
+		taken = append(taken, rateBucket{rule: rule, key: key})
+	}
+	return true
+}
+
+// rateBucket is a token a request has taken from a rule's bucket.
+type rateBucket struct {
+	rule ratelimit.Rule
+	key  string
+}
+
+// refundRate returns the tokens of a rejected request. A failed refund only
+// leaves that bucket one token short until it refills.
+func (h *Handler) refundRate(c *gin.Context, taken []rateBucket) {
+	for _, b := range taken {
+		if err := h.limiter.Refund(c.Request.Context(), b.key, b.rule.Burst); err != nil {
+			log.Printf("rate limit refund failed rule=%s: %v", b.rule.Name, err)
+		}
+	}
+}
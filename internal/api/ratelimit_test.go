@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/metrics"
+	"mq-redis/internal/ratelimit"
+)
+
+type fakeLimiter struct {
+	result   ratelimit.Result
+	err      error
+	keys     []string
+	refunded []string
+	// deny, when set, rejects only these keys and allows the rest.
+	deny map[string]bool
+}
+
+func (l *fakeLimiter) Allow(ctx context.Context, key string, rate float64, burst int64) (ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	if l.deny != nil {
+		return ratelimit.Result{Allowed: !l.deny[key], RetryAfter: time.Second}, nil
+	}
+	return l.result, l.err
+}
+
+func (l *fakeLimiter) Refund(ctx context.Context, key string, burst int64) error {
+	l.refunded = append(l.refunded, key)
+	return nil
+}
+
+var typeRules = []ratelimit.Rule{
+	{Name: "per-client", By: []string{ratelimit.DimensionClient}, Rate: 1, Burst: 1},
+	{Name: "email", By: []string{ratelimit.DimensionType}, Rate: 1, Burst: 1, Match: map[string]string{ratelimit.DimensionType: "email"}},
+}
+
+func postTypedJob(r *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostJobs_RateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	limiter := &fakeLimiter{result: ratelimit.Result{RetryAfter: 1500 * time.Millisecond}}
+	reg := metrics.NewRegistry()
+	r := NewRouter(store, &fakeProducer{}, WithRateLimit(limiter, ratelimit.Config{Rules: typeRules}), WithMetrics(reg))
+	w := postTypedJob(r, `{"idempotency_key":"k1","type":"email","payload":{"a":1}}`)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q", got)
+	}
+	if store.createCalled {
+		t.Fatalf("did not expect CreateJob to be called")
+	}
+	if len(limiter.keys) != 1 || limiter.keys[0] != "ratelimit:per-client:" {
+		t.Fatalf("keys = %v", limiter.keys)
+	}
+	var buf bytes.Buffer
+	_ = reg.WriteText(&buf)
+	if !strings.Contains(buf.String(), `mq_api_jobs_rejected_total{tenant="default",reason="rate_limited"} 1`) {
+		t.Fatalf("metrics = %s", buf.String())
+	}
+}
+
+func TestPostJobs_RateLimitRefundsEarlierRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &fakeLimiter{deny: map[string]bool{"ratelimit:email:email": true}}
+	r := NewRouter(&fakeStore{}, &fakeProducer{}, WithRateLimit(limiter, ratelimit.Config{Rules: typeRules}))
+	w := postTypedJob(r, `{"idempotency_key":"k1","type":"email","payload":{"a":1}}`)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if len(limiter.refunded) != 1 || limiter.refunded[0] != "ratelimit:per-client:" {
+		t.Fatalf("refunded = %v, want the per-client token back", limiter.refunded)
+	}
+}
+
+func TestPostJobs_RateLimitMatchesType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	limiter := &fakeLimiter{result: ratelimit.Result{Allowed: true}}
+	r := NewRouter(store, producer, WithRateLimit(limiter, ratelimit.Config{Rules: typeRules}))
+	w := postTypedJob(r, `{"idempotency_key":"k1","type":"email","payload":{"a":1}}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if len(limiter.keys) != 2 || limiter.keys[1] != "ratelimit:email:email" {
+		t.Fatalf("keys = %v", limiter.keys)
+	}
+	if store.createMeta.Type != "email" || producer.publishMeta.Type != "email" {
+		t.Fatalf("type not threaded: create=%q publish=%q", store.createMeta.Type, producer.publishMeta.Type)
+	}
+
+	limiter.keys = nil
+	postTypedJob(r, `{"idempotency_key":"k2","type":"sms","payload":{"a":1}}`)
+	if len(limiter.keys) != 1 {
+		t.Fatalf("expected only the client rule for sms, keys = %v", limiter.keys)
+	}
+}
+
+func TestPostJobs_RateLimiterFailureModes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &fakeLimiter{err: errors.New("redis down")}
+
+	r := NewRouter(&fakeStore{}, &fakeProducer{}, WithRateLimit(limiter, ratelimit.Config{Rules: typeRules}))
+	if w := postTypedJob(r, `{"idempotency_key":"k1","payload":{"a":1}}`); w.Code != http.StatusCreated {
+		t.Fatalf("fail open: status = %d", w.Code)
+	}
+
+	cfg := ratelimit.Config{FailureMode: ratelimit.FailClosed, Rules: typeRules}
+	r = NewRouter(&fakeStore{}, &fakeProducer{}, WithRateLimit(limiter, cfg))
+	w := postTypedJob(r, `{"idempotency_key":"k1","payload":{"a":1}}`)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), ErrRateLimiterDown) {
+		t.Fatalf("fail closed: status = %d body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := &fakeLimiter{err: errors.New("redis down")}
+	h := NewHandler(&fakeStore{}, &fakeProducer{}, WithRateLimit(limiter, ratelimit.Config{Rules: typeRules}))
+	r := h.Router()
+	if w := postTypedJob(r, `{"idempotency_key":"k1","payload":{"a":1}}`); w.Code != http.StatusCreated {
+		t.Fatalf("fail open: status = %d", w.Code)
+	}
+
+	h.SetRateLimit(ratelimit.Config{FailureMode: ratelimit.FailClosed, Rules: typeRules})
+	if w := postTypedJob(r, `{"idempotency_key":"k2","payload":{"a":1}}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("after update: status = %d", w.Code)
+	}
+	h.SetRateLimit(ratelimit.Config{})
+	limiter.keys = nil
+	if w := postTypedJob(r, `{"idempotency_key":"k3","payload":{"a":1}}`); w.Code != http.StatusCreated || len(limiter.keys) != 0 {
+		t.Fatalf("rules cleared: status = %d keys = %v", w.Code, limiter.keys)
+	}
+}
+
+func TestPostJobs_InvalidJobType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(&fakeStore{}, &fakeProducer{})
+	w := postTypedJob(r, `{"idempotency_key":"k1","type":"bad type!","payload":{"a":1}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrInvalidJobType) {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/schema"
+	"mq-redis/internal/tenant"
+)
+
+// WithSchemas validates inline payloads against the schema registered for
+// their job type. adminClients may manage schemas through /admin/schemas;
+// without any, the admin routes are not registered.
+func WithSchemas(schemas Schemas, adminClients []string) Option {
+	return func(h *Handler) {
+		h.schemas = schemas
+		h.schemaAdmins = make(map[string]bool, len(adminClients))
+		for _, id := range adminClients {
+			h.schemaAdmins[id] = true
+		}
+	}
+}
+
+// validPayload answers 422 with the field errors when the payload does not
+// match its type's schema. It runs before any Redis or Kafka call, so a
+// rejected job leaves no trace beyond the rejection metric.
+func (h *Handler) validPayload(c *gin.Context, tenantID, jobType string, payload []byte) bool {
+	if h.schemas == nil {
+		return true
+	}
+	fields, err := h.schemas.Validate(jobType, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidJSON})
+		return false
+	}
+	if len(fields) == 0 {
+		return true
+	}
+	h.rejected.With(tenant.Label(tenantID), ErrPayloadInvalid).Inc()
+	c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: ErrPayloadInvalid, Fields: fields})
+	return false
+}
+
+func (h *Handler) ListSchemas(c *gin.Context) {
+	c.JSON(http.StatusOK, h.schemas.List())
+}
+
+func (h *Handler) GetSchema(c *gin.Context) {
+	info, ok := h.schemas.Get(c.Param("type"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: ErrSchemaNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// PutSchema registers the request body as the schema for :type, replacing
+// any earlier admin-registered one. Types defined by a file are read-only.
+func (h *Handler) PutSchema(c *gin.Context) {
+	jobType := c.Param("type")
+	if jobType == "" || !validJobType(jobType) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidJobType})
+		return
+	}
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, schema.MaxSchemaBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrInvalidJSON})
+		return
+	}
+	if len(raw) > schema.MaxSchemaBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: ErrPayloadTooLarge})
+		return
+	}
+	err = h.schemas.Put(c.Request.Context(), jobType, raw)
+	switch {
+	case err == nil:
+	case errors.Is(err, schema.ErrInvalidSchema):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: ErrSchemaInvalid, Detail: err.Error()})
+		return
+	case errors.Is(err, schema.ErrReadOnly):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrSchemaReadOnly})
+		return
+	default:
+		log.Printf("schema put failed type=%s: %v", jobType, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrStore})
+		return
+	}
+	log.Printf("schema registered type=%s client=%s", jobType, ClientID(c))
+	info, _ := h.schemas.Get(jobType)
+	c.JSON(http.StatusOK, info)
+}
+
+func (h *Handler) DeleteSchema(c *gin.Context) {
+	jobType := c.Param("type")
+	err := h.schemas.Delete(c.Request.Context(), jobType)
+	switch {
+	case err == nil:
+	case errors.Is(err, schema.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: ErrSchemaNotFound})
+		return
+	case errors.Is(err, schema.ErrReadOnly):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: ErrSchemaReadOnly})
+		return
+	default:
+		log.Printf("schema delete failed type=%s: %v", jobType, err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: ErrStore})
+		return
+	}
+	log.Printf("schema removed type=%s client=%s", jobType, ClientID(c))
+	c.Status(http.StatusNoContent)
+}
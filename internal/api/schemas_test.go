@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/schema"
+)
+
+func TestPostJobsValidatesSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := schema.NewRegistry(nil, rediskeys.Keys{})
+	if err := registry.Put(context.Background(), "email.send", []byte(`{
+	  "type": "object",
+	  "required": ["to"],
+	  "properties": {"to": {"type": "string", "pattern": "@"}, "cc": {"type": "array", "items": {"type": "string"}}}
+	}`)); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	r := NewRouter(store, producer, WithSchemas(registry, nil))
+
+	w := postTypedJob(r, `{"idempotency_key":"k1","type":"email.send","payload":{"to":"nobody","cc":[1]}}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d body = %s", w.Code, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Error != ErrPayloadInvalid || len(resp.Fields) != 2 || resp.Fields[0].Path != "/cc/0" || resp.Fields[1].Path != "/to" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if store.getCalls != 0 || store.createCalled || producer.publishCalled {
+		t.Fatalf("invalid job reached the store or producer")
+	}
+
+	if w := postTypedJob(r, `{"idempotency_key":"k2","type":"email.send","payload":{"to":"a@b"}}`); w.Code != http.StatusCreated {
+		t.Fatalf("valid status = %d body = %s", w.Code, w.Body.String())
+	}
+	// Types without a schema, and untyped jobs, are not validated.
+	if w := postTypedJob(r, `{"idempotency_key":"k3","type":"other","payload":[1]}`); w.Code != http.StatusCreated {
+		t.Fatalf("unregistered status = %d", w.Code)
+	}
+}
+
+func schemaRequest(r http.Handler, method, path, apiKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(auth.HeaderAPIKey, apiKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminSchemas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fixed.json"), []byte(`{"type":"object"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	registry := schema.NewRegistry(nil, rediskeys.Keys{})
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatalf("load dir: %v", err)
+	}
+	r := NewRouter(&fakeStore{}, &fakeProducer{},
+		WithAuthenticators(auth.NewStaticKeys([]auth.APIKey{{ClientID: "ops", Key: "key-ops"}, {ClientID: "team-a", Key: "key-a"}})),
+		WithSchemas(registry, []string{"ops"}))
+
+	if w := schemaRequest(r, http.MethodPut, "/admin/schemas/report", "key-a", `{}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin status = %d", w.Code)
+	}
+	w := schemaRequest(r, http.MethodPut, "/admin/schemas/report", "key-ops", `{"type":"object","uniqueKeys":true}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "uniqueKeys") {
+		t.Fatalf("invalid schema status = %d body = %s", w.Code, w.Body.String())
+	}
+	if w := schemaRequest(r, http.MethodPut, "/admin/schemas/report", "key-ops", `{"required":["id"]}`); w.Code != http.StatusOK {
+		t.Fatalf("put status = %d body = %s", w.Code, w.Body.String())
+	}
+	if w := schemaRequest(r, http.MethodPut, "/admin/schemas/fixed", "key-ops", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("file schema put status = %d", w.Code)
+	}
+	if w := postWithKey(r, "key-a", []byte(`{"idempotency_key":"k1","type":"report","payload":{}}`)); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("job status = %d", w.Code)
+	}
+
+	w = schemaRequest(r, http.MethodGet, "/admin/schemas", "key-ops", "")
+	var list []schema.Info
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].Type != "fixed" || list[1].Source != schema.SourceAdmin {
+		t.Fatalf("list = %+v, %v", list, err)
+	}
+	if w := schemaRequest(r, http.MethodDelete, "/admin/schemas/report", "key-ops", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	if w := schemaRequest(r, http.MethodGet, "/admin/schemas/report", "key-ops", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("get after delete status = %d", w.Code)
+	}
+}
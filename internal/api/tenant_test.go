@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"mq-redis/internal/auth"
+	"mq-redis/internal/metrics"
+	"mq-redis/internal/quota"
+	storeerr "mq-redis/internal/store"
+	"mq-redis/internal/tenant"
+)
+
+type fakeQuota struct {
+	decision      quota.Decision
+	err           error
+	reserveTenant string
+	reserveLimits tenant.Quota
+	released      []string
+}
+
+func (q *fakeQuota) Reserve(ctx context.Context, tenantID, jobID string, limits tenant.Quota) (quota.Decision, error) {
+	q.reserveTenant = tenantID
+	q.reserveLimits = limits
+	return q.decision, q.err
+}
+
+func (q *fakeQuota) Release(ctx context.Context, tenantID, jobID string) error {
+	q.released = append(q.released, jobID)
+	return nil
+}
+
+func newTenantRouter(store Store, producer Producer, q Quota, reg *metrics.Registry) *gin.Engine {
+	return NewRouter(store, producer,
+		WithAuthenticators(auth.NewStaticKeys([]auth.APIKey{{ClientID: "a-ci", Key: "key-a"}})),
+		WithTenants(tenant.NewRegistry(tenant.Config{Tenants: []tenant.Tenant{
+			{ID: "team-a", Clients: []string{"a-ci"}, Quota: &tenant.Quota{MaxQueued: 5, SubmitRate: 10}},
+		}})),
+		WithQuota(q),
+		WithMetrics(reg),
+	)
+}
+
+func postTenantJob(r *gin.Engine) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/jobs", bytes.NewReader([]byte(`{"idempotency_key":"k1","payload":{"a":1}}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderAPIKey, "key-a")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostJobs_TenantThreaded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	q := &fakeQuota{}
+	reg := metrics.NewRegistry()
+	w := postTenantJob(newTenantRouter(store, producer, q, reg))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if store.getTenant != "team-a" || store.createMeta.Tenant != "team-a" || producer.publishMeta.Tenant != "team-a" {
+		t.Fatalf("tenant not threaded: get=%q create=%q publish=%q", store.getTenant, store.createMeta.Tenant, producer.publishMeta.Tenant)
+	}
+	if q.reserveTenant != "team-a" || q.reserveLimits.MaxQueued != 5 {
+		t.Fatalf("reserve tenant=%q limits=%+v", q.reserveTenant, q.reserveLimits)
+	}
+	var buf bytes.Buffer
+	_ = reg.WriteText(&buf)
+	if !strings.Contains(buf.String(), `mq_api_jobs_submitted_total{tenant="team-a"} 1`) {
+		t.Fatalf("metrics = %s", buf.String())
+	}
+}
+
+func TestPostJobs_QuotaExceeded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	producer := &fakeProducer{}
+	reg := metrics.NewRegistry()
+	w := postTenantJob(newTenantRouter(store, producer, &fakeQuota{decision: quota.RejectedQueued}, reg))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(w.Body.String(), ErrQuotaExceeded) {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	if store.createCalled || producer.publishCalled {
+		t.Fatalf("did not expect job to be written")
+	}
+	var buf bytes.Buffer
+	_ = reg.WriteText(&buf)
+	if !strings.Contains(buf.String(), `mq_api_jobs_rejected_total{tenant="team-a",reason="quota_exceeded"} 1`) {
+		t.Fatalf("metrics = %s", buf.String())
+	}
+}
+
+func TestPostJobs_SubmitRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := postTenantJob(newTenantRouter(&fakeStore{}, &fakeProducer{}, &fakeQuota{decision: quota.RejectedRate}, metrics.NewRegistry()))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+}
+
+func TestPostJobs_QuotaFailOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{}
+	w := postTenantJob(newTenantRouter(store, &fakeProducer{}, &fakeQuota{err: errors.New("redis down")}, metrics.NewRegistry()))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if !store.createCalled {
+		t.Fatalf("expected CreateJob to be called")
+	}
+}
+
+func TestPostJobs_QuotaReleasedOnDuplicate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &fakeStore{
+		getResults: []getResult{{}, {jobID: "job-123", found: true}},
+		createErr:  storeerr.ErrAlreadyExists,
+	}
+	q := &fakeQuota{}
+	w := postTenantJob(newTenantRouter(store, &fakeProducer{}, q, metrics.NewRegistry()))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if len(q.released) != 1 || q.released[0] != store.createJobID {
+		t.Fatalf("released = %v, want [%s]", q.released, store.createJobID)
+	}
+}
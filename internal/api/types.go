@@ -1,10 +1,21 @@
 package api
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"mq-redis/internal/schema"
+)
 
 const MaxPayloadBytes = 256 * 1024
 
-const WarningDedupeDegraded = "dedupe_degraded"
+// RequestOverheadBytes is the room allowed for the JSON around an inline
+// payload when an authenticated request body is buffered.
+const RequestOverheadBytes = 16 * 1024
+
+const (
+	WarningDedupeDegraded = "dedupe_degraded"
+	WarningPublishPending = "publish_pending"
+)
 
 const (
 	ErrInvalidJSON        = "invalid_json"
@@ -18,10 +29,26 @@ const (
 	ErrStore              = "store_error"
 	ErrPublish            = "publish_failed"
 	ErrIDGeneration       = "id_generation_failed"
+	ErrUnauthorized       = "unauthorized"
+	ErrQuotaExceeded      = "quota_exceeded"
+	ErrRateLimited        = "rate_limited"
+	ErrRateLimiterDown    = "rate_limiter_unavailable"
+	ErrInvalidJobType     = "invalid_job_type"
+	ErrJobNotFound        = "job_not_found"
+	ErrLengthRequired     = "length_required"
+	ErrPayloadIncomplete  = "payload_incomplete"
+	ErrPayloadHash        = "payload_hash_mismatch"
+	ErrPayloadInvalid     = "payload_invalid"
+	ErrSchemaInvalid      = "schema_invalid"
+	ErrSchemaNotFound     = "schema_not_found"
+	ErrSchemaReadOnly     = "schema_read_only"
+	ErrForbidden          = "forbidden"
+	ErrBlobStore          = "blob_store_unavailable"
 )
 
 type JobRequest struct {
 	IdempotencyKey string          `json:"idempotency_key"`
+	Type           string          `json:"type,omitempty"`
 	Payload        json.RawMessage `json:"payload"`
 	PayloadRef     string          `json:"payload_ref,omitempty"`
 	PayloadSize    int64           `json:"payload_size,omitempty"`
@@ -34,6 +61,19 @@ type JobResponse struct {
 	Warning string `json:"warning,omitempty"`
 }
 
+// PayloadResponse is the ref triple POST /payloads returns, ready to be
+// copied into a JobRequest.
+type PayloadResponse struct {
+	PayloadRef  string `json:"payload_ref"`
+	PayloadSize int64  `json:"payload_size"`
+	PayloadHash string `json:"payload_hash"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Detail explains errors whose code alone is not actionable, such as a
+	// schema that does not compile.
+	Detail string `json:"detail,omitempty"`
+	// Fields lists the payload_invalid violations.
+	Fields []schema.FieldError `json:"fields,omitempty"`
 }
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticKeys(t *testing.T) {
+	a := NewStaticKeys([]APIKey{{ClientID: "team-a", Key: "secret-a"}})
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+	if _, ok, err := a.Authenticate(req, nil); ok || err != nil {
+		t.Fatalf("expected no credentials, ok=%v err=%v", ok, err)
+	}
+
+	req.Header.Set(HeaderAPIKey, "secret-a")
+	clientID, ok, err := a.Authenticate(req, nil)
+	if !ok || err != nil || clientID != "team-a" {
+		t.Fatalf("clientID=%q ok=%v err=%v", clientID, ok, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/jobs", nil)
+	req.Header.Set("Authorization", "Bearer secret-a")
+	if clientID, _, err := a.Authenticate(req, nil); err != nil || clientID != "team-a" {
+		t.Fatalf("bearer: clientID=%q err=%v", clientID, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, ok, err := a.Authenticate(req, nil); !ok || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized, ok=%v err=%v", ok, err)
+	}
+}
+
+func signedRequest(secret, clientID string, at time.Time, body []byte) *http.Request {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+	req.Header.Set(HeaderClientID, clientID)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Sign([]byte(secret), ts, http.MethodPost, "/jobs", body))
+	return req
+}
+
+func TestHMAC(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := NewHMAC([]HMACKey{{ClientID: "team-b", Secret: "s3cret"}}, time.Minute)
+	a.now = func() time.Time { return now }
+	body := []byte(`{"idempotency_key":"k1"}`)
+
+	clientID, ok, err := a.Authenticate(signedRequest("s3cret", "team-b", now, body), body)
+	if !ok || err != nil || clientID != "team-b" {
+		t.Fatalf("clientID=%q ok=%v err=%v", clientID, ok, err)
+	}
+
+	cases := map[string]*http.Request{
+		"tampered body": signedRequest("s3cret", "team-b", now, []byte(`{}`)),
+		"wrong secret":  signedRequest("other", "team-b", now, body),
+		"unknown":       signedRequest("s3cret", "team-x", now, body),
+		"stale":         signedRequest("s3cret", "team-b", now.Add(-2*time.Minute), body),
+	}
+	for name, req := range cases {
+		if _, ok, err := a.Authenticate(req, body); !ok || !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("%s: expected unauthorized, ok=%v err=%v", name, ok, err)
+		}
+	}
+}
+
+func TestHMACStreamedBody(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := NewHMAC([]HMACKey{{ClientID: "team-b", Secret: "s3cret"}}, time.Minute)
+	a.now = func() time.Time { return now }
+	digest := strings.Repeat("ab", 32)
+
+	req := httptest.NewRequest(http.MethodPost, "/payloads", nil)
+	req.Header.Set(HeaderClientID, "team-b")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, SignDigest([]byte("s3cret"), strconv.FormatInt(now.Unix(), 10), http.MethodPost, "/payloads", digest))
+	req.Header.Set(HeaderContentSHA256, digest)
+	if clientID, ok, err := a.Authenticate(req, nil); !ok || err != nil || clientID != "team-b" {
+		t.Fatalf("clientID=%q ok=%v err=%v", clientID, ok, err)
+	}
+
+	req.Header.Del(HeaderContentSHA256)
+	if _, ok, err := a.Authenticate(req, nil); !ok || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("missing digest: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{APIKeys: []APIKey{{ClientID: "a:b", Key: "k"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for ':' in client id")
+	}
+	cfg = Config{HMACKeys: []HMACKey{{ClientID: "a"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for missing secret")
+	}
+	cfg = Config{APIKeys: []APIKey{{ClientID: "a", Key: "k"}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(FromConfig(cfg)) != 1 {
+		t.Fatalf("expected one authenticator")
+	}
+}
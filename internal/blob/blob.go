@@ -0,0 +1,172 @@
+// Package blob resolves payload_ref payloads. A Resolver opens the object a
+// ref points to; Fetch reads it and verifies the declared size and hash
+// before the bytes reach a processor.
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"mq-redis/internal/payload"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+
+	DefaultMaxBytes = 100 << 20
+)
+
+var (
+	ErrNotFound        = errors.New("blob not found")
+	ErrInvalidRef      = errors.New("invalid payload ref")
+	ErrUnsupportedRef  = errors.New("payload ref not served by the configured blob backend")
+	ErrTooLarge        = errors.New("payload ref exceeds the size limit")
+	ErrSizeMismatch    = errors.New("blob size does not match payload_size")
+	ErrHashMismatch    = errors.New("blob hash does not match payload_hash")
+	ErrUnsupportedHash = errors.New("unsupported payload_hash algorithm")
+)
+
+// Permanent reports whether retrying the fetch cannot succeed: the ref is
+// malformed or foreign, the object is gone, or it is not what the submitter
+// declared. Other errors (network, 5xx) are worth a retry.
+func Permanent(err error) bool {
+	for _, target := range []error{ErrNotFound, ErrInvalidRef, ErrUnsupportedRef, ErrTooLarge, ErrSizeMismatch, ErrHashMismatch, ErrUnsupportedHash} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver opens the object a payload_ref points to.
+type Resolver interface {
+	Open(ctx context.Context, ref string) (io.ReadCloser, error)
+}
+
+// Store is a Resolver that also takes uploads, for POST /payloads.
+type Store interface {
+	Resolver
+	// Put streams exactly size bytes from body to key and returns the ref
+	// that resolves to it. A short or long body is ErrSizeMismatch and
+	// leaves no object behind.
+	Put(ctx context.Context, key string, body io.Reader, size int64) (string, error)
+	// Delete removes the object a ref points to; a missing object is not an
+	// error.
+	Delete(ctx context.Context, ref string) error
+	// Key returns the key ref names in this store, as passed to Put, or
+	// false for a ref the store does not hold.
+	Key(ref string) (string, bool)
+}
+
+// Config selects the backend. An empty backend disables resolution, and
+// processors receive the ref JSON as before.
+type Config struct {
+	Backend  string      `yaml:"backend"`
+	MaxBytes int64       `yaml:"max_bytes"`
+	Local    LocalConfig `yaml:"local"`
+	S3       S3Config    `yaml:"s3"`
+}
+
+// ValidateUploads additionally checks what POST /payloads needs: an S3
+// backend must name the bucket uploads go to.
+func (c Config) ValidateUploads() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.Backend == BackendS3 && c.S3.Bucket == "" {
+		return fmt.Errorf("blob.s3.bucket is required for payload uploads")
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("blob.max_bytes must not be negative")
+	}
+	switch c.Backend {
+	case "":
+		return nil
+	case BackendLocal:
+		return c.Local.validate()
+	case BackendS3:
+		return c.S3.validate()
+	default:
+		return fmt.Errorf("blob.backend %q is not one of local, s3", c.Backend)
+	}
+}
+
+// New builds the configured store; it returns nil when no backend is set.
+func New(cfg Config) (Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Backend {
+	case BackendLocal:
+		return NewLocal(cfg.Local.Root), nil
+	case BackendS3:
+		return NewS3(cfg.S3), nil
+	}
+	return nil, nil
+}
+
+// Fetch reads the referenced object and checks it against ref. It never
+// buffers more than ref.Size+1 bytes, and refuses refs above maxBytes before
+// opening them.
+func Fetch(ctx context.Context, r Resolver, ref payload.RefPayload, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if ref.Size <= 0 {
+		return nil, fmt.Errorf("%w: payload_size must be positive", ErrInvalidRef)
+	}
+	if ref.Size > maxBytes {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, ref.Size, maxBytes)
+	}
+	want, err := parseHash(ref.Hash)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := r.Open(ctx, ref.Ref)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	buf.Grow(int(ref.Size))
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(&buf, h), io.LimitReader(rc, ref.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("read blob: %w", err)
+	}
+	if n != ref.Size {
+		return nil, fmt.Errorf("%w: read %d bytes, declared %d", ErrSizeMismatch, n, ref.Size)
+	}
+	if !bytes.Equal(h.Sum(nil), want) {
+		return nil, ErrHashMismatch
+	}
+	return buf.Bytes(), nil
+}
+
+// parseHash accepts "sha256:<hex>" or a bare 64-character hex digest.
+func parseHash(s string) ([]byte, error) {
+	algo, digest, found := strings.Cut(strings.TrimSpace(s), ":")
+	if !found {
+		algo, digest = "sha256", algo
+	}
+	if !strings.EqualFold(algo, "sha256") {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedHash, algo)
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("%w: payload_hash is not a sha256 hex digest", ErrInvalidRef)
+	}
+	return sum, nil
+}
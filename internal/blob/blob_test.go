@@ -0,0 +1,203 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mq-redis/internal/payload"
+)
+
+type mapResolver map[string][]byte
+
+func (m mapResolver) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	data, ok := m[ref]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetchVerifiesSizeAndHash(t *testing.T) {
+	data := []byte(`{"big":true}`)
+	r := mapResolver{"mem://a": data}
+	ctx := context.Background()
+
+	for _, hash := range []string{"sha256:" + sha256Hex(data), sha256Hex(data)} {
+		got, err := Fetch(ctx, r, payload.RefPayload{Ref: "mem://a", Size: int64(len(data)), Hash: hash}, 0)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("Fetch(%s) = %q, %v", hash, got, err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		ref  payload.RefPayload
+		want error
+	}{
+		{"short", payload.RefPayload{Ref: "mem://a", Size: int64(len(data)) + 1, Hash: sha256Hex(data)}, ErrSizeMismatch},
+		{"long", payload.RefPayload{Ref: "mem://a", Size: int64(len(data)) - 1, Hash: sha256Hex(data)}, ErrSizeMismatch},
+		{"hash", payload.RefPayload{Ref: "mem://a", Size: int64(len(data)), Hash: sha256Hex([]byte("other"))}, ErrHashMismatch},
+		{"algorithm", payload.RefPayload{Ref: "mem://a", Size: int64(len(data)), Hash: "md5:abc"}, ErrUnsupportedHash},
+		{"bad digest", payload.RefPayload{Ref: "mem://a", Size: int64(len(data)), Hash: "sha256:zz"}, ErrInvalidRef},
+		{"missing", payload.RefPayload{Ref: "mem://b", Size: 1, Hash: sha256Hex(data)}, ErrNotFound},
+		{"too large", payload.RefPayload{Ref: "mem://a", Size: 1 << 20, Hash: sha256Hex(data)}, ErrTooLarge},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Fetch(ctx, r, tc.ref, 1024)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+			if !Permanent(err) {
+				t.Fatalf("%v should be permanent", err)
+			}
+		})
+	}
+	if Permanent(errors.New("connection reset")) {
+		t.Fatalf("network errors are not permanent")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"disabled", Config{}, true},
+		{"local", Config{Backend: BackendLocal, Local: LocalConfig{Root: "/var/lib/mq/blobs"}}, true},
+		{"local relative root", Config{Backend: BackendLocal, Local: LocalConfig{Root: "blobs"}}, false},
+		{"s3", Config{Backend: BackendS3, S3: S3Config{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1", AccessKeyID: "a", SecretAccessKey: "s"}}, true},
+		{"s3 without credentials", Config{Backend: BackendS3, S3: S3Config{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1"}}, false},
+		{"unknown backend", Config{Backend: "gcs"}, false},
+		{"negative max", Config{MaxBytes: -1}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+	if r, err := New(Config{}); r != nil || err != nil {
+		t.Fatalf("New(disabled) = %v, %v", r, err)
+	}
+	s3 := Config{Backend: BackendS3, S3: S3Config{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1", AccessKeyID: "a", SecretAccessKey: "s"}}
+	if err := s3.ValidateUploads(); err == nil {
+		t.Fatalf("expected uploads to require an s3 bucket")
+	}
+	s3.S3.Bucket = "payloads"
+	if err := s3.ValidateUploads(); err != nil {
+		t.Fatalf("ValidateUploads: %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "jobs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := filepath.Join(root, "jobs", "a.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	l := NewLocal(root)
+	ctx := context.Background()
+
+	rc, err := l.Open(ctx, "file://"+path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != `{"a":1}` {
+		t.Fatalf("data = %q", data)
+	}
+
+	cases := []struct {
+		ref  string
+		want error
+	}{
+		{"file://" + filepath.Join(root, "jobs", "missing.json"), ErrNotFound},
+		{"file://" + outside, ErrUnsupportedRef},
+		{"file://" + root + "/../" + filepath.Base(filepath.Dir(outside)) + "/secret", ErrUnsupportedRef},
+		{"file://" + root, ErrUnsupportedRef},
+		{"file://otherhost" + path, ErrInvalidRef},
+		{"s3://bucket/key", ErrUnsupportedRef},
+	}
+	for _, tc := range cases {
+		if _, err := l.Open(ctx, tc.ref); !errors.Is(err, tc.want) {
+			t.Fatalf("Open(%s) = %v, want %v", tc.ref, err, tc.want)
+		}
+	}
+}
+
+func TestLocalPutDelete(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root)
+	ctx := context.Background()
+
+	ref, err := l.Put(ctx, "uploads/team-a/1", strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if ref != "file://"+filepath.Join(root, "uploads", "team-a", "1") {
+		t.Fatalf("ref = %s", ref)
+	}
+	if key, ok := l.Key(ref); !ok || key != "uploads/team-a/1" {
+		t.Fatalf("Key = %q, %v", key, ok)
+	}
+	if key, ok := l.Key("file://" + root + "/uploads/team-a/../team-b/1"); !ok || key != "uploads/team-b/1" {
+		t.Fatalf("Key with dot segments = %q, %v", key, ok)
+	}
+	if _, ok := l.Key("s3://bucket/uploads/team-a/1"); ok {
+		t.Fatalf("expected a foreign ref to have no key")
+	}
+	got, err := Fetch(ctx, l, payload.RefPayload{Ref: ref, Size: 5, Hash: sha256Hex([]byte("hello"))}, 0)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("Fetch = %q, %v", got, err)
+	}
+
+	for _, body := range []string{"hi", "hello world"} {
+		if _, err := l.Put(ctx, "uploads/team-a/2", strings.NewReader(body), 5); !errors.Is(err, ErrSizeMismatch) {
+			t.Fatalf("Put(%q) err = %v", body, err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "uploads", "team-a")); len(entries) != 1 {
+		t.Fatalf("failed uploads left files behind: %v", entries)
+	}
+	if _, err := l.Put(ctx, "../escape", strings.NewReader("x"), 1); !errors.Is(err, ErrUnsupportedRef) {
+		t.Fatalf("escaping key err = %v", err)
+	}
+
+	if err := l.Delete(ctx, ref); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := l.Delete(ctx, ref); err != nil {
+		t.Fatalf("Delete missing: %v", err)
+	}
+	if _, err := l.Open(ctx, ref); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open after delete err = %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type LocalConfig struct {
+	Root string `yaml:"root"`
+}
+
+func (c LocalConfig) validate() error {
+	if strings.TrimSpace(c.Root) == "" {
+		return fmt.Errorf("blob.local.root is required")
+	}
+	if !filepath.IsAbs(c.Root) {
+		return fmt.Errorf("blob.local.root must be an absolute path")
+	}
+	return nil
+}
+
+// Local serves file:///<path> refs from a directory shared by the API and
+// the workers. Paths outside Root are refused, so a submitted ref cannot
+// read arbitrary files on the worker host.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: filepath.Clean(root)}
+}
+
+func (l *Local) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	path, err := l.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64) (string, error) {
+	ref := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(l.root, filepath.FromSlash(key)))}).String()
+	path, err := l.path(ref)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// Write beside the target and rename, so a reader never sees a partial
+	// object.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(body, size+1))
+	if err == nil && n != size {
+		err = fmt.Errorf("%w: received %d bytes, declared %d", ErrSizeMismatch, n, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+func (l *Local) Delete(ctx context.Context, ref string) error {
+	path, err := l.path(ref)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Key(ref string) (string, bool) {
+	path, err := l.path(ref)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (l *Local) path(ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidRef, err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedRef, ref)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("%w: file ref must not name a host", ErrInvalidRef)
+	}
+	path := filepath.Clean(filepath.FromSlash(u.Path))
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is outside the blob root", ErrUnsupportedRef, ref)
+	}
+	return path, nil
+}
@@ -0,0 +1,192 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// S3Config points at AWS S3 or any S3-compatible store (MinIO, Ceph RGW).
+// With PathStyle set objects are addressed as <endpoint>/<bucket>/<key>,
+// which most self-hosted stores need; otherwise as <bucket>.<endpoint host>.
+// Bucket, when set, is the only bucket refs may name.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" secret:"true"`
+	PathStyle       bool   `yaml:"path_style"`
+}
+
+func (c S3Config) validate() error {
+	if strings.TrimSpace(c.Endpoint) == "" {
+		return fmt.Errorf("blob.s3.endpoint is required")
+	}
+	if _, err := url.ParseRequestURI(c.Endpoint); err != nil {
+		return fmt.Errorf("blob.s3.endpoint: %v", err)
+	}
+	if c.Region == "" {
+		return fmt.Errorf("blob.s3.region is required")
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return fmt.Errorf("blob.s3.access_key_id and blob.s3.secret_access_key are required")
+	}
+	return nil
+}
+
+// S3 serves s3://<bucket>/<key> refs with SigV4-signed requests.
+type S3 struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3(cfg S3Config) *S3 {
+	return &S3{cfg: cfg, client: &http.Client{Timeout: 5 * time.Minute}, now: time.Now}
+}
+
+func (s *S3) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	bucket, key, err := s.parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, bucket, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	return nil, statusError(ref, resp)
+}
+
+// Put uploads into the configured bucket. The body is streamed with an
+// unsigned payload hash, so it is never buffered; the endpoint should be
+// https.
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64) (string, error) {
+	if s.cfg.Bucket == "" {
+		return "", fmt.Errorf("blob.s3.bucket is required for uploads")
+	}
+	ref := "s3://" + s.cfg.Bucket + "/" + key
+	counted := &countingReader{r: io.LimitReader(body, size)}
+	resp, err := s.do(ctx, http.MethodPut, s.cfg.Bucket, key, counted, size, UnsignedPayload)
+	if err != nil {
+		if counted.n < size {
+			return "", fmt.Errorf("%w: received %d bytes, declared %d: %v", ErrSizeMismatch, counted.n, size, err)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(ref, resp)
+	}
+	// Anything past size was not sent; a longer body is still a mismatch.
+	if extra, _ := body.Read(make([]byte, 1)); extra > 0 {
+		_ = s.Delete(ctx, ref)
+		return "", fmt.Errorf("%w: body longer than %d bytes", ErrSizeMismatch, size)
+	}
+	return ref, nil
+}
+
+func (s *S3) Delete(ctx context.Context, ref string) error {
+	bucket, key, err := s.parseRef(ref)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, bucket, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return statusError(ref, resp)
+}
+
+// Key cleans the key the same way Local does, so a ref cannot dodge a
+// prefix check with dot segments.
+func (s *S3) Key(ref string) (string, bool) {
+	_, key, err := s.parseRef(ref)
+	if err != nil {
+		return "", false
+	}
+	return path.Clean(key), true
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *S3) parseRef(ref string) (bucket, key string, err error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidRef, err)
+	}
+	if u.Scheme != "s3" {
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedRef, ref)
+	}
+	bucket, key = u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%w: want s3://<bucket>/<key>", ErrInvalidRef)
+	}
+	if s.cfg.Bucket != "" && bucket != s.cfg.Bucket {
+		return "", "", fmt.Errorf("%w: bucket %s is not %s", ErrUnsupportedRef, bucket, s.cfg.Bucket)
+	}
+	return bucket, key, nil
+}
+
+func (s *S3) objectURL(bucket, key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(s.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.PathStyle {
+		u.Path += "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	return u, nil
+}
+
+// do sends a signed request. body may be nil; size is its length and
+// payloadHash its hex SHA-256 or UnsignedPayload.
+func (s *S3) do(ctx context.Context, method, bucket, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u, err := s.objectURL(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		// S3 rejects chunked uploads, so the length has to be known.
+		req.ContentLength = size
+	}
+	signV4(req, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.Region, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+func statusError(ref string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	return fmt.Errorf("s3 %s: %s: %s", ref, resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,158 @@
+// Package compress encodes job payloads before they are written to
+// job:data:<id> and Kafka. The codec name travels in the job meta
+// (payload_encoding), so every reader can decode without configuration.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+
+	DefaultMinBytes = 4 << 10
+
+	// MaxDecodedBytes bounds what Decode will inflate, so a corrupt or
+	// hostile payload cannot exhaust worker memory.
+	MaxDecodedBytes = 16 << 20
+)
+
+var (
+	ErrUnknownCodec = errors.New("unknown payload encoding")
+	ErrCorrupt      = errors.New("payload does not decode")
+)
+
+// Config enables compression for payloads of at least MinBytes. An empty
+// codec stores payloads as submitted.
+type Config struct {
+	Codec    string `yaml:"codec"`
+	MinBytes int    `yaml:"min_bytes"`
+}
+
+func (c Config) Validate(field string) error {
+	switch c.Codec {
+	case "", Gzip, Zstd, Snappy:
+	default:
+		return fmt.Errorf("%s.codec %q is not one of gzip, zstd, snappy", field, c.Codec)
+	}
+	if c.MinBytes < 0 {
+		return fmt.Errorf("%s.min_bytes must not be negative", field)
+	}
+	return nil
+}
+
+// Encode compresses data with the configured codec and returns the codec
+// used. Payloads below the threshold, or that do not shrink, are returned
+// unchanged with an empty codec.
+func (c Config) Encode(data []byte) ([]byte, string, error) {
+	minBytes := c.MinBytes
+	if minBytes == 0 {
+		minBytes = DefaultMinBytes
+	}
+	if c.Codec == "" || len(data) < minBytes {
+		return data, "", nil
+	}
+	var out []byte
+	switch c.Codec {
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		out = buf.Bytes()
+	case Zstd:
+		out = zstdEncoder().EncodeAll(data, nil)
+	case Snappy:
+		out = snappy.Encode(nil, data)
+	default:
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownCodec, c.Codec)
+	}
+	if len(out) >= len(data) {
+		return data, "", nil
+	}
+	return out, c.Codec, nil
+}
+
+// Decode reverses Encode. An empty codec returns data unchanged.
+func Decode(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "":
+		return data, nil
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, MaxDecodedBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if len(out) > MaxDecodedBytes {
+			return nil, fmt.Errorf("%w: decodes to more than %d bytes", ErrCorrupt, MaxDecodedBytes)
+		}
+		return out, nil
+	case Zstd:
+		out, err := zstdDecoder().DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return out, nil
+	case Snappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if n > MaxDecodedBytes {
+			return nil, fmt.Errorf("%w: decodes to more than %d bytes", ErrCorrupt, MaxDecodedBytes)
+		}
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, codec)
+	}
+}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll/DecodeAll
+// and expensive to build, so one of each is shared.
+var (
+	zstdOnce sync.Once
+	zstdEnc  *zstd.Encoder
+	zstdDec  *zstd.Decoder
+)
+
+func initZstd() {
+	var err error
+	if zstdEnc, err = zstd.NewWriter(nil); err != nil {
+		panic(err)
+	}
+	if zstdDec, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecodedBytes)); err != nil {
+		panic(err)
+	}
+}
+
+func zstdEncoder() *zstd.Encoder {
+	zstdOnce.Do(initZstd)
+	return zstdEnc
+}
+
+func zstdDecoder() *zstd.Decoder {
+	zstdOnce.Do(initZstd)
+	return zstdDec
+}
@@ -0,0 +1,79 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(`{"items":"` + strings.Repeat("abcdefgh", 1024) + `"}`)
+	for _, codec := range []string{Gzip, Zstd, Snappy} {
+		t.Run(codec, func(t *testing.T) {
+			out, used, err := Config{Codec: codec}.Encode(data)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if used != codec || len(out) >= len(data) {
+				t.Fatalf("used = %q, %d -> %d bytes", used, len(data), len(out))
+			}
+			back, err := Decode(used, out)
+			if err != nil || !bytes.Equal(back, data) {
+				t.Fatalf("decode = %d bytes, %v", len(back), err)
+			}
+			if _, err := Decode(codec, []byte("not compressed")); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("corrupt input err = %v", err)
+			}
+		})
+	}
+}
+
+func TestEncodeSkips(t *testing.T) {
+	small := []byte(`{"a":1}`)
+	if out, used, _ := (Config{Codec: Zstd}).Encode(small); used != "" || !bytes.Equal(out, small) {
+		t.Fatalf("below threshold: used = %q", used)
+	}
+	if out, used, _ := (Config{}).Encode(bytes.Repeat([]byte("a"), 8192)); used != "" || len(out) != 8192 {
+		t.Fatalf("disabled: used = %q", used)
+	}
+	// Random-looking data does not shrink and is kept as is.
+	noise := make([]byte, 256)
+	for i := range noise {
+		noise[i] = byte(i*131 + i*i*7)
+	}
+	if _, used, _ := (Config{Codec: Gzip, MinBytes: 1}).Encode(noise); used != "" {
+		t.Fatalf("incompressible: used = %q", used)
+	}
+	if _, err := Decode("brotli", small); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("unknown codec err = %v", err)
+	}
+	if back, err := Decode("", small); err != nil || !bytes.Equal(back, small) {
+		t.Fatalf("identity decode = %q, %v", back, err)
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	huge := bytes.Repeat([]byte{'a'}, MaxDecodedBytes+1)
+	for _, codec := range []string{Gzip, Zstd, Snappy} {
+		out, used, err := Config{Codec: codec}.Encode(huge)
+		if err != nil || used != codec {
+			t.Fatalf("%s encode: %v", codec, err)
+		}
+		if _, err := Decode(codec, out); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("%s: oversized payload err = %v", codec, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{Codec: "lz4"}).Validate("api.compression"); err == nil {
+		t.Fatalf("expected unknown codec error")
+	}
+	if err := (Config{Codec: Zstd, MinBytes: -1}).Validate("api.compression"); err == nil {
+		t.Fatalf("expected negative threshold error")
+	}
+	if err := (Config{Codec: Snappy, MinBytes: 512}).Validate("api.compression"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
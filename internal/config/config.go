@@ -2,120 +2,389 @@ package config
 
 import (
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
 	yaml "github.com/goccy/go-yaml"
 
+	"mq-redis/internal/auth"
+	"mq-redis/internal/blob"
+	"mq-redis/internal/compress"
+	"mq-redis/internal/envelope"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/outbox"
 	"mq-redis/internal/postgres"
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/reconcile"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/retry"
 	"mq-redis/internal/saga"
+	"mq-redis/internal/schema"
+	"mq-redis/internal/tenant"
+	"mq-redis/internal/throttle"
+	"mq-redis/internal/upload"
+	"mq-redis/internal/worker"
 )
 
 type Config struct {
-	API             APIConfig       `yaml:"api"`
-	Worker          WorkerConfig    `yaml:"worker"`
-	RetryDispatcher RetryConfig     `yaml:"retry_dispatcher"`
-	Redis           RedisConfig     `yaml:"redis"`
-	Kafka           kafka.Config    `yaml:"kafka"`
-	Postgres        postgres.Config `yaml:"postgres"`
-	Saga            saga.Config     `yaml:"saga"`
+	API             APIConfig          `yaml:"api"`
+	Worker          WorkerConfig       `yaml:"worker"`
+	RetryDispatcher RetryConfig        `yaml:"retry_dispatcher"`
+	Redis           redisclient.Config `yaml:"redis"`
+	Kafka           kafka.Config       `yaml:"kafka"`
+	Postgres        postgres.Config    `yaml:"postgres"`
+	Blob            blob.Config        `yaml:"blob"`
+	Encryption      envelope.Config    `yaml:"encryption"`
+	Saga            saga.Config        `yaml:"saga"`
+	Tenancy         tenant.Config      `yaml:"tenancy"`
+	Reconciler      reconcile.Config   `yaml:"reconciler"`
+	Reload          ReloadConfig       `yaml:"reload"`
 }
 
 type APIConfig struct {
 	Addr string `yaml:"addr"`
+	// HealthAddr serves /metrics, whose per-tenant labels must not reach API
+	// clients, next to the health endpoints.
+	HealthAddr      string           `yaml:"health_addr"`
+	ShutdownTimeout time.Duration    `yaml:"shutdown_timeout"`
+	Auth            auth.Config      `yaml:"auth"`
+	RateLimit       ratelimit.Config `yaml:"rate_limit"`
+	Uploads         upload.Config    `yaml:"uploads"`
+	Compression     compress.Config  `yaml:"compression"`
+	Schemas         schema.Config    `yaml:"schemas"`
+	// AdminClients may read GET /admin/config.
+	AdminClients []string `yaml:"admin_clients"`
 }
 
 type WorkerConfig struct {
+	ID          string `yaml:"id"`
 	GroupID     string `yaml:"group_id"`
 	Concurrency int    `yaml:"concurrency"`
+	HealthAddr  string `yaml:"health_addr"`
+	// AdminAddr serves the unauthenticated /admin routes. Empty disables
+	// them; otherwise it must be a loopback address.
+	AdminAddr    string               `yaml:"admin_addr"`
+	DrainTimeout time.Duration        `yaml:"drain_timeout"`
+	LeaseTTL     time.Duration        `yaml:"lease_ttl"`
+	Throttle     throttle.Config      `yaml:"throttle"`
+	Breaker      worker.BreakerConfig `yaml:"breaker"`
+	Retry        retry.Config         `yaml:"retry"`
 }
 
 type RetryConfig struct {
 	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int64         `yaml:"batch_size"`
+	HealthAddr   string        `yaml:"health_addr"`
+	// AdminAddr serves the unauthenticated /admin routes, like
+	// worker.admin_addr.
+	AdminAddr string        `yaml:"admin_addr"`
+	Outbox    outbox.Config `yaml:"outbox"`
 }
 
-type RedisConfig struct {
-	Addr     string `yaml:"addr"`
-	Password string `yaml:"password"`
-	DB       int    `yaml:"db"`
-}
-
+// Load reads the file at path and applies MQ_* environment overrides on top.
 func Load(path string) (Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return Config{}, fmt.Errorf("read config: %w", err)
 	}
-	return Parse(data)
+	return parse(data, os.LookupEnv)
 }
 
+// Parse decodes data without consulting the environment. Secret <name>_file
+// keys are still resolved. Keys that match no field are an error.
 func Parse(data []byte) (Config, error) {
+	return parse(data, func(string) (string, bool) { return "", false })
+}
+
+func parse(data []byte, lookupEnv func(string) (string, bool)) (Config, error) {
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return Config{}, fmt.Errorf("unmarshal config: %w", err)
 	}
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Config{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if keys := unknownKeys(reflect.TypeOf(cfg), raw, ""); len(keys) > 0 {
+		return Config{}, unknownKeysError(keys)
+	}
+	if err := applySecretFiles(reflect.ValueOf(&cfg).Elem(), raw, ""); err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), EnvPrefix, lookupEnv); err != nil {
+		return Config{}, fmt.Errorf("config env: %w", err)
+	}
 	cfg.applyDefaults()
 	return cfg, nil
 }
 
+// Redacted returns a copy of c with every secret replaced by Redacted.
+func (c Config) Redacted() Config {
+	out := c
+	redact(reflect.ValueOf(&out).Elem())
+	return out
+}
+
+// PrintFlag makes a service print its effective config and exit instead of
+// starting.
+const PrintFlag = "--print-config"
+
+// PrintRequested reports whether args carry PrintFlag.
+func PrintRequested(args []string) bool {
+	return slices.Contains(args, PrintFlag)
+}
+
+// Print writes the effective config as YAML with secrets redacted.
+func Print(w io.Writer, c Config) error {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
 func (c *Config) applyDefaults() {
 	if strings.TrimSpace(c.API.Addr) == "" {
 		c.API.Addr = ":8080"
 	}
+	if strings.TrimSpace(c.API.HealthAddr) == "" {
+		c.API.HealthAddr = ":8083"
+	}
+	if c.API.ShutdownTimeout <= 0 {
+		c.API.ShutdownTimeout = 15 * time.Second
+	}
 	if strings.TrimSpace(c.Worker.GroupID) == "" {
 		c.Worker.GroupID = "mq-worker"
 	}
 	if c.Worker.Concurrency <= 0 {
 		c.Worker.Concurrency = 1
 	}
+	if strings.TrimSpace(c.Worker.HealthAddr) == "" {
+		c.Worker.HealthAddr = ":8081"
+	}
+	if c.Worker.DrainTimeout <= 0 {
+		c.Worker.DrainTimeout = 30 * time.Second
+	}
+	if c.Worker.LeaseTTL <= 0 {
+		c.Worker.LeaseTTL = 30 * time.Second
+	}
 	if c.RetryDispatcher.PollInterval <= 0 {
 		c.RetryDispatcher.PollInterval = 1 * time.Second
 	}
+	if c.RetryDispatcher.BatchSize <= 0 {
+		c.RetryDispatcher.BatchSize = 100
+	}
+	if strings.TrimSpace(c.RetryDispatcher.HealthAddr) == "" {
+		c.RetryDispatcher.HealthAddr = ":8082"
+	}
+	c.Worker.Retry = c.Worker.Retry.WithDefaults()
+	if c.Reload.Interval == 0 {
+		c.Reload.Interval = DefaultReloadInterval
+	}
+	c.Redis.ApplyDefaults()
 }
 
 func (c Config) ValidateForAPI() error {
 	if strings.TrimSpace(c.API.Addr) == "" {
 		return fmt.Errorf("api.addr is required")
 	}
+	if err := c.API.Auth.Validate(); err != nil {
+		return err
+	}
+	if err := c.API.RateLimit.Validate(); err != nil {
+		return err
+	}
+	if err := c.Tenancy.Validate(); err != nil {
+		return err
+	}
+	if err := c.API.Compression.Validate("api.compression"); err != nil {
+		return err
+	}
+	if err := c.Encryption.Validate(); err != nil {
+		return err
+	}
+	if err := c.API.Uploads.Validate(); err != nil {
+		return err
+	}
+	if err := c.Blob.ValidateUploads(); err != nil {
+		return err
+	}
+	if err := c.API.Schemas.Validate(); err != nil {
+		return err
+	}
+	// Schema admins are identified by client id, which anonymous requests
+	// do not have.
+	if len(c.API.Schemas.AdminClients) > 0 && !c.API.Auth.Enabled() {
+		return fmt.Errorf("api.schemas.admin_clients requires api.auth")
+	}
+	for i, id := range c.API.AdminClients {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("api.admin_clients[%d] must not be blank", i)
+		}
+	}
+	if len(c.API.AdminClients) > 0 && !c.API.Auth.Enabled() {
+		return fmt.Errorf("api.admin_clients requires api.auth")
+	}
+	if err := c.Reload.Validate(); err != nil {
+		return err
+	}
 	if err := validateRedis(c.Redis); err != nil {
 		return err
 	}
 	if err := c.Kafka.ValidateJobs(); err != nil {
 		return err
 	}
-	return nil
+	if err := c.validateShared(); err != nil {
+		return err
+	}
+	return validatePostgres(c.Postgres)
 }
 
 func (c Config) ValidateForWorker() error {
 	if strings.TrimSpace(c.Worker.GroupID) == "" {
 		return fmt.Errorf("worker.group_id is required")
 	}
+	if err := c.Worker.Throttle.Validate(); err != nil {
+		return err
+	}
+	if err := c.Worker.Breaker.Validate(); err != nil {
+		return err
+	}
+	if err := validateAdminAddr("worker.admin_addr", c.Worker.AdminAddr); err != nil {
+		return err
+	}
+	if err := c.Worker.Retry.Validate(); err != nil {
+		return fmt.Errorf("worker.retry: %w", err)
+	}
+	if err := c.Reload.Validate(); err != nil {
+		return err
+	}
+	if err := c.Blob.Validate(); err != nil {
+		return err
+	}
+	if err := c.Encryption.Validate(); err != nil {
+		return err
+	}
 	if err := validateRedis(c.Redis); err != nil {
 		return err
 	}
 	if err := c.Kafka.ValidateJobs(); err != nil {
 		return err
 	}
-	return nil
+	if err := c.validateShared(); err != nil {
+		return err
+	}
+	return validatePostgres(c.Postgres)
 }
 
 func (c Config) ValidateForRetryDispatcher() error {
 	if c.RetryDispatcher.PollInterval <= 0 {
 		return fmt.Errorf("retry_dispatcher.poll_interval is required")
 	}
+	if err := validateAdminAddr("retry_dispatcher.admin_addr", c.RetryDispatcher.AdminAddr); err != nil {
+		return err
+	}
+	if err := c.Reload.Validate(); err != nil {
+		return err
+	}
 	if err := validateRedis(c.Redis); err != nil {
 		return err
 	}
 	if err := c.Kafka.ValidateJobs(); err != nil {
 		return err
 	}
+	if err := c.validateShared(); err != nil {
+		return err
+	}
+	return validatePostgres(c.Postgres)
+}
+
+func (c Config) ValidateForReconciler() error {
+	if c.Reconciler.Interval < 0 {
+		return fmt.Errorf("reconciler.interval must not be negative")
+	}
+	return validateRedis(c.Redis)
+}
+
+// ValidateForAdmin covers mqctl, which only talks to Redis.
+func (c Config) ValidateForAdmin() error {
+	return validateRedis(c.Redis)
+}
+
+// RoleResult is the outcome of validating a config for one binary.
+type RoleResult struct {
+	Role  string `json:"role"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// ValidateRoles checks c for each binary that shares a config file: api,
+// worker and retry-dispatcher.
+func (c Config) ValidateRoles() []RoleResult {
+	roles := []struct {
+		name     string
+		validate func() error
+	}{
+		{"api", c.ValidateForAPI},
+		{"worker", c.ValidateForWorker},
+		{"retry-dispatcher", c.ValidateForRetryDispatcher},
+	}
+	results := make([]RoleResult, 0, len(roles))
+	for _, r := range roles {
+		res := RoleResult{Role: r.name, Valid: true}
+		if err := r.validate(); err != nil {
+			res.Valid, res.Error = false, err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// validateShared checks settings that span sections and matter to every
+// binary that touches jobs.
+func (c Config) validateShared() error {
+	for i, t := range c.Tenancy.Tenants {
+		if t.JobsTopic != "" && t.JobsTopic == c.Kafka.DLQTopic {
+			return fmt.Errorf("tenancy.tenants[%d].jobs_topic must differ from kafka.dlq_topic", i)
+		}
+	}
+	if c.Saga.Enabled && strings.TrimSpace(c.Postgres.DSN) == "" {
+		return fmt.Errorf("saga.enabled requires postgres.dsn")
+	}
 	return nil
 }
 
-func validateRedis(cfg RedisConfig) error {
-	if strings.TrimSpace(cfg.Addr) == "" {
-		return fmt.Errorf("redis.addr is required")
+// validateAdminAddr keeps the unauthenticated admin listeners off external
+// interfaces: the host must be localhost or a loopback IP.
+func validateAdminAddr(path, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%s must bind a loopback address such as 127.0.0.1:8091", path)
 	}
 	return nil
 }
+
+func validateRedis(cfg redisclient.Config) error {
+	return cfg.Validate()
+}
+
+// validatePostgres checks the optional postgres section only when a DSN is
+// configured; without one the binaries skip Postgres entirely.
+func validatePostgres(cfg postgres.Config) error {
+	if strings.TrimSpace(cfg.DSN) == "" {
+		return nil
+	}
+	return cfg.Validate()
+}
@@ -1,6 +1,12 @@
 package config
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mq-redis/internal/auth"
+)
 
 func TestParseDefaults(t *testing.T) {
 	cfg, err := Parse([]byte(`redis:
@@ -22,6 +28,30 @@ kafka:
 	if cfg.Worker.Concurrency != 1 {
 		t.Fatalf("worker.concurrency default = %d", cfg.Worker.Concurrency)
 	}
+	if cfg.API.ShutdownTimeout != 15*time.Second {
+		t.Fatalf("api.shutdown_timeout default = %v", cfg.API.ShutdownTimeout)
+	}
+	if cfg.Worker.DrainTimeout != 30*time.Second {
+		t.Fatalf("worker.drain_timeout default = %v", cfg.Worker.DrainTimeout)
+	}
+	if cfg.API.HealthAddr != ":8083" {
+		t.Fatalf("api.health_addr default = %q", cfg.API.HealthAddr)
+	}
+	if cfg.Worker.HealthAddr != ":8081" {
+		t.Fatalf("worker.health_addr default = %q", cfg.Worker.HealthAddr)
+	}
+	if cfg.RetryDispatcher.HealthAddr != ":8082" {
+		t.Fatalf("retry_dispatcher.health_addr default = %q", cfg.RetryDispatcher.HealthAddr)
+	}
+	if cfg.Worker.LeaseTTL != 30*time.Second {
+		t.Fatalf("worker.lease_ttl default = %v", cfg.Worker.LeaseTTL)
+	}
+	if cfg.Redis.Mode != "single" {
+		t.Fatalf("redis.mode default = %q", cfg.Redis.Mode)
+	}
+	if cfg.RetryDispatcher.BatchSize != 100 {
+		t.Fatalf("retry_dispatcher.batch_size default = %d", cfg.RetryDispatcher.BatchSize)
+	}
 	if err := cfg.ValidateForAPI(); err != nil {
 		t.Fatalf("validate for api: %v", err)
 	}
@@ -39,3 +69,363 @@ func TestValidateForAPIRequiresRedis(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestParseRedisCluster(t *testing.T) {
+	cfg, err := Parse([]byte(`redis:
+  mode: cluster
+  addrs: ["n1:7000", "n2:7000"]
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(cfg.Redis.Addrs) != 2 || cfg.Redis.HashTag != "mq" {
+		t.Fatalf("redis = %+v", cfg.Redis)
+	}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+	if cfg.Redis.Mode != "cluster" {
+		t.Fatalf("redis.mode = %q", cfg.Redis.Mode)
+	}
+}
+
+func TestParseSecurity(t *testing.T) {
+	cfg, err := Parse([]byte(`redis:
+  addr: "redis:6380"
+  username: "mq"
+  tls:
+    enabled: true
+    server_name: "redis.internal"
+kafka:
+  brokers: ["kafka:9093"]
+  jobs_topic: "jobs"
+  tls:
+    enabled: true
+  sasl:
+    mechanism: "scram-sha-512"
+    username: "mq"
+    password: "secret"
+postgres:
+  dsn: "postgres://mq@db:5432/mq"
+  sslmode: "verify-full"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !cfg.Redis.TLS.Enabled || cfg.Redis.TLS.ServerName != "redis.internal" || cfg.Redis.Username != "mq" {
+		t.Fatalf("redis = %+v", cfg.Redis)
+	}
+	if !cfg.Kafka.TLS.Enabled || cfg.Kafka.SASL.Mechanism != "scram-sha-512" || cfg.Kafka.SASL.Password != "secret" {
+		t.Fatalf("kafka = %+v", cfg.Kafka)
+	}
+	if err := cfg.ValidateForWorker(); err != nil {
+		t.Fatalf("validate for worker: %v", err)
+	}
+
+	cfg.Postgres.DSN = "postgres://mq@db:5432/mq?sslmode=disable"
+	if err := cfg.ValidateForAPI(); err == nil {
+		t.Fatalf("expected sslmode conflict")
+	}
+}
+
+func TestParseAPIAuth(t *testing.T) {
+	cfg, err := Parse([]byte(`api:
+  auth:
+    api_keys:
+      - client_id: "team-a"
+        key: "key-a"
+    hmac_keys:
+      - client_id: "team-b"
+        secret: "secret-b"
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !cfg.API.Auth.Enabled() {
+		t.Fatalf("expected auth to be enabled")
+	}
+	if cfg.API.Auth.APIKeys[0].ClientID != "team-a" || cfg.API.Auth.HMACKeys[0].Secret != "secret-b" {
+		t.Fatalf("auth = %+v", cfg.API.Auth)
+	}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+	cfg.API.Auth.APIKeys[0].Key = ""
+	if err := cfg.ValidateForAPI(); err == nil {
+		t.Fatalf("expected error for empty api key")
+	}
+}
+
+func TestParseAPISchemas(t *testing.T) {
+	cfg, err := Parse([]byte(`api:
+  schemas:
+    dir: "/etc/mq/schemas"
+    refresh_interval: 10s
+    admin_clients: ["ops"]
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.API.Schemas.Dir != "/etc/mq/schemas" || cfg.API.Schemas.RefreshInterval != 10*time.Second || cfg.API.Schemas.AdminClients[0] != "ops" {
+		t.Fatalf("schemas = %+v", cfg.API.Schemas)
+	}
+	if err := cfg.ValidateForAPI(); err == nil {
+		t.Fatalf("expected error for schema admins without auth")
+	}
+	cfg.API.Auth.APIKeys = []auth.APIKey{{ClientID: "ops", Key: "k"}}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+}
+
+func TestParseAPIRateLimit(t *testing.T) {
+	cfg, err := Parse([]byte(`api:
+  rate_limit:
+    failure_mode: closed
+    rules:
+      - name: per-type
+        by: [tenant, type]
+        match: {type: email}
+        rate: 2.5
+        burst: 5
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rl := cfg.API.RateLimit
+	if !rl.FailClosed() || len(rl.Rules) != 1 {
+		t.Fatalf("rate limit = %+v", rl)
+	}
+	if r := rl.Rules[0]; r.Rate != 2.5 || r.Burst != 5 || r.Match["type"] != "email" || len(r.By) != 2 {
+		t.Fatalf("rule = %+v", r)
+	}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+	cfg.API.RateLimit.Rules[0].Burst = 0
+	if err := cfg.ValidateForAPI(); err == nil {
+		t.Fatalf("expected error for zero burst")
+	}
+}
+
+func TestParseWorkerThrottle(t *testing.T) {
+	cfg, err := Parse([]byte(`worker:
+  breaker:
+    failure_threshold: 5
+    open_timeout: 45s
+  throttle:
+    defer_delay: 3s
+    types:
+      - type: email
+        max_concurrency: 2
+        rate: 5
+        burst: 10
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	th := cfg.Worker.Throttle
+	if th.DeferDelay != 3*time.Second || len(th.Types) != 1 || th.Types[0].MaxConcurrency != 2 || th.Types[0].Burst != 10 {
+		t.Fatalf("throttle = %+v", th)
+	}
+	if cfg.Worker.Breaker.FailureThreshold != 5 || cfg.Worker.Breaker.OpenTimeout != 45*time.Second {
+		t.Fatalf("breaker = %+v", cfg.Worker.Breaker)
+	}
+	if err := cfg.ValidateForWorker(); err != nil {
+		t.Fatalf("validate for worker: %v", err)
+	}
+	cfg.Worker.Throttle.Types = append(cfg.Worker.Throttle.Types, th.Types[0])
+	if err := cfg.ValidateForWorker(); err == nil {
+		t.Fatalf("expected error for duplicate type")
+	}
+}
+
+func TestParseBlob(t *testing.T) {
+	cfg, err := Parse([]byte(`api:
+  compression:
+    codec: zstd
+    min_bytes: 2048
+  uploads:
+    ttl: 6h
+worker:
+  group_id: "workers"
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+blob:
+  backend: s3
+  max_bytes: 1048576
+  s3:
+    endpoint: "http://minio:9000"
+    region: "us-east-1"
+    bucket: "payloads"
+    access_key_id: "minio"
+    secret_access_key: "minio-secret"
+    path_style: true
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Blob.Backend != "s3" || cfg.Blob.MaxBytes != 1<<20 || cfg.Blob.S3.Bucket != "payloads" || !cfg.Blob.S3.PathStyle {
+		t.Fatalf("blob = %+v", cfg.Blob)
+	}
+	if cfg.API.Uploads.TTL != 6*time.Hour {
+		t.Fatalf("uploads = %+v", cfg.API.Uploads)
+	}
+	if cfg.API.Compression.Codec != "zstd" || cfg.API.Compression.MinBytes != 2048 {
+		t.Fatalf("compression = %+v", cfg.API.Compression)
+	}
+	if err := cfg.ValidateForWorker(); err != nil {
+		t.Fatalf("validate for worker: %v", err)
+	}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+	cfg.Blob.S3.Bucket = ""
+	if err := cfg.ValidateForAPI(); err == nil {
+		t.Fatalf("expected uploads to require a bucket")
+	}
+	cfg.Blob.S3.SecretAccessKey = ""
+	if err := cfg.ValidateForWorker(); err == nil {
+		t.Fatalf("expected error for missing s3 credentials")
+	}
+}
+
+func TestParseReconciler(t *testing.T) {
+	cfg, err := Parse([]byte(`redis:
+  addr: "localhost:6379"
+reconciler:
+  processing_timeout: 20m
+  interval: 1m
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Reconciler.ProcessingTimeout != 20*time.Minute || cfg.Reconciler.Interval != time.Minute {
+		t.Fatalf("reconciler = %+v", cfg.Reconciler)
+	}
+	if err := cfg.ValidateForReconciler(); err != nil {
+		t.Fatalf("validate for reconciler: %v", err)
+	}
+}
+
+func TestParseTenancy(t *testing.T) {
+	cfg, err := Parse([]byte(`redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+tenancy:
+  default_quota:
+    max_queued: 100
+  tenants:
+    - id: "team-a"
+      clients: ["a-ci"]
+      jobs_topic: "jobs.team-a"
+      quota:
+        max_queued: 10
+        submit_rate: 5
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := cfg.ValidateForAPI(); err != nil {
+		t.Fatalf("validate for api: %v", err)
+	}
+	if cfg.Tenancy.DefaultQuota.MaxQueued != 100 {
+		t.Fatalf("default quota = %+v", cfg.Tenancy.DefaultQuota)
+	}
+	team := cfg.Tenancy.Tenants[0]
+	if team.ID != "team-a" || team.JobsTopic != "jobs.team-a" || team.Quota.SubmitRate != 5 {
+		t.Fatalf("tenant = %+v", team)
+	}
+}
+
+func TestValidateCrossField(t *testing.T) {
+	base := func() Config {
+		cfg, err := Parse([]byte(`redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+  dlq_topic: "jobs.dlq"
+tenancy:
+  tenants:
+    - id: "team-a"
+      clients: ["a-ci"]
+`))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		return cfg
+	}
+	if results := base().ValidateRoles(); !results[0].Valid || !results[1].Valid || !results[2].Valid {
+		t.Fatalf("base config results = %+v", results)
+	}
+
+	cases := map[string]struct {
+		mutate func(*Config)
+		want   string
+	}{
+		"retry max below base":    {func(c *Config) { c.Worker.Retry.Max = c.Worker.Retry.Base / 2 }, "worker.retry"},
+		"dlq is jobs topic":       {func(c *Config) { c.Kafka.DLQTopic = "jobs" }, "kafka.dlq_topic"},
+		"tenant topic is dlq":     {func(c *Config) { c.Tenancy.Tenants[0].JobsTopic = "jobs.dlq" }, "tenancy.tenants[0].jobs_topic"},
+		"saga without postgres":   {func(c *Config) { c.Saga.Enabled = true }, "saga.enabled requires postgres.dsn"},
+		"public worker admin":     {func(c *Config) { c.Worker.AdminAddr = ":8091" }, "worker.admin_addr"},
+		"public dispatcher admin": {func(c *Config) { c.RetryDispatcher.AdminAddr = "0.0.0.0:8092" }, "retry_dispatcher.admin_addr"},
+	}
+	for name, tc := range cases {
+		cfg := base()
+		tc.mutate(&cfg)
+		var failed []string
+		for _, r := range cfg.ValidateRoles() {
+			if !r.Valid {
+				failed = append(failed, r.Role)
+				if !strings.Contains(r.Error, tc.want) {
+					t.Fatalf("%s: %s error = %q, want %q", name, r.Role, r.Error, tc.want)
+				}
+			}
+		}
+		if len(failed) == 0 {
+			t.Fatalf("%s: no role rejected the config", name)
+		}
+	}
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+	for _, addr := range []string{"", "127.0.0.1:8091", "localhost:8091", "[::1]:8091"} {
+		if err := validateAdminAddr("worker.admin_addr", addr); err != nil {
+			t.Fatalf("%q: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{":8091", "0.0.0.0:8091", "10.0.0.5:8091", "admin.internal:8091", "127.0.0.1"} {
+		if err := validateAdminAddr("worker.admin_addr", addr); err == nil {
+			t.Fatalf("%q: expected error", addr)
+		}
+	}
+}
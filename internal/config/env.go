@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+// EnvPrefix starts every override: redis.addr is MQ_REDIS_ADDR and
+// api.auth.max_skew is MQ_API_AUTH_MAX_SKEW.
+const EnvPrefix = "MQ"
+
+// fileSuffix reads a secret from a file: password_file in YAML,
+// MQ_REDIS_PASSWORD_FILE in the environment.
+const fileSuffix = "_file"
+
+// Redacted replaces non-empty secrets in Print output.
+const Redacted = "[redacted]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is one yaml-tagged struct field.
+type field struct {
+	name   string
+	value  reflect.Value
+	secret bool
+}
+
+func fields(v reflect.Value) []field {
+	var out []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if !sf.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		out = append(out, field{name: name, value: v.Field(i), secret: sf.Tag.Get("secret") == "true"})
+	}
+	return out
+}
+
+// applySecretFiles resolves <name>_file keys next to secret fields, walking
+// the decoded struct alongside the raw YAML so list entries are covered too.
+func applySecretFiles(v reflect.Value, raw any, path string) error {
+	m, _ := raw.(map[string]any)
+	for _, f := range fields(v) {
+		fieldPath := joinPath(path, f.name)
+		switch {
+		case f.secret && f.value.Kind() == reflect.String:
+			file, ok := m[f.name+fileSuffix]
+			if !ok {
+				continue
+			}
+			filePath, isString := file.(string)
+			if !isString {
+				return fmt.Errorf("%s%s must be a path", fieldPath, fileSuffix)
+			}
+			if f.value.String() != "" {
+				return fmt.Errorf("set only one of %s and %s%s", fieldPath, fieldPath, fileSuffix)
+			}
+			secret, err := readSecret(filePath)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", fieldPath, fileSuffix, err)
+			}
+			f.value.SetString(secret)
+		case f.value.Kind() == reflect.Struct && f.value.Type() != durationType:
+			if err := applySecretFiles(f.value, m[f.name], fieldPath); err != nil {
+				return err
+			}
+		case f.value.Kind() == reflect.Slice && f.value.Type().Elem().Kind() == reflect.Struct:
+			list, _ := m[f.name].([]any)
+			for i := 0; i < f.value.Len() && i < len(list); i++ {
+				if err := applySecretFiles(f.value.Index(i), list[i], fmt.Sprintf("%s[%d]", fieldPath, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides fields from the environment. Scalars parse as their
+// type, []string takes a comma-separated list, and anything else (lists of
+// objects, maps) takes a YAML flow value such as
+// MQ_API_AUTH_API_KEYS='[{client_id: a, key_file: /run/secrets/a}]'.
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for _, f := range fields(v) {
+		name := prefix + "_" + strings.ToUpper(f.name)
+		if f.value.Kind() == reflect.Struct && f.value.Type() != durationType {
+			if err := applyEnv(f.value, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		val, set := lookup(name)
+		if f.secret && f.value.Kind() == reflect.String {
+			if filePath, ok := lookup(name + strings.ToUpper(fileSuffix)); ok {
+				if set {
+					return fmt.Errorf("set only one of %s and %s%s", name, name, strings.ToUpper(fileSuffix))
+				}
+				secret, err := readSecret(filePath)
+				if err != nil {
+					return fmt.Errorf("%s%s: %w", name, strings.ToUpper(fileSuffix), err)
+				}
+				val, set = secret, true
+			}
+		}
+		if !set {
+			continue
+		}
+		if err := setFromString(f.value, val); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(s), "[") {
+			var items []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(v.Type()))
+			return nil
+		}
+		return unmarshalInto(v, s)
+	case reflect.Map:
+		return unmarshalInto(v, s)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// unmarshalInto decodes a YAML value into v, checking keys and applying
+// <name>_file keys in list entries the same way the config file does.
+func unmarshalInto(v reflect.Value, s string) error {
+	ptr := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(s), ptr.Interface()); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct {
+		var raw []any
+		if err := yaml.Unmarshal([]byte(s), &raw); err != nil {
+			return err
+		}
+		if keys := unknownKeys(v.Type(), raw, ""); len(keys) > 0 {
+			return unknownKeysError(keys)
+		}
+		for i := 0; i < ptr.Elem().Len() && i < len(raw); i++ {
+			if err := applySecretFiles(ptr.Elem().Index(i), raw[i], fmt.Sprintf("[%d]", i)); err != nil {
+				return err
+			}
+		}
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// redact blanks every non-empty secret in place. Lists of structs are
+// copied first so the value v was copied from keeps its secrets.
+func redact(v reflect.Value) {
+	for _, f := range fields(v) {
+		switch {
+		case f.secret && f.value.Kind() == reflect.String:
+			if f.value.String() != "" {
+				f.value.SetString(Redacted)
+			}
+		case f.value.Kind() == reflect.Struct && f.value.Type() != durationType:
+			redact(f.value)
+		case f.value.Kind() == reflect.Slice && f.value.Type().Elem().Kind() == reflect.Struct:
+			if f.value.IsNil() {
+				continue
+			}
+			list := reflect.MakeSlice(f.value.Type(), f.value.Len(), f.value.Len())
+			reflect.Copy(list, f.value)
+			f.value.Set(list)
+			for i := 0; i < list.Len(); i++ {
+				redact(list.Index(i))
+			}
+		}
+	}
+}
+
+// readSecret trims the trailing newline most editors and secret mounts add.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", errors.New("secret file is empty")
+	}
+	return secret, nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const baseConfig = `api:
+  auth:
+    api_keys:
+      - client_id: "team-a"
+        key: "key-a"
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	path := writeFile(t, "config.yaml", baseConfig)
+	t.Setenv("MQ_REDIS_ADDR", "redis.internal:6379")
+	t.Setenv("MQ_REDIS_PASSWORD_FILE", writeFile(t, "redis-password", "s3cret\n"))
+	t.Setenv("MQ_WORKER_CONCURRENCY", "8")
+	t.Setenv("MQ_API_SHUTDOWN_TIMEOUT", "5s")
+	t.Setenv("MQ_KAFKA_BROKERS", "k1:9092, k2:9092")
+	t.Setenv("MQ_API_AUTH_API_KEYS", `[{client_id: ops, key_file: `+writeFile(t, "ops-key", "key-ops")+`}]`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Redis.Addr != "redis.internal:6379" || cfg.Redis.Password != "s3cret" {
+		t.Fatalf("redis = %q, %q", cfg.Redis.Addr, cfg.Redis.Password)
+	}
+	if cfg.Worker.Concurrency != 8 || cfg.API.ShutdownTimeout != 5*time.Second {
+		t.Fatalf("worker.concurrency = %d, api.shutdown_timeout = %v", cfg.Worker.Concurrency, cfg.API.ShutdownTimeout)
+	}
+	if !reflect.DeepEqual(cfg.Kafka.Brokers, []string{"k1:9092", "k2:9092"}) {
+		t.Fatalf("kafka.brokers = %v", cfg.Kafka.Brokers)
+	}
+	if len(cfg.API.Auth.APIKeys) != 1 || cfg.API.Auth.APIKeys[0].ClientID != "ops" || cfg.API.Auth.APIKeys[0].Key != "key-ops" {
+		t.Fatalf("api keys = %+v", cfg.API.Auth.APIKeys)
+	}
+	// Fields without an override keep the file's value; defaults still apply.
+	if cfg.Kafka.JobsTopic != "jobs" || cfg.API.Addr != ":8080" {
+		t.Fatalf("kafka.jobs_topic = %q, api.addr = %q", cfg.Kafka.JobsTopic, cfg.API.Addr)
+	}
+}
+
+func TestLoadEnvRejects(t *testing.T) {
+	path := writeFile(t, "config.yaml", baseConfig)
+	cases := map[string][2]string{
+		"bad int":       {"MQ_WORKER_CONCURRENCY", "many"},
+		"bad duration":  {"MQ_API_SHUTDOWN_TIMEOUT", "5"},
+		"missing file":  {"MQ_REDIS_PASSWORD_FILE", filepath.Join(t.TempDir(), "absent")},
+		"empty secret":  {"MQ_POSTGRES_DSN_FILE", writeFile(t, "dsn", "\n")},
+		"bad yaml list": {"MQ_API_AUTH_API_KEYS", "[{client_id"},
+	}
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), env[0]) {
+				t.Fatalf("err = %v, want one naming %s", err, env[0])
+			}
+		})
+	}
+
+	t.Setenv("MQ_REDIS_PASSWORD", "inline")
+	t.Setenv("MQ_REDIS_PASSWORD_FILE", writeFile(t, "redis-password", "s3cret"))
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected error when a secret and its file are both set")
+	}
+}
+
+func TestParseSecretFiles(t *testing.T) {
+	keyFile := writeFile(t, "key-a", "key-from-file\n")
+	dsnFile := writeFile(t, "dsn", "postgres://mq:pw@db/mq")
+	cfg, err := Parse([]byte(`api:
+  auth:
+    api_keys:
+      - client_id: "team-a"
+        key_file: "` + keyFile + `"
+      - client_id: "team-b"
+        key: "key-b"
+postgres:
+  dsn_file: "` + dsnFile + `"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.API.Auth.APIKeys[0].Key != "key-from-file" || cfg.API.Auth.APIKeys[1].Key != "key-b" {
+		t.Fatalf("api keys = %+v", cfg.API.Auth.APIKeys)
+	}
+	if cfg.Postgres.DSN != "postgres://mq:pw@db/mq" {
+		t.Fatalf("postgres.dsn = %q", cfg.Postgres.DSN)
+	}
+
+	_, err = Parse([]byte(`postgres:
+  dsn: "inline"
+  dsn_file: "` + dsnFile + `"
+`))
+	if err == nil || !strings.Contains(err.Error(), "postgres.dsn") {
+		t.Fatalf("both set err = %v", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, err := Parse([]byte(baseConfig + `postgres:
+  dsn: "postgres://mq:pw@db/mq"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, cfg); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"key-a", "pw@db"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("printed config leaks %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "team-a") || !strings.Contains(out, "localhost:6379") || !strings.Contains(out, Redacted) {
+		t.Fatalf("printed config:\n%s", out)
+	}
+	// Empty secrets stay empty so an unset password is visible as such.
+	if strings.Count(out, Redacted) != 2 {
+		t.Fatalf("redactions = %d:\n%s", strings.Count(out, Redacted), out)
+	}
+	if cfg.API.Auth.APIKeys[0].Key != "key-a" {
+		t.Fatalf("redaction modified the original config")
+	}
+	printed, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("printed config does not parse: %v", err)
+	}
+	if printed.Redis.Addr != cfg.Redis.Addr || printed.Worker.Concurrency != cfg.Worker.Concurrency {
+		t.Fatalf("printed config round trip = %+v", printed.Redis)
+	}
+}
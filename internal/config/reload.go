@@ -0,0 +1,287 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultReloadInterval is how often a Watcher checks the config file.
+const DefaultReloadInterval = 10 * time.Second
+
+// reloadable lists the YAML paths a Watcher applies at runtime. A change
+// anywhere else is logged and waits for a restart.
+var reloadable = []string{
+	"api.rate_limit",
+	"worker.retry",
+	"retry_dispatcher.poll_interval",
+	"retry_dispatcher.batch_size",
+}
+
+// Reloadable returns the YAML paths applied without a restart.
+func Reloadable() []string {
+	return slices.Clone(reloadable)
+}
+
+type ReloadConfig struct {
+	// Interval between checks of the config file for changes; SIGHUP
+	// triggers a check at any time.
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c ReloadConfig) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("reload.interval must be >= 0")
+	}
+	return nil
+}
+
+// Version describes the config a Watcher has applied. Version starts at 1
+// and grows with every applied change; Hash is the sha256 of the file it
+// came from. PendingRestart lists changed fields that were not applied.
+type Version struct {
+	Version        int64     `json:"version"`
+	Hash           string    `json:"hash"`
+	LoadedAt       time.Time `json:"loaded_at"`
+	PendingRestart []string  `json:"pending_restart,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// Watcher re-reads a config file and hands the reloadable part of each valid
+// change to its subscribers. The file is re-read through Load, so MQ_*
+// overrides and secret files keep applying.
+type Watcher struct {
+	path     string
+	validate func(Config) error
+	ignored  []string
+	now      func() time.Time
+
+	reloadMu sync.Mutex // serializes Reload, including subscriber calls
+	mu       sync.Mutex
+	cfg      Config
+	version  Version
+	seenHash string
+	subs     []func(Config)
+}
+
+type WatcherOption func(*Watcher)
+
+// WithIgnored drops changes under the given YAML paths, typically the
+// sections another binary reads, so they are neither applied nor reported
+// as pending a restart.
+func WithIgnored(paths ...string) WatcherOption {
+	return func(w *Watcher) {
+		w.ignored = append(w.ignored, paths...)
+	}
+}
+
+// NewWatcher watches path, starting from cfg as loaded from it. validate
+// checks every candidate config before it is applied; nil skips the check.
+func NewWatcher(path string, cfg Config, validate func(Config) error, opts ...WatcherOption) *Watcher {
+	w := &Watcher{path: path, cfg: cfg, validate: validate, now: time.Now}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		w.seenHash = digest(data)
+	}
+	w.version = Version{Version: 1, Hash: w.seenHash, LoadedAt: w.now()}
+	return w
+}
+
+// OnReload registers fn to receive the new config after each applied
+// change. Subscribers run one at a time, in registration order.
+func (w *Watcher) OnReload(fn func(Config)) {
+	w.mu.Lock()
+	w.subs = append(w.subs, fn)
+	w.mu.Unlock()
+}
+
+// Config returns the config currently applied.
+func (w *Watcher) Config() Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cfg
+}
+
+func (w *Watcher) Version() Version {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v := w.version
+	v.PendingRestart = slices.Clone(v.PendingRestart)
+	return v
+}
+
+// Reload reads the file and applies its reloadable changes. An unreadable or
+// invalid file is rejected as a whole and the current config stays active.
+func (w *Watcher) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return w.reject("", fmt.Errorf("read config: %w", err))
+	}
+	hash := digest(data)
+	loaded, err := parse(data, os.LookupEnv)
+	if err != nil {
+		return w.reject(hash, err)
+	}
+
+	w.mu.Lock()
+	current := w.cfg
+	w.mu.Unlock()
+	next := current
+	for _, path := range reloadable {
+		copyPath(reflect.ValueOf(&next).Elem(), reflect.ValueOf(loaded), path)
+	}
+	var applied, pending []string
+	for _, path := range diff(reflect.ValueOf(current), reflect.ValueOf(loaded), "") {
+		switch {
+		case under(path, w.ignored):
+		case under(path, reloadable):
+			applied = append(applied, path)
+		default:
+			pending = append(pending, path)
+		}
+	}
+	if w.validate != nil {
+		if err := w.validate(next); err != nil {
+			return w.reject(hash, fmt.Errorf("invalid config: %w", err))
+		}
+	}
+
+	w.mu.Lock()
+	w.seenHash = hash
+	w.version.LastError = ""
+	if !slices.Equal(pending, w.version.PendingRestart) && len(pending) > 0 {
+		log.Printf("config changes need a restart and were not applied: %s", strings.Join(pending, ", "))
+	}
+	w.version.PendingRestart = pending
+	if len(applied) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	w.cfg = next
+	w.version.Version++
+	w.version.Hash = hash
+	w.version.LoadedAt = w.now()
+	version := w.version.Version
+	subs := slices.Clone(w.subs)
+	w.mu.Unlock()
+
+	log.Printf("config reloaded version=%d changed=%s", version, strings.Join(applied, ", "))
+	for _, fn := range subs {
+		fn(next)
+	}
+	return nil
+}
+
+func (w *Watcher) reject(hash string, err error) error {
+	w.mu.Lock()
+	if hash != "" {
+		w.seenHash = hash
+	}
+	w.version.LastError = err.Error()
+	w.mu.Unlock()
+	log.Printf("config reload rejected; keeping version %d: %v", w.Version().Version, err)
+	return err
+}
+
+// Run checks the file every interval (DefaultReloadInterval when zero) and on
+// SIGHUP until ctx is cancelled. Polling reloads only when the file's
+// content changed; SIGHUP always reloads.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("config reload requested by SIGHUP")
+			_ = w.Reload()
+		case <-ticker.C:
+			if w.changed() {
+				_ = w.Reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) changed() bool {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		// Let Reload record the error once rather than on every tick.
+		return w.Version().LastError == ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return digest(data) != w.seenHash
+}
+
+// diff returns the YAML paths of the leaves that differ between a and b.
+// Lists and maps are compared as a whole.
+func diff(a, b reflect.Value, path string) []string {
+	if a.Kind() != reflect.Struct || a.Type() == durationType {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{path}
+	}
+	var out []string
+	fa, fb := fields(a), fields(b)
+	for i := range fa {
+		out = append(out, diff(fa[i].value, fb[i].value, joinPath(path, fa[i].name))...)
+	}
+	return out
+}
+
+// copyPath sets the field at the dotted YAML path in dst from src.
+func copyPath(dst, src reflect.Value, path string) {
+	for _, name := range strings.Split(path, ".") {
+		found := false
+		fd, fs := fields(dst), fields(src)
+		for i := range fd {
+			if fd[i].name == name {
+				dst, src, found = fd[i].value, fs[i].value, true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	dst.Set(src)
+}
+
+// under reports whether path equals or lies below one of roots.
+func under(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mq-redis/internal/ratelimit"
+)
+
+const reloadConfig = `api:
+  rate_limit:
+    rules:
+      - name: per-client
+        by: [client]
+        rate: 10
+        burst: 10
+worker:
+  retry:
+    base: 1s
+    max: 1m
+redis:
+  addr: "localhost:6379"
+kafka:
+  brokers: ["localhost:9092"]
+  jobs_topic: "jobs"
+`
+
+func newTestWatcher(t *testing.T, opts ...WatcherOption) (*Watcher, string) {
+	t.Helper()
+	path := writeFile(t, "config.yaml", reloadConfig)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return NewWatcher(path, cfg, Config.ValidateForWorker, opts...), path
+}
+
+func rewrite(t *testing.T, path string, replacements ...string) {
+	t.Helper()
+	data := strings.NewReplacer(replacements...).Replace(reloadConfig)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+}
+
+func TestWatcherAppliesReloadableChanges(t *testing.T) {
+	w, path := newTestWatcher(t)
+	var got []Config
+	w.OnReload(func(cfg Config) { got = append(got, cfg) })
+
+	rewrite(t, path, "rate: 10", "rate: 25", "max: 1m", "max: 5m", `["localhost:9092"]`, `["kafka-2:9092"]`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("subscriber calls = %d", len(got))
+	}
+	cfg := w.Config()
+	if cfg.API.RateLimit.Rules[0].Rate != 25 || cfg.Worker.Retry.Max != 5*time.Minute {
+		t.Fatalf("reloadable fields not applied: %+v %+v", cfg.API.RateLimit, cfg.Worker.Retry)
+	}
+	if !reflect.DeepEqual(cfg.Kafka.Brokers, []string{"localhost:9092"}) {
+		t.Fatalf("kafka.brokers changed at runtime: %v", cfg.Kafka.Brokers)
+	}
+	v := w.Version()
+	if v.Version != 2 || !reflect.DeepEqual(v.PendingRestart, []string{"kafka.brokers"}) || v.Hash == "" {
+		t.Fatalf("version = %+v", v)
+	}
+
+	// A change only to fields that need a restart applies nothing.
+	if err := w.Reload(); err != nil {
+		t.Fatalf("second reload: %v", err)
+	}
+	if len(got) != 1 || w.Version().Version != 2 {
+		t.Fatalf("unchanged file re-applied: calls=%d version=%+v", len(got), w.Version())
+	}
+}
+
+func TestWatcherRejectsInvalidConfig(t *testing.T) {
+	w, path := newTestWatcher(t)
+	w.OnReload(func(Config) { t.Fatalf("subscriber called for a rejected config") })
+
+	rewrite(t, path, "max: 1m", "max: 100ms")
+	if err := w.Reload(); err == nil || !strings.Contains(err.Error(), "worker.retry") {
+		t.Fatalf("reload err = %v", err)
+	}
+	rewrite(t, path, "rate: 10", "rate: [")
+	if err := w.Reload(); err == nil {
+		t.Fatalf("expected error for malformed file")
+	}
+	v := w.Version()
+	if v.Version != 1 || v.LastError == "" {
+		t.Fatalf("version = %+v", v)
+	}
+	if w.Config().Worker.Retry.Max != time.Minute {
+		t.Fatalf("rejected config applied: %+v", w.Config().Worker.Retry)
+	}
+}
+
+func TestWatcherIgnoresOtherSections(t *testing.T) {
+	w, path := newTestWatcher(t, WithIgnored("worker"))
+	rewrite(t, path, "max: 1m", "max: 5m", "jobs_topic: \"jobs\"", "jobs_topic: \"jobs-v2\"")
+	if err := w.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	v := w.Version()
+	if !reflect.DeepEqual(v.PendingRestart, []string{"kafka.jobs_topic"}) {
+		t.Fatalf("pending = %v", v.PendingRestart)
+	}
+}
+
+func TestWatcherRunPollsFile(t *testing.T) {
+	w, path := newTestWatcher(t)
+	applied := make(chan ratelimit.Config, 1)
+	w.OnReload(func(cfg Config) { applied <- cfg.API.RateLimit })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, 10*time.Millisecond)
+
+	rewrite(t, path, "rate: 10", "rate: 3")
+	select {
+	case rl := <-applied:
+		if rl.Rules[0].Rate != 3 {
+			t.Fatalf("applied rate = %v", rl.Rules[0].Rate)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("change was not picked up")
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// unknownKeys returns the YAML paths in raw that no field of t decodes,
+// e.g. retry_dispatcher.poll_intervall or api.auth.api_keys[1].kye. A
+// <name>_file key is known when <name> is a secret field. Map-typed fields
+// take arbitrary keys and are not descended into.
+func unknownKeys(t reflect.Type, raw any, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && t != durationType:
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return nil
+		}
+		known := make(map[string]reflect.Type)
+		secrets := make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+			if !sf.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			known[name] = sf.Type
+			secrets[name] = sf.Tag.Get("secret") == "true"
+		}
+		var out []string
+		for key, val := range m {
+			keyPath := joinPath(path, key)
+			if ft, ok := known[key]; ok {
+				out = append(out, unknownKeys(ft, val, keyPath)...)
+				continue
+			}
+			if name, ok := strings.CutSuffix(key, fileSuffix); ok && secrets[name] {
+				continue
+			}
+			out = append(out, keyPath)
+		}
+		slices.Sort(out)
+		return out
+	case t.Kind() == reflect.Slice:
+		list, ok := raw.([]any)
+		if !ok {
+			return nil
+		}
+		var out []string
+		for i, item := range list {
+			out = append(out, unknownKeys(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return out
+	}
+	return nil
+}
+
+func unknownKeysError(keys []string) error {
+	return fmt.Errorf("unknown config keys: %s", strings.Join(keys, ", "))
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte(`retry_dispatcher:
+  poll_intervall: 2s
+api:
+  auth:
+    api_keys:
+      - client_id: "team-a"
+        key: "key-a"
+      - client_id: "team-b"
+        kye: "key-b"
+redis:
+  addr: "localhost:6379"
+  addr_file: "/run/secrets/addr"
+tenancy:
+  tenants:
+    - id: "team-a"
+      quota:
+        max_queud: 5
+verbose: true
+`))
+	if err == nil {
+		t.Fatalf("expected error for unknown keys")
+	}
+	want := "unknown config keys: api.auth.api_keys[1].kye, redis.addr_file, retry_dispatcher.poll_intervall, tenancy.tenants[0].quota.max_queud, verbose"
+	if err.Error() != want {
+		t.Fatalf("err = %v\nwant  %s", err, want)
+	}
+}
+
+func TestParseAllowsSecretFilesAndMaps(t *testing.T) {
+	path := writeFile(t, "password", "s3cret")
+	cfg, err := Parse([]byte(`api:
+  rate_limit:
+    rules:
+      - name: email
+        by: [type]
+        rate: 1
+        burst: 1
+        match:
+          type: email
+redis:
+  addr: "localhost:6379"
+  password_file: "` + path + `"
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Redis.Password != "s3cret" || cfg.API.RateLimit.Rules[0].Match["type"] != "email" {
+		t.Fatalf("cfg = %+v %+v", cfg.Redis, cfg.API.RateLimit)
+	}
+}
+
+func TestLoadEnvRejectsUnknownKeys(t *testing.T) {
+	path := writeFile(t, "config.yaml", baseConfig)
+	t.Setenv("MQ_API_AUTH_API_KEYS", `[{client_id: ops, kye: x}]`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "[0].kye") {
+		t.Fatalf("err = %v", err)
+	}
+}
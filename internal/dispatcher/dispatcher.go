@@ -0,0 +1,193 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+)
+
+const DefaultBatchSize = 100
+
+type Publisher interface {
+	Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error
+}
+
+// claimScript removes up to ARGV[2] due jobs from retry:jobs and returns
+// them, so concurrent dispatchers never republish the same job.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #ids > 0 then
+	redis.call('ZREM', KEYS[1], unpack(ids))
+end
+return ids
+`)
+
+// Dispatcher moves due jobs from retry:jobs back onto Kafka, covering both
+// failed attempts and jobs deferred by worker limits.
+type Dispatcher struct {
+	redis     redis.UniversalClient
+	publisher Publisher
+	mu        sync.Mutex
+	interval  time.Duration
+	batch     int64
+	ttl       rediskeys.TTL
+	keys      rediskeys.Keys
+	now       func() time.Time
+}
+
+type Option func(*Dispatcher)
+
+// WithTTL sets the status and meta TTLs written when a job is requeued.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(d *Dispatcher) {
+		d.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(d *Dispatcher) {
+		d.keys = keys
+	}
+}
+
+func New(redisClient redis.UniversalClient, publisher Publisher, interval time.Duration, batch int64, opts ...Option) (*Dispatcher, error) {
+	if redisClient == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if publisher == nil {
+		return nil, errors.New("publisher is required")
+	}
+	if interval <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+	d := &Dispatcher{redis: redisClient, publisher: publisher, interval: interval, batch: batch, ttl: rediskeys.DefaultTTL(), now: time.Now}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
+}
+
+// Run dispatches due jobs every interval until ctx is cancelled. A full batch
+// is followed immediately by another pass to drain a backlog. Cancellation is
+// checked between batches only: claimed jobs are out of retry:jobs, so a batch
+// always finishes publishing or rescheduling them.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	interval, _ := d.settings()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		next, batch := d.settings()
+		if next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
+		n, err := d.dispatchDue(context.WithoutCancel(ctx), batch)
+		if err != nil {
+			log.Printf("retry dispatch error: %v", err)
+		}
+		if int64(n) == batch && err == nil && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update changes the poll interval and batch size from the next pass on.
+// Non-positive values keep the current setting.
+func (d *Dispatcher) Update(interval time.Duration, batch int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if interval > 0 {
+		d.interval = interval
+	}
+	if batch > 0 {
+		d.batch = batch
+	}
+}
+
+func (d *Dispatcher) settings() (time.Duration, int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.interval, d.batch
+}
+
+// DispatchDue claims one batch of due jobs and republishes them. Jobs that
+// cannot be published are put back one interval later.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	_, batch := d.settings()
+	return d.dispatchDue(ctx, batch)
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context, batch int64) (int, error) {
+	ids, err := claimScript.Run(ctx, d.redis, []string{d.keys.RetryJobsKey()}, d.now().UnixMilli(), batch).StringSlice()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := d.dispatch(ctx, id); err != nil {
+			log.Printf("retry dispatch failed job_id=%s: %v", id, err)
+			d.reschedule(ctx, id)
+		}
+	}
+	return len(ids), nil
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, jobID string) error {
+	status, err := d.redis.Get(ctx, d.keys.JobKey(jobID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if state.IsTerminal(state.State(status)) {
+		return nil
+	}
+	payload, err := d.redis.Get(ctx, d.keys.JobDataKey(jobID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		log.Printf("retry dispatch dropped job_id=%s: payload snapshot expired", jobID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields, err := d.redis.HGetAll(ctx, d.keys.JobMetaKey(jobID)).Result()
+	if err != nil {
+		return err
+	}
+	if err := d.publisher.Publish(ctx, jobID, payload, jobmeta.FromFields(fields)); err != nil {
+		return err
+	}
+	_, err = d.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, d.keys.JobKey(jobID), string(state.Queued), d.ttl.JobStatus)
+		pipe.HSet(ctx, d.keys.JobMetaKey(jobID), jobmeta.FieldUpdatedAt, jobmeta.FormatUpdatedAt(d.now()))
+		pipe.Expire(ctx, d.keys.JobMetaKey(jobID), d.ttl.JobData)
+		return nil
+	})
+	if err != nil {
+		log.Printf("status update failed: %v", err)
+	}
+	return nil
+}
+
+func (d *Dispatcher) reschedule(ctx context.Context, jobID string) {
+	interval, _ := d.settings()
+	score := float64(d.now().Add(interval).UnixMilli())
+	if err := d.redis.ZAdd(ctx, d.keys.RetryJobsKey(), redis.Z{Score: score, Member: jobID}).Err(); err != nil {
+		log.Printf("retry reschedule failed job_id=%s: %v", jobID, err)
+	}
+}
@@ -0,0 +1,142 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+type published struct {
+	jobID   string
+	payload string
+	meta    jobmeta.Meta
+}
+
+type fakePublisher struct {
+	msgs []published
+	err  error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, published{jobID: jobID, payload: string(payload), meta: meta})
+	return nil
+}
+
+func seedJob(t *testing.T, mr *miniredis.Miniredis, id, status string, score float64) {
+	t.Helper()
+	mr.Set(keys.JobKey(id), status)
+	mr.Set(keys.JobDataKey(id), `{"id":"`+id+`"}`)
+	mr.HSet(keys.JobMetaKey(id), jobmeta.FieldTenant, "team-a", jobmeta.FieldType, "email")
+	if _, err := mr.ZAdd(keys.RetryJobsKey(), score, id); err != nil {
+		t.Fatalf("zadd: %v", err)
+	}
+}
+
+func newDispatcher(t *testing.T, pub Publisher) (*Dispatcher, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	d, err := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), pub, time.Second, 10)
+	if err != nil {
+		t.Fatalf("new dispatcher: %v", err)
+	}
+	d.now = func() time.Time { return time.UnixMilli(5000) }
+	return d, mr
+}
+
+func TestDispatchDueRepublishes(t *testing.T) {
+	pub := &fakePublisher{}
+	d, mr := newDispatcher(t, pub)
+	seedJob(t, mr, "due", "retrying", 4000)
+	seedJob(t, mr, "later", "retrying", 9000)
+	seedJob(t, mr, "finished", "done", 1000)
+
+	n, err := d.DispatchDue(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if len(pub.msgs) != 1 {
+		t.Fatalf("published = %+v", pub.msgs)
+	}
+	msg := pub.msgs[0]
+	if msg.jobID != "due" || msg.payload != `{"id":"due"}` || msg.meta.Tenant != "team-a" || msg.meta.Type != "email" {
+		t.Fatalf("msg = %+v", msg)
+	}
+	if status, _ := mr.Get(keys.JobKey("due")); status != "queued" {
+		t.Fatalf("status = %q", status)
+	}
+	if members, _ := mr.ZMembers(keys.RetryJobsKey()); len(members) != 1 || members[0] != "later" {
+		t.Fatalf("remaining = %v", members)
+	}
+}
+
+func TestDispatchDueReschedulesOnPublishError(t *testing.T) {
+	d, mr := newDispatcher(t, &fakePublisher{err: errors.New("kafka down")})
+	seedJob(t, mr, "due", "retrying", 4000)
+
+	if _, err := d.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	score, err := mr.ZScore(keys.RetryJobsKey(), "due")
+	if err != nil || score != 6000 {
+		t.Fatalf("score=%v err=%v", score, err)
+	}
+	if status, _ := mr.Get(keys.JobKey("due")); status != "retrying" {
+		t.Fatalf("status = %q", status)
+	}
+}
+
+func TestDispatchDueUsesNamespace(t *testing.T) {
+	pub := &fakePublisher{}
+	d, mr := newDispatcher(t, pub)
+	staging := rediskeys.Keys{Namespace: "staging"}
+	WithKeys(staging)(d)
+	mr.Set(staging.JobKey("due"), "retrying")
+	mr.Set(staging.JobDataKey("due"), `{}`)
+	mr.ZAdd(staging.RetryJobsKey(), 4000, "due")
+	seedJob(t, mr, "other", "retrying", 4000)
+
+	n, err := d.DispatchDue(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if len(pub.msgs) != 1 || pub.msgs[0].jobID != "due" {
+		t.Fatalf("published = %+v", pub.msgs)
+	}
+	if status, _ := mr.Get("staging:job:due"); status != "queued" {
+		t.Fatalf("status = %q", status)
+	}
+	if status, _ := mr.Get(keys.JobKey("other")); status != "retrying" {
+		t.Fatalf("un-namespaced job status = %q", status)
+	}
+}
+
+func TestUpdateChangesBatchAndInterval(t *testing.T) {
+	d, mr := newDispatcher(t, &fakePublisher{err: errors.New("kafka down")})
+	for _, id := range []string{"a", "b", "c"} {
+		seedJob(t, mr, id, "retrying", 4000)
+	}
+	d.Update(5*time.Second, 2)
+	d.Update(0, 0)
+
+	n, err := d.DispatchDue(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if score, _ := mr.ZScore(keys.RetryJobsKey(), "a"); score != 10000 {
+		t.Fatalf("rescheduled score = %v, want 10000", score)
+	}
+}
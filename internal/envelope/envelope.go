@@ -0,0 +1,198 @@
+// Package envelope encrypts job payloads at rest. Each payload is sealed with
+// a fresh AES-256-GCM data key, and the data key is wrapped by a key-encryption
+// key (KEK) from a file-based keyring. The envelope names the KEK it was
+// wrapped with, so KEKs can be rotated while older jobs are still in flight.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+// Scheme is recorded as payload_encryption in the job meta.
+const Scheme = "aes-256-gcm"
+
+const (
+	version   = 1
+	keySize   = 32
+	nonceSize = 12
+	tagSize   = 16
+	// wrappedSize is a wrapped data key: nonce, key and GCM tag.
+	wrappedSize = nonceSize + keySize + tagSize
+)
+
+var (
+	// ErrUnknownKey means the envelope was wrapped with a KEK this keyring
+	// does not hold, e.g. during a rotation that has not reached every host.
+	ErrUnknownKey = errors.New("payload key-encryption key not in keyring")
+	ErrMalformed  = errors.New("malformed payload envelope")
+	ErrDecrypt    = errors.New("payload envelope does not authenticate")
+)
+
+// Config points at the keyring file. An empty path disables encryption.
+type Config struct {
+	KeyringFile string `yaml:"keyring_file"`
+}
+
+func (c Config) Validate() error {
+	if c.KeyringFile != "" && strings.TrimSpace(c.KeyringFile) == "" {
+		return fmt.Errorf("encryption.keyring_file must not be blank")
+	}
+	return nil
+}
+
+// New loads the configured keyring; it returns nil when encryption is off.
+func New(cfg Config) (*Keyring, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.KeyringFile == "" {
+		return nil, nil
+	}
+	return LoadKeyring(cfg.KeyringFile)
+}
+
+// keyringFile is the on-disk layout:
+//
+//	active: "2025-06"
+//	keys:
+//	  - id: "2025-06"
+//	    key: "<base64 of 32 random bytes>"
+//	  - id: "2025-01"
+//	    key: "..."
+type keyringFile struct {
+	Active string       `yaml:"active"`
+	Keys   []keyringKey `yaml:"keys"`
+}
+
+type keyringKey struct {
+	ID  string `yaml:"id"`
+	Key string `yaml:"key"`
+}
+
+// Keyring seals with the active KEK and opens with any KEK it holds.
+type Keyring struct {
+	active string
+	keks   map[string]cipher.AEAD
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+	return ParseKeyring(data)
+}
+
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var f keyringFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+	k := &Keyring{active: f.Active, keks: make(map[string]cipher.AEAD, len(f.Keys))}
+	for i, entry := range f.Keys {
+		if entry.ID == "" || len(entry.ID) > 255 {
+			return nil, fmt.Errorf("keyring keys[%d].id must be 1-255 bytes", i)
+		}
+		if _, dup := k.keks[entry.ID]; dup {
+			return nil, fmt.Errorf("keyring key %q is listed twice", entry.ID)
+		}
+		raw, err := base64.StdEncoding.DecodeString(entry.Key)
+		if err != nil || len(raw) != keySize {
+			return nil, fmt.Errorf("keyring key %q must be base64 of %d bytes", entry.ID, keySize)
+		}
+		aead, err := newGCM(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.keks[entry.ID] = aead
+	}
+	if _, ok := k.keks[f.Active]; !ok {
+		return nil, fmt.Errorf("keyring active key %q is not in keys", f.Active)
+	}
+	return k, nil
+}
+
+// ActiveKey is the id of the KEK new envelopes are wrapped with.
+func (k *Keyring) ActiveKey() string {
+	return k.active
+}
+
+// Seal encrypts plaintext into an envelope bound to aad (the job id), so a
+// snapshot cannot be moved to another job.
+//
+// Layout: version | len(kid) | kid | wrapped data key | nonce | ciphertext.
+func (k *Keyring) Seal(plaintext, aad []byte) ([]byte, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{version, byte(len(k.active))}, k.active...)
+
+	out := make([]byte, 0, len(header)+wrappedSize+nonceSize+len(plaintext)+tagSize)
+	out = append(out, header...)
+	wrapNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(wrapNonce); err != nil {
+		return nil, err
+	}
+	out = append(out, wrapNonce...)
+	out = k.keks[k.active].Seal(out, wrapNonce, dek, header)
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return data.Seal(out, nonce, plaintext, aad), nil
+}
+
+// Open reverses Seal with whichever KEK the envelope names.
+func (k *Keyring) Open(envelope, aad []byte) ([]byte, error) {
+	if len(envelope) < 2 || envelope[0] != version {
+		return nil, ErrMalformed
+	}
+	kidEnd := 2 + int(envelope[1])
+	if len(envelope) < kidEnd+wrappedSize+nonceSize+tagSize {
+		return nil, ErrMalformed
+	}
+	header, kid := envelope[:kidEnd], string(envelope[2:kidEnd])
+	kek, ok := k.keks[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	wrapped := envelope[kidEnd : kidEnd+wrappedSize]
+	dek, err := kek.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	body := envelope[kidEnd+wrappedSize:]
+	plaintext, err := data.Open(nil, body[:nonceSize], body[nonceSize:], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,120 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func keyring(t *testing.T, active string, keys map[string]string) *Keyring {
+	t.Helper()
+	doc := "active: " + active + "\nkeys:\n"
+	for id, key := range keys {
+		doc += "  - id: " + id + "\n    key: " + key + "\n"
+	}
+	k, err := ParseKeyring([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := keyring(t, "k1", map[string]string{"k1": newKey(t)})
+	plaintext := []byte(`{"ssn":"123-45-6789"}`)
+
+	sealed, err := k.Seal(plaintext, []byte("job1"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("123-45-6789")) {
+		t.Fatalf("plaintext visible in envelope")
+	}
+	other, _ := k.Seal(plaintext, []byte("job1"))
+	if bytes.Equal(sealed, other) {
+		t.Fatalf("two seals of the same payload are identical")
+	}
+	got, err := k.Open(sealed, []byte("job1"))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+
+	if _, err := k.Open(sealed, []byte("job2")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong job id err = %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := k.Open(tampered, []byte("job1")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("tampered err = %v", err)
+	}
+	if _, err := k.Open(plaintext, []byte("job1")); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("plaintext err = %v", err)
+	}
+	if _, err := k.Open(sealed[:20], []byte("job1")); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("truncated err = %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, newKeyB64 := newKey(t), newKey(t)
+	before := keyring(t, "2025-01", map[string]string{"2025-01": oldKey})
+	sealedOld, err := before.Seal([]byte("old"), nil)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	// The new KEK is added and made active; the old one stays for opening.
+	after := keyring(t, "2025-06", map[string]string{"2025-01": oldKey, "2025-06": newKeyB64})
+	if got, err := after.Open(sealedOld, nil); err != nil || string(got) != "old" {
+		t.Fatalf("open old envelope = %q, %v", got, err)
+	}
+	sealedNew, err := after.Seal([]byte("new"), nil)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, err := before.Open(sealedNew, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("host without the new KEK err = %v", err)
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	key := newKey(t)
+	cases := map[string]string{
+		"missing active": "active: k2\nkeys:\n  - id: k1\n    key: " + key + "\n",
+		"short key":      "active: k1\nkeys:\n  - id: k1\n    key: " + base64.StdEncoding.EncodeToString([]byte("short")) + "\n",
+		"duplicate":      "active: k1\nkeys:\n  - id: k1\n    key: " + key + "\n  - id: k1\n    key: " + key + "\n",
+		"no keys":        "active: k1\n",
+	}
+	for name, doc := range cases {
+		if _, err := ParseKeyring([]byte(doc)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if k, err := New(Config{}); k != nil || err != nil {
+		t.Fatalf("New(disabled) = %v, %v", k, err)
+	}
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+	if err := os.WriteFile(path, []byte("active: k1\nkeys:\n  - id: k1\n    key: "+newKey(t)+"\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	k, err := New(Config{KeyringFile: path})
+	if err != nil || k.ActiveKey() != "k1" {
+		t.Fatalf("New = %v, %v", k, err)
+	}
+}
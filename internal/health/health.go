@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Status string
+
+const (
+	StatusOK          Status = "ok"
+	StatusDegraded    Status = "degraded"
+	StatusUnavailable Status = "unavailable"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+// Check probes a single dependency. A failing critical check makes the
+// service not ready; a failing non-critical check only degrades it and
+// reports Warning, if set.
+type Check struct {
+	Name     string
+	Critical bool
+	Warning  string
+	Probe    func(ctx context.Context) error
+}
+
+type DependencyReport struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status       Status             `json:"status"`
+	Warnings     []string           `json:"warnings,omitempty"`
+	Dependencies []DependencyReport `json:"dependencies"`
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	now     func() time.Time
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{checks: checks, timeout: timeout, now: time.Now}
+}
+
+// Check runs all probes concurrently and aggregates them into one report.
+func (c *Checker) Check(ctx context.Context) Report {
+	deps := make([]DependencyReport, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			deps[i] = c.probe(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Dependencies: deps}
+	for i, dep := range deps {
+		if dep.Status == StatusOK {
+			continue
+		}
+		check := c.checks[i]
+		if check.Critical {
+			report.Status = StatusUnavailable
+			continue
+		}
+		if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+		if check.Warning != "" {
+			report.Warnings = append(report.Warnings, check.Warning)
+		}
+	}
+	return report
+}
+
+func (c *Checker) probe(ctx context.Context, check Check) DependencyReport {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Probe(ctx)
+	dep := DependencyReport{
+		Name:      check.Name,
+		Status:    StatusOK,
+		LatencyMS: float64(c.now().Sub(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		dep.Status = StatusDegraded
+		if check.Critical {
+			dep.Status = StatusUnavailable
+		}
+		dep.Error = err.Error()
+	}
+	return dep
+}
+
+// Register mounts /livez, /readyz and the legacy /healthz alias for liveness.
+func Register(r gin.IRoutes, checker *Checker) {
+	live := func(c *gin.Context) {
+		c.JSON(http.StatusOK, Report{Status: StatusOK, Dependencies: []DependencyReport{}})
+	}
+	r.GET("/livez", live)
+	r.GET("/healthz", live)
+	r.GET("/readyz", func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		code := http.StatusOK
+		if report.Status == StatusUnavailable {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, report)
+	})
+}
+
+// NewRouter builds a standalone router for services without an HTTP API.
+func NewRouter(checker *Checker) *gin.Engine {
+	r := gin.New()
+	Register(r, checker)
+	return r
+}
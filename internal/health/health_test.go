@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func fail(ctx context.Context) error { return errors.New("down") }
+
+func TestCheckAllOK(t *testing.T) {
+	checker := NewChecker(0, Check{Name: "redis", Critical: true, Probe: ok})
+	report := checker.Check(context.Background())
+	if report.Status != StatusOK {
+		t.Fatalf("status = %q", report.Status)
+	}
+	if len(report.Dependencies) != 1 || report.Dependencies[0].Name != "redis" {
+		t.Fatalf("dependencies = %+v", report.Dependencies)
+	}
+}
+
+func TestCheckNonCriticalDegrades(t *testing.T) {
+	checker := NewChecker(0,
+		Check{Name: "kafka", Critical: true, Probe: ok},
+		Check{Name: "redis", Warning: "dedupe_degraded", Probe: fail},
+	)
+	report := checker.Check(context.Background())
+	if report.Status != StatusDegraded {
+		t.Fatalf("status = %q", report.Status)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0] != "dedupe_degraded" {
+		t.Fatalf("warnings = %v", report.Warnings)
+	}
+	if report.Dependencies[1].Error != "down" {
+		t.Fatalf("error = %q", report.Dependencies[1].Error)
+	}
+}
+
+func TestCheckCriticalUnavailable(t *testing.T) {
+	checker := NewChecker(0,
+		Check{Name: "kafka", Critical: true, Probe: fail},
+		Check{Name: "redis", Probe: fail},
+	)
+	report := checker.Check(context.Background())
+	if report.Status != StatusUnavailable {
+		t.Fatalf("status = %q", report.Status)
+	}
+}
+
+func TestReadyzStatusCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name  string
+		check Check
+		code  int
+		want  Status
+	}{
+		{"ok", Check{Name: "kafka", Critical: true, Probe: ok}, http.StatusOK, StatusOK},
+		{"degraded", Check{Name: "redis", Probe: fail}, http.StatusOK, StatusDegraded},
+		{"unavailable", Check{Name: "kafka", Critical: true, Probe: fail}, http.StatusServiceUnavailable, StatusUnavailable},
+	}
+	for _, tc := range cases {
+		r := NewRouter(NewChecker(0, tc.check))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if w.Code != tc.code {
+			t.Fatalf("%s: code = %d, want %d", tc.name, w.Code, tc.code)
+		}
+		var report Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tc.name, err)
+		}
+		if report.Status != tc.want {
+			t.Fatalf("%s: status = %q, want %q", tc.name, report.Status, tc.want)
+		}
+	}
+}
+
+func TestLivezIgnoresDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRouter(NewChecker(0, Check{Name: "kafka", Critical: true, Probe: fail}))
+	for _, path := range []string{"/livez", "/healthz"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: code = %d", path, w.Code)
+		}
+	}
+}
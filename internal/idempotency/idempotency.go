@@ -63,3 +63,12 @@ func DecideDuplicate(found bool, err error) DuplicateDecision {
 	}
 	return DuplicateReturnExisting
 }
+
+// ScopedKey namespaces an idempotency key by client so two clients sending
+// the same key never share a job. Anonymous requests keep the raw key.
+func ScopedKey(clientID, key string) string {
+	if clientID == "" {
+		return key
+	}
+	return clientID + ":" + key
+}
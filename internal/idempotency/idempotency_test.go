@@ -64,3 +64,15 @@ func TestDecideDuplicate(t *testing.T) {
 		}
 	}
 }
+
+func TestScopedKey(t *testing.T) {
+	if got := ScopedKey("", "k1"); got != "k1" {
+		t.Fatalf("anonymous = %q", got)
+	}
+	if got := ScopedKey("team-a", "k1"); got != "team-a:k1" {
+		t.Fatalf("scoped = %q", got)
+	}
+	if ScopedKey("team-a", "k1") == ScopedKey("team-b", "k1") {
+		t.Fatalf("expected clients to get distinct keys")
+	}
+}
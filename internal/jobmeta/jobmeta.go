@@ -0,0 +1,89 @@
+package jobmeta
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	FieldClientID = "client_id"
+	FieldTenant   = "tenant"
+	FieldType     = "type"
+
+	// FieldPayloadRef marks a job whose payload is a payload_ref document
+	// the worker must resolve from the blob store. The API sets it, so an
+	// inline payload cannot pose as a ref.
+	FieldPayloadRef = "payload_ref"
+
+	// FieldPayloadEncoding names the codec (see internal/compress) the
+	// stored and published payload is compressed with; absent means raw.
+	FieldPayloadEncoding = "payload_encoding"
+
+	// FieldPayloadEncryption names the scheme (see internal/envelope) the
+	// payload is sealed with, after any compression; absent means plaintext.
+	FieldPayloadEncryption = "payload_encryption"
+
+	// FieldUpdatedAt records the last status change (unix ms) in
+	// job:meta:<id>. It is bookkeeping for the reconciler, not a header.
+	FieldUpdatedAt = "updated_at"
+)
+
+// Meta is the per-job context stored next to the payload snapshot in
+// job:meta:<id> and carried as Kafka message headers.
+type Meta struct {
+	ClientID          string
+	Tenant            string
+	Type              string
+	PayloadRef        bool
+	PayloadEncoding   string
+	PayloadEncryption string
+}
+
+// Fields returns the non-empty attributes as Redis hash fields; the same map
+// is used for Kafka headers.
+func (m Meta) Fields() map[string]string {
+	out := make(map[string]string)
+	if m.ClientID != "" {
+		out[FieldClientID] = m.ClientID
+	}
+	if m.Tenant != "" {
+		out[FieldTenant] = m.Tenant
+	}
+	if m.Type != "" {
+		out[FieldType] = m.Type
+	}
+	if m.PayloadRef {
+		out[FieldPayloadRef] = "1"
+	}
+	if m.PayloadEncoding != "" {
+		out[FieldPayloadEncoding] = m.PayloadEncoding
+	}
+	if m.PayloadEncryption != "" {
+		out[FieldPayloadEncryption] = m.PayloadEncryption
+	}
+	return out
+}
+
+func FromFields(fields map[string]string) Meta {
+	return Meta{
+		ClientID:          fields[FieldClientID],
+		Tenant:            fields[FieldTenant],
+		Type:              fields[FieldType],
+		PayloadRef:        fields[FieldPayloadRef] == "1",
+		PayloadEncoding:   fields[FieldPayloadEncoding],
+		PayloadEncryption: fields[FieldPayloadEncryption],
+	}
+}
+
+func FormatUpdatedAt(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// UpdatedAt parses FieldUpdatedAt; ok is false when it is missing or invalid.
+func UpdatedAt(fields map[string]string) (time.Time, bool) {
+	ms, err := strconv.ParseInt(fields[FieldUpdatedAt], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
@@ -0,0 +1,31 @@
+package jobmeta
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFieldsRoundTrip(t *testing.T) {
+	meta := Meta{ClientID: "a-ci", Tenant: "team-a", Type: "email", PayloadRef: true, PayloadEncoding: "zstd", PayloadEncryption: "aes-256-gcm"}
+	got := FromFields(meta.Fields())
+	if got != meta {
+		t.Fatalf("round trip = %+v, want %+v", got, meta)
+	}
+}
+
+func TestFieldsOmitsEmpty(t *testing.T) {
+	if fields := (Meta{}).Fields(); len(fields) != 0 {
+		t.Fatalf("fields = %v", fields)
+	}
+}
+
+func TestUpdatedAt(t *testing.T) {
+	at := time.UnixMilli(1_700_000_000_123)
+	got, ok := UpdatedAt(map[string]string{FieldUpdatedAt: FormatUpdatedAt(at)})
+	if !ok || !got.Equal(at) {
+		t.Fatalf("updated_at = %v ok=%v", got, ok)
+	}
+	if _, ok := UpdatedAt(map[string]string{}); ok {
+		t.Fatalf("expected missing updated_at")
+	}
+}
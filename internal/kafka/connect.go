@@ -4,15 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"time"
-
-	segkafka "github.com/segmentio/kafka-go"
 )
 
 type dialFunc func(ctx context.Context, network, address string) (io.Closer, error)
 
-func CheckConnectivity(ctx context.Context, brokers []string) error {
-	return checkConnectivity(ctx, brokers, defaultDialer())
+// CheckConnectivity dials the first broker with the configured TLS and SASL
+// settings, so a bad certificate or credential fails the check too.
+func CheckConnectivity(ctx context.Context, cfg Config) error {
+	dial, err := configDialer(cfg)
+	if err != nil {
+		return err
+	}
+	return checkConnectivity(ctx, cfg.Brokers, dial)
 }
 
 func checkConnectivity(ctx context.Context, brokers []string, dial dialFunc) error {
@@ -26,9 +29,12 @@ func checkConnectivity(ctx context.Context, brokers []string, dial dialFunc) err
 	return conn.Close()
 }
 
-func defaultDialer() dialFunc {
-	dialer := &segkafka.Dialer{Timeout: 2 * time.Second}
+func configDialer(cfg Config) (dialFunc, error) {
+	dialer, err := cfg.Dialer()
+	if err != nil {
+		return nil, err
+	}
 	return func(ctx context.Context, network, address string) (io.Closer, error) {
 		return dialer.DialContext(ctx, network, address)
-	}
+	}, nil
 }
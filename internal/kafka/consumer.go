@@ -3,39 +3,84 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	segkafka "github.com/segmentio/kafka-go"
 )
 
+type reader interface {
+	FetchMessage(ctx context.Context) (segkafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...segkafka.Message) error
+	Close() error
+}
+
+// KafkaGoConsumer fetches without auto-commit; offsets advance only when the
+// worker commits a handled message, so in-flight jobs are redelivered if the
+// process stops before finishing them.
 type KafkaGoConsumer struct {
-	reader *segkafka.Reader
+	reader reader
 }
 
-func NewKafkaGoConsumer(cfg Config, groupID string) (*KafkaGoConsumer, error) {
+// NewKafkaGoConsumer joins groupID on the jobs topic and on tenantTopics, the
+// per-tenant jobs_topic overrides the producers route to.
+func NewKafkaGoConsumer(cfg Config, groupID string, tenantTopics ...string) (*KafkaGoConsumer, error) {
 	if err := cfg.ValidateJobs(); err != nil {
 		return nil, err
 	}
 	if groupID == "" {
 		return nil, fmt.Errorf("groupID is required")
 	}
+	dialer, err := cfg.Dialer()
+	if err != nil {
+		return nil, err
+	}
 	reader := segkafka.NewReader(segkafka.ReaderConfig{
-		Brokers: cfg.Brokers,
-		Topic:   cfg.JobsTopic,
-		GroupID: groupID,
+		Brokers:     cfg.Brokers,
+		GroupTopics: ConsumerTopics(cfg.JobsTopic, tenantTopics),
+		GroupID:     groupID,
+		Dialer:      dialer,
 	})
 	return &KafkaGoConsumer{reader: reader}, nil
 }
 
+// ConsumerTopics is the sorted, de-duplicated set of topics a worker group
+// reads: the jobs topic plus every tenant override.
+func ConsumerTopics(jobsTopic string, tenantTopics []string) []string {
+	topics := []string{jobsTopic}
+	for _, topic := range tenantTopics {
+		if topic != "" && !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+func newKafkaGoConsumerWithReader(r reader) *KafkaGoConsumer {
+	return &KafkaGoConsumer{reader: r}
+}
+
 func (c *KafkaGoConsumer) Poll(ctx context.Context) (Message, error) {
-	msg, err := c.reader.ReadMessage(ctx)
+	msg, err := c.reader.FetchMessage(ctx)
 	if err != nil {
 		return Message{}, err
 	}
-	return Message{Key: string(msg.Key), Value: msg.Value}, nil
+	return Message{
+		Key:       string(msg.Key),
+		Value:     msg.Value,
+		Headers:   fromHeaders(msg.Headers),
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}, nil
 }
 
 func (c *KafkaGoConsumer) Commit(ctx context.Context, msg Message) error {
-	return nil
+	return c.reader.CommitMessages(ctx, segkafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
 }
 
 func (c *KafkaGoConsumer) Close() error {
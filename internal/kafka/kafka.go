@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"strings"
+
+	"mq-redis/internal/tlsconfig"
 )
 
 type Config struct {
-	Brokers   []string `yaml:"brokers"`
-	JobsTopic string   `yaml:"jobs_topic"`
-	DLQTopic  string   `yaml:"dlq_topic"`
-	ClientID  string   `yaml:"client_id"`
+	Brokers   []string         `yaml:"brokers"`
+	JobsTopic string           `yaml:"jobs_topic"`
+	DLQTopic  string           `yaml:"dlq_topic"`
+	ClientID  string           `yaml:"client_id"`
+	TLS       tlsconfig.Config `yaml:"tls"`
+	SASL      SASLConfig       `yaml:"sasl"`
+
+	// Compression is the producer's batch codec: none, gzip, snappy, lz4 or
+	// zstd. Consumers detect it per batch, so it can change at any time.
+	Compression string `yaml:"compression"`
 }
 
 func (c Config) ValidateJobs() error {
@@ -20,12 +28,26 @@ func (c Config) ValidateJobs() error {
 	if strings.TrimSpace(c.JobsTopic) == "" {
 		return fmt.Errorf("kafka.jobs_topic is required")
 	}
-	return nil
+	// A shared topic would feed dead-lettered jobs straight back to workers.
+	if c.DLQTopic == c.JobsTopic {
+		return fmt.Errorf("kafka.dlq_topic must differ from kafka.jobs_topic")
+	}
+	if _, err := c.writerCompression(); err != nil {
+		return err
+	}
+	return c.validateSecurity()
 }
 
 type Message struct {
-	Key   string
-	Value []byte
+	Key     string
+	Value   []byte
+	Headers map[string]string
+
+	// Topic, Partition and Offset identify a consumed message so it can be
+	// committed once handled. Producers ignore them.
+	Topic     string
+	Partition int
+	Offset    int64
 }
 
 type Producer interface {
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"io"
+	"slices"
 	"testing"
 
 	segkafka "github.com/segmentio/kafka-go"
+
+	"mq-redis/internal/tlsconfig"
 )
 
 type fakeCloser struct {
@@ -32,6 +35,29 @@ func (w *fakeWriter) Close() error {
 	return nil
 }
 
+type fakeReader struct {
+	fetch     []segkafka.Message
+	committed []segkafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (segkafka.Message, error) {
+	if len(r.fetch) == 0 {
+		return segkafka.Message{}, io.EOF
+	}
+	msg := r.fetch[0]
+	r.fetch = r.fetch[1:]
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...segkafka.Message) error {
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
 func TestValidateJobs(t *testing.T) {
 	cfg := Config{Brokers: []string{"b1"}, JobsTopic: "jobs"}
 	if err := cfg.ValidateJobs(); err != nil {
@@ -46,6 +72,29 @@ func TestValidateJobsMissing(t *testing.T) {
 	}
 }
 
+func TestValidateJobsDLQTopic(t *testing.T) {
+	cfg := Config{Brokers: []string{"b1"}, JobsTopic: "jobs", DLQTopic: "jobs"}
+	if err := cfg.ValidateJobs(); err == nil {
+		t.Fatalf("expected error for dlq topic equal to jobs topic")
+	}
+}
+
+func TestWriterCompression(t *testing.T) {
+	cfg := Config{Brokers: []string{"b1"}, JobsTopic: "jobs", Compression: "zstd"}
+	p, err := NewKafkaGoProducer(cfg)
+	if err != nil {
+		t.Fatalf("new producer: %v", err)
+	}
+	defer p.Close()
+	if got := p.writer.(*segkafka.Writer).Compression; got != segkafka.Zstd {
+		t.Fatalf("compression = %v", got)
+	}
+	cfg.Compression = "brotli"
+	if err := cfg.ValidateJobs(); err == nil {
+		t.Fatalf("expected error for unknown codec")
+	}
+}
+
 func TestCheckConnectivityNoBrokers(t *testing.T) {
 	if err := checkConnectivity(context.Background(), nil, func(ctx context.Context, network, address string) (io.Closer, error) {
 		return nil, nil
@@ -80,7 +129,7 @@ func TestCheckConnectivitySuccess(t *testing.T) {
 func TestKafkaGoProducerPublish(t *testing.T) {
 	w := &fakeWriter{}
 	p := newKafkaGoProducerWithWriter(w)
-	err := p.Publish(context.Background(), "topic", Message{Key: "k1", Value: []byte("v1")})
+	err := p.Publish(context.Background(), "topic", Message{Key: "k1", Value: []byte("v1"), Headers: map[string]string{"tenant": "team-a"}})
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -97,4 +146,102 @@ func TestKafkaGoProducerPublish(t *testing.T) {
 	if string(msg.Value) != "v1" {
 		t.Fatalf("value = %q", msg.Value)
 	}
+	if len(msg.Headers) != 1 || msg.Headers[0].Key != "tenant" || string(msg.Headers[0].Value) != "team-a" {
+		t.Fatalf("headers = %+v", msg.Headers)
+	}
+}
+
+func TestKafkaGoConsumerCommitsPolledOffset(t *testing.T) {
+	r := &fakeReader{fetch: []segkafka.Message{{Topic: "jobs", Partition: 2, Offset: 41, Key: []byte("job1"), Value: []byte("v1"), Headers: []segkafka.Header{{Key: "tenant", Value: []byte("team-a")}}}}}
+	c := newKafkaGoConsumerWithReader(r)
+	msg, err := c.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if msg.Key != "job1" || msg.Partition != 2 || msg.Offset != 41 || msg.Headers["tenant"] != "team-a" {
+		t.Fatalf("msg = %+v", msg)
+	}
+	if len(r.committed) != 0 {
+		t.Fatalf("expected no commit before handling")
+	}
+	if err := c.Commit(context.Background(), msg); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if len(r.committed) != 1 || r.committed[0].Offset != 41 || r.committed[0].Topic != "jobs" {
+		t.Fatalf("committed = %+v", r.committed)
+	}
+}
+
+func TestValidateJobsSecurity(t *testing.T) {
+	base := Config{Brokers: []string{"b1"}, JobsTopic: "jobs"}
+	cases := []struct {
+		name string
+		sasl SASLConfig
+		tls  tlsconfig.Config
+		ok   bool
+	}{
+		{"plain", SASLConfig{Mechanism: "plain", Username: "u", Password: "p"}, tlsconfig.Config{}, true},
+		{"scram upper case", SASLConfig{Mechanism: "SCRAM-SHA-512", Username: "u", Password: "p"}, tlsconfig.Config{Enabled: true}, true},
+		{"unknown mechanism", SASLConfig{Mechanism: "gssapi", Username: "u"}, tlsconfig.Config{}, false},
+		{"missing username", SASLConfig{Mechanism: "plain"}, tlsconfig.Config{}, false},
+		{"cert without key", SASLConfig{}, tlsconfig.Config{Enabled: true, CertFile: "c.pem"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := base
+			cfg.SASL, cfg.TLS = tc.sasl, tc.tls
+			err := cfg.ValidateJobs()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestDialerCarriesSecurity(t *testing.T) {
+	cfg := Config{
+		ClientID: "mq",
+		TLS:      tlsconfig.Config{Enabled: true, ServerName: "kafka.internal"},
+		SASL:     SASLConfig{Mechanism: SASLScramSHA256, Username: "u", Password: "p"},
+	}
+	d, err := cfg.Dialer()
+	if err != nil {
+		t.Fatalf("Dialer: %v", err)
+	}
+	if d.TLS == nil || d.TLS.ServerName != "kafka.internal" || d.ClientID != "mq" {
+		t.Fatalf("dialer = %+v", d)
+	}
+	if d.SASLMechanism == nil || d.SASLMechanism.Name() != "SCRAM-SHA-256" {
+		t.Fatalf("sasl mechanism = %v", d.SASLMechanism)
+	}
+	tr, err := cfg.Transport()
+	if err != nil {
+		t.Fatalf("Transport: %v", err)
+	}
+	if tr.TLS == nil || tr.TLS.ServerName != "kafka.internal" || tr.SASL == nil {
+		t.Fatalf("transport = %+v", tr)
+	}
+
+	plainCfg, err := Config{}.Dialer()
+	if err != nil || plainCfg.TLS != nil || plainCfg.SASLMechanism != nil {
+		t.Fatalf("plain dialer = %+v, %v", plainCfg, err)
+	}
+}
+
+func TestCheckConnectivityBadTLS(t *testing.T) {
+	cfg := Config{Brokers: []string{"b1"}, TLS: tlsconfig.Config{Enabled: true, CAFile: "/nonexistent/ca.pem"}}
+	if err := CheckConnectivity(context.Background(), cfg); err == nil {
+		t.Fatalf("expected tls error")
+	}
+}
+
+func TestConsumerTopics(t *testing.T) {
+	got := ConsumerTopics("jobs", []string{"jobs.team-b", "", "jobs", "jobs.team-a", "jobs.team-b"})
+	want := []string{"jobs", "jobs.team-a", "jobs.team-b"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ConsumerTopics() = %v, want %v", got, want)
+	}
 }
@@ -0,0 +1,409 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"maps"
+	"sync"
+
+	"mq-redis/internal/kafka"
+)
+
+const DefaultPartitions = 3
+
+var (
+	// ErrRebalanced is returned when committing a partition the consumer no
+	// longer owns; the message will be redelivered to the new owner.
+	ErrRebalanced = errors.New("partition not assigned to this consumer")
+	ErrClosed     = errors.New("consumer closed")
+)
+
+type partition struct {
+	messages []kafka.Message
+}
+
+type topic struct {
+	partitions []*partition
+	next       int
+}
+
+type groupKey struct {
+	group string
+	topic string
+}
+
+type group struct {
+	topic     string
+	members   []*Consumer
+	committed map[int]int64
+}
+
+// Broker is an in-process stand-in for Kafka. Topics are created on first use
+// with DefaultPartitions; keyed messages hash to a fixed partition, keyless
+// ones round-robin. Consumer groups split a topic's partitions among their
+// members and resume from the last committed offset after a rebalance, so
+// uncommitted messages are redelivered as they would be by a real broker.
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string]*topic
+	groups     map[groupKey]*group
+	publishErr error
+	changed    chan struct{}
+}
+
+type Option func(*Broker)
+
+// WithPartitions sets the partition count for auto-created topics.
+func WithPartitions(n int) Option {
+	return func(b *Broker) {
+		if n > 0 {
+			b.partitions = n
+		}
+	}
+}
+
+func New(opts ...Option) *Broker {
+	b := &Broker{
+		partitions: DefaultPartitions,
+		topics:     make(map[string]*topic),
+		groups:     make(map[groupKey]*group),
+		changed:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// CreateTopic creates a topic with an explicit partition count. It is a no-op
+// if the topic already exists.
+func (b *Broker) CreateTopic(name string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topicLocked(name, partitions)
+}
+
+func (b *Broker) topicLocked(name string, partitions int) *topic {
+	t, ok := b.topics[name]
+	if ok {
+		return t
+	}
+	if partitions <= 0 {
+		partitions = b.partitions
+	}
+	t = &topic{partitions: make([]*partition, partitions)}
+	for i := range t.partitions {
+		t.partitions[i] = &partition{}
+	}
+	b.topics[name] = t
+	return t
+}
+
+// notifyLocked wakes every blocked Poll.
+func (b *Broker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// SetPublishError makes every Publish fail with err until it is reset with
+// nil.
+func (b *Broker) SetPublishError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.publishErr = err
+}
+
+// Publish implements kafka.Producer.
+func (b *Broker) Publish(ctx context.Context, topicName string, msg kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.publishErr != nil {
+		return b.publishErr
+	}
+	t := b.topicLocked(topicName, 0)
+	idx := t.next % len(t.partitions)
+	if msg.Key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(msg.Key))
+		idx = int(h.Sum32() % uint32(len(t.partitions)))
+	} else {
+		t.next++
+	}
+	p := t.partitions[idx]
+	msg = clone(msg)
+	msg.Topic, msg.Partition, msg.Offset = topicName, idx, int64(len(p.messages))
+	p.messages = append(p.messages, msg)
+	b.notifyLocked()
+	return nil
+}
+
+// Messages returns everything published to a topic, partition by partition.
+func (b *Broker) Messages(topicName string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok {
+		return nil
+	}
+	var out []kafka.Message
+	for _, p := range t.partitions {
+		for _, msg := range p.messages {
+			out = append(out, clone(msg))
+		}
+	}
+	return out
+}
+
+func clone(msg kafka.Message) kafka.Message {
+	msg.Value = append([]byte(nil), msg.Value...)
+	msg.Headers = maps.Clone(msg.Headers)
+	return msg
+}
+
+// Lag is how many messages of a topic the group has not committed yet.
+func (b *Broker) Lag(groupID, topicName string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok {
+		return 0
+	}
+	var committed map[int]int64
+	if g, ok := b.groups[groupKey{groupID, topicName}]; ok {
+		committed = g.committed
+	}
+	var lag int64
+	for i, p := range t.partitions {
+		lag += int64(len(p.messages)) - committed[i]
+	}
+	return lag
+}
+
+// Committed returns the group's next offset to consume for a partition.
+func (b *Broker) Committed(groupID, topicName string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if g, ok := b.groups[groupKey{groupID, topicName}]; ok {
+		return g.committed[partition]
+	}
+	return 0
+}
+
+// Consumer joins a consumer group on a topic. Each join or Close rebalances
+// the group.
+func (b *Broker) Consumer(topicName, groupID string) *Consumer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topicLocked(topicName, 0)
+	key := groupKey{groupID, topicName}
+	g, ok := b.groups[key]
+	if !ok {
+		g = &group{topic: topicName, committed: make(map[int]int64)}
+		b.groups[key] = g
+	}
+	c := &Consumer{broker: b, key: key, positions: make(map[int]int64)}
+	g.members = append(g.members, c)
+	b.rebalanceLocked(g)
+	return c
+}
+
+// GroupConsumer joins a consumer group on several topics, like a kafka-go
+// reader with GroupTopics. Each topic is balanced on its own, as Kafka's
+// range assignor does.
+func (b *Broker) GroupConsumer(groupID string, topics ...string) *GroupConsumer {
+	g := &GroupConsumer{broker: b, members: make(map[string]*Consumer, len(topics))}
+	for _, name := range topics {
+		if _, ok := g.members[name]; ok {
+			continue
+		}
+		c := b.Consumer(name, groupID)
+		g.members[name] = c
+		g.order = append(g.order, c)
+	}
+	return g
+}
+
+// rebalanceLocked spreads partitions round-robin over the members in join
+// order and rewinds every member to the committed offsets, like an eager
+// Kafka rebalance.
+func (b *Broker) rebalanceLocked(g *group) {
+	t := b.topics[g.topic]
+	for _, m := range g.members {
+		clear(m.positions)
+	}
+	if len(g.members) > 0 {
+		for i := range t.partitions {
+			m := g.members[i%len(g.members)]
+			m.positions[i] = g.committed[i]
+		}
+	}
+	b.notifyLocked()
+}
+
+// Consumer implements kafka.Consumer against a Broker.
+type Consumer struct {
+	broker    *Broker
+	key       groupKey
+	positions map[int]int64
+	cursor    int
+	closed    bool
+}
+
+// Poll blocks until a message is available on one of the consumer's
+// partitions or ctx ends. Partitions are served round-robin.
+func (c *Consumer) Poll(ctx context.Context) (kafka.Message, error) {
+	b := c.broker
+	for {
+		b.mu.Lock()
+		if c.closed {
+			b.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		if msg, ok := c.nextLocked(); ok {
+			b.mu.Unlock()
+			return msg, nil
+		}
+		wait := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+func (c *Consumer) nextLocked() (kafka.Message, bool) {
+	t := c.broker.topics[c.key.topic]
+	n := len(t.partitions)
+	for i := range n {
+		idx := (c.cursor + i) % n
+		pos, ok := c.positions[idx]
+		if !ok {
+			continue
+		}
+		p := t.partitions[idx]
+		if pos >= int64(len(p.messages)) {
+			continue
+		}
+		c.positions[idx] = pos + 1
+		c.cursor = idx + 1
+		return clone(p.messages[pos]), true
+	}
+	return kafka.Message{}, false
+}
+
+// Commit marks msg and everything before it on its partition as consumed.
+// Committing an older offset than the group already has is a no-op.
+func (c *Consumer) Commit(ctx context.Context, msg kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if msg.Topic != c.key.topic {
+		return ErrRebalanced
+	}
+	if _, ok := c.positions[msg.Partition]; !ok {
+		return ErrRebalanced
+	}
+	g := b.groups[c.key]
+	if next := msg.Offset + 1; next > g.committed[msg.Partition] {
+		g.committed[msg.Partition] = next
+	}
+	return nil
+}
+
+// Close leaves the group; its partitions move to the remaining members and
+// resume from the committed offsets.
+func (c *Consumer) Close() error {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	g := b.groups[c.key]
+	for i, m := range g.members {
+		if m == c {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	clear(c.positions)
+	if len(g.members) > 0 {
+		b.rebalanceLocked(g)
+	} else {
+		b.notifyLocked()
+	}
+	return nil
+}
+
+// GroupConsumer implements kafka.Consumer over one Consumer per topic.
+type GroupConsumer struct {
+	broker  *Broker
+	members map[string]*Consumer
+	order   []*Consumer
+	cursor  int
+}
+
+// Poll blocks until a message is available on any of the topics or ctx ends.
+// Topics are served round-robin.
+func (g *GroupConsumer) Poll(ctx context.Context) (kafka.Message, error) {
+	b := g.broker
+	for {
+		b.mu.Lock()
+		open := false
+		for i := range g.order {
+			c := g.order[(g.cursor+i)%len(g.order)]
+			if c.closed {
+				continue
+			}
+			open = true
+			if msg, ok := c.nextLocked(); ok {
+				g.cursor = (g.cursor + i + 1) % len(g.order)
+				b.mu.Unlock()
+				return msg, nil
+			}
+		}
+		wait := b.changed
+		b.mu.Unlock()
+		if !open {
+			return kafka.Message{}, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+func (g *GroupConsumer) Commit(ctx context.Context, msg kafka.Message) error {
+	c, ok := g.members[msg.Topic]
+	if !ok {
+		return ErrRebalanced
+	}
+	return c.Commit(ctx, msg)
+}
+
+// Close leaves the group on every topic.
+func (g *GroupConsumer) Close() error {
+	for _, c := range g.order {
+		c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"mq-redis/internal/kafka"
+)
+
+var (
+	_ kafka.Producer = (*Broker)(nil)
+	_ kafka.Consumer = (*Consumer)(nil)
+	_ kafka.Consumer = (*GroupConsumer)(nil)
+)
+
+func publish(t *testing.T, b *Broker, topic string, keys ...string) {
+	t.Helper()
+	for _, k := range keys {
+		if err := b.Publish(context.Background(), topic, kafka.Message{Key: k, Value: []byte(k)}); err != nil {
+			t.Fatalf("publish %s: %v", k, err)
+		}
+	}
+}
+
+func poll(t *testing.T, c *Consumer) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := c.Poll(ctx)
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	return msg
+}
+
+func TestKeyedMessagesKeepPartitionOrder(t *testing.T) {
+	b := New(WithPartitions(4))
+	publish(t, b, "jobs", "a", "b", "a", "c", "a")
+
+	var partitionOfA = -1
+	var offsets []int64
+	for _, msg := range b.Messages("jobs") {
+		if msg.Key != "a" {
+			continue
+		}
+		if partitionOfA >= 0 && msg.Partition != partitionOfA {
+			t.Fatalf("key a spread over partitions %d and %d", partitionOfA, msg.Partition)
+		}
+		partitionOfA = msg.Partition
+		offsets = append(offsets, msg.Offset)
+	}
+	if len(offsets) != 3 || offsets[0] >= offsets[1] || offsets[1] >= offsets[2] {
+		t.Fatalf("offsets for key a = %v", offsets)
+	}
+}
+
+func TestGroupSplitsPartitions(t *testing.T) {
+	b := New(WithPartitions(2))
+	b.CreateTopic("jobs", 2)
+	c1 := b.Consumer("jobs", "g")
+	c2 := b.Consumer("jobs", "g")
+	other := b.Consumer("jobs", "other")
+
+	var keys []string
+	for i := range 20 {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	publish(t, b, "jobs", keys...)
+
+	seen := map[string]int{}
+	for range 20 {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		for _, c := range []*Consumer{c1, c2} {
+			if msg, err := c.Poll(ctx); err == nil {
+				seen[msg.Key]++
+			}
+		}
+		cancel()
+	}
+	if len(seen) != 20 {
+		t.Fatalf("group saw %d distinct keys, want 20", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Fatalf("key %s delivered %d times within one group", k, n)
+		}
+	}
+	if msg := poll(t, other); msg.Key == "" {
+		t.Fatalf("second group should get its own copy")
+	}
+}
+
+func TestUncommittedMessagesAreRedelivered(t *testing.T) {
+	b := New(WithPartitions(1))
+	publish(t, b, "jobs", "j1", "j2", "j3")
+
+	c1 := b.Consumer("jobs", "g")
+	first := poll(t, c1)
+	if err := c1.Commit(context.Background(), first); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	poll(t, c1) // j2 is handled but never committed
+	if lag := b.Lag("g", "jobs"); lag != 2 {
+		t.Fatalf("lag = %d, want 2", lag)
+	}
+
+	c2 := b.Consumer("jobs", "g")
+	c1.Close()
+	if _, err := c1.Poll(context.Background()); !errors.Is(err, io.EOF) {
+		t.Fatalf("poll after close = %v, want EOF", err)
+	}
+	msg := poll(t, c2)
+	if msg.Key != "j2" {
+		t.Fatalf("redelivered %q, want j2", msg.Key)
+	}
+	if err := c2.Commit(context.Background(), msg); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if got := b.Committed("g", "jobs", 0); got != 2 {
+		t.Fatalf("committed = %d, want 2", got)
+	}
+}
+
+func TestCommitAfterRebalanceFails(t *testing.T) {
+	b := New(WithPartitions(1))
+	publish(t, b, "jobs", "j1")
+	c1 := b.Consumer("jobs", "g")
+	msg := poll(t, c1)
+
+	// c2 joins; the single partition stays with c1 (round-robin by join
+	// order), so c1 may still commit.
+	c2 := b.Consumer("jobs", "g")
+	if err := c1.Commit(context.Background(), msg); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	c1.Close()
+	if err := c1.Commit(context.Background(), msg); !errors.Is(err, ErrClosed) {
+		t.Fatalf("commit after close = %v", err)
+	}
+	if err := c2.Commit(context.Background(), kafka.Message{Topic: "other", Partition: 0}); !errors.Is(err, ErrRebalanced) {
+		t.Fatalf("commit of foreign topic = %v", err)
+	}
+}
+
+func TestPollHonoursContextAndWakesOnPublish(t *testing.T) {
+	b := New()
+	c := b.Consumer("jobs", "g")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Poll(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("poll on empty topic = %v", err)
+	}
+
+	got := make(chan kafka.Message, 1)
+	go func() {
+		msg, _ := c.Poll(context.Background())
+		got <- msg
+	}()
+	time.Sleep(10 * time.Millisecond)
+	publish(t, b, "jobs", "late")
+	select {
+	case msg := <-got:
+		if msg.Key != "late" {
+			t.Fatalf("got %q", msg.Key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("poll did not wake on publish")
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	b := New()
+	down := errors.New("broker down")
+	b.SetPublishError(down)
+	if err := b.Publish(context.Background(), "jobs", kafka.Message{Key: "a"}); !errors.Is(err, down) {
+		t.Fatalf("publish = %v", err)
+	}
+	b.SetPublishError(nil)
+	publish(t, b, "jobs", "a")
+	if n := len(b.Messages("jobs")); n != 1 {
+		t.Fatalf("messages = %d", n)
+	}
+}
+
+func TestGroupConsumerReadsEveryTopic(t *testing.T) {
+	b := New(WithPartitions(1))
+	g := b.GroupConsumer("workers", "jobs", "jobs.team-a", "jobs")
+	publish(t, b, "jobs", "a")
+	publish(t, b, "jobs.team-a", "b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	seen := map[string]string{}
+	for range 2 {
+		msg, err := g.Poll(ctx)
+		if err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+		if err := g.Commit(ctx, msg); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		seen[msg.Key] = msg.Topic
+	}
+	if seen["a"] != "jobs" || seen["b"] != "jobs.team-a" {
+		t.Fatalf("seen = %v", seen)
+	}
+	if b.Lag("workers", "jobs") != 0 || b.Lag("workers", "jobs.team-a") != 0 {
+		t.Fatalf("lag after commit")
+	}
+	if err := g.Commit(ctx, kafka.Message{Topic: "other"}); !errors.Is(err, ErrRebalanced) {
+		t.Fatalf("commit on an unread topic = %v", err)
+	}
+
+	g.Close()
+	if _, err := g.Poll(ctx); err != io.EOF {
+		t.Fatalf("poll after close = %v", err)
+	}
+}
@@ -20,13 +20,40 @@ func NewKafkaGoProducer(cfg Config) (*KafkaGoProducer, error) {
 	if err := cfg.ValidateJobs(); err != nil {
 		return nil, err
 	}
+	transport, err := cfg.Transport()
+	if err != nil {
+		return nil, err
+	}
+	compression, err := cfg.writerCompression()
+	if err != nil {
+		return nil, err
+	}
 	w := &segkafka.Writer{
-		Addr:     segkafka.TCP(cfg.Brokers...),
-		Balancer: &segkafka.LeastBytes{},
+		Addr:        segkafka.TCP(cfg.Brokers...),
+		Balancer:    &segkafka.LeastBytes{},
+		Transport:   transport,
+		Compression: compression,
 	}
 	return &KafkaGoProducer{writer: w}, nil
 }
 
+func (c Config) writerCompression() (segkafka.Compression, error) {
+	switch c.Compression {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return segkafka.Gzip, nil
+	case "snappy":
+		return segkafka.Snappy, nil
+	case "lz4":
+		return segkafka.Lz4, nil
+	case "zstd":
+		return segkafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("kafka.compression %q is not one of none, gzip, snappy, lz4, zstd", c.Compression)
+	}
+}
+
 func newKafkaGoProducerWithWriter(w writer) *KafkaGoProducer {
 	return &KafkaGoProducer{writer: w}
 }
@@ -36,12 +63,35 @@ func (p *KafkaGoProducer) Publish(ctx context.Context, topic string, msg Message
 		return fmt.Errorf("kafka producer not configured")
 	}
 	return p.writer.WriteMessages(ctx, segkafka.Message{
-		Topic: topic,
-		Key:   []byte(msg.Key),
-		Value: msg.Value,
+		Topic:   topic,
+		Key:     []byte(msg.Key),
+		Value:   msg.Value,
+		Headers: toHeaders(msg.Headers),
 	})
 }
 
+func toHeaders(headers map[string]string) []segkafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]segkafka.Header, 0, len(headers))
+	for k, v := range headers {
+		out = append(out, segkafka.Header{Key: k, Value: []byte(v)})
+	}
+	return out
+}
+
+func fromHeaders(headers []segkafka.Header) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for _, h := range headers {
+		out[h.Key] = string(h.Value)
+	}
+	return out
+}
+
 func (p *KafkaGoProducer) Close() error {
 	if p == nil || p.writer == nil {
 		return nil
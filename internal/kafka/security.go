@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	segkafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+const dialTimeout = 2 * time.Second
+
+// SASLConfig authenticates to the brokers. An empty mechanism disables SASL.
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password" secret:"true"`
+}
+
+func (c SASLConfig) validate() error {
+	switch strings.ToLower(c.Mechanism) {
+	case "":
+		return nil
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+	default:
+		return fmt.Errorf("kafka.sasl.mechanism %q is not one of plain, scram-sha-256, scram-sha-512", c.Mechanism)
+	}
+	if c.Username == "" {
+		return fmt.Errorf("kafka.sasl.username is required")
+	}
+	return nil
+}
+
+func (c SASLConfig) mechanism() (sasl.Mechanism, error) {
+	switch strings.ToLower(c.Mechanism) {
+	case "":
+		return nil, nil
+	case SASLPlain:
+		return plain.Mechanism{Username: c.Username, Password: c.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, c.Username, c.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, c.Username, c.Password)
+	}
+	return nil, c.validate()
+}
+
+func (c Config) validateSecurity() error {
+	if err := c.TLS.Validate("kafka.tls"); err != nil {
+		return err
+	}
+	return c.SASL.validate()
+}
+
+// Dialer is used by consumers and connectivity checks.
+func (c Config) Dialer() (*segkafka.Dialer, error) {
+	tlsCfg, err := c.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("kafka tls: %w", err)
+	}
+	mech, err := c.SASL.mechanism()
+	if err != nil {
+		return nil, fmt.Errorf("kafka sasl: %w", err)
+	}
+	return &segkafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		ClientID:      c.ClientID,
+		TLS:           tlsCfg,
+		SASLMechanism: mech,
+	}, nil
+}
+
+// Transport is used by producers; it carries the same TLS and SASL settings
+// as Dialer.
+func (c Config) Transport() (*segkafka.Transport, error) {
+	d, err := c.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	return &segkafka.Transport{
+		DialTimeout: d.Timeout,
+		ClientID:    d.ClientID,
+		TLS:         d.TLS,
+		SASL:        d.SASLMechanism,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package loadgen
+
+import (
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"mq-redis/internal/api"
+	producermemory "mq-redis/internal/producer/memory"
+	"mq-redis/internal/state"
+	storememory "mq-redis/internal/store/memory"
+)
+
+// InProcess runs the API over the memory store and producer, with a stand-in
+// worker that marks each published job done after ProcessDelay. It lets the
+// generator run offline, without Redis or Kafka.
+type InProcess struct {
+	Store    *storememory.Store
+	Producer *producermemory.Producer
+
+	server *httptest.Server
+	delay  time.Duration
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+func NewInProcess(processDelay time.Duration, opts ...api.Option) *InProcess {
+	p := &InProcess{
+		Store:    storememory.New(),
+		Producer: producermemory.New(),
+		delay:    processDelay,
+		stop:     make(chan struct{}),
+	}
+	p.server = httptest.NewServer(api.NewRouter(p.Store, p.Producer, opts...))
+	p.done.Add(1)
+	go p.work()
+	return p
+}
+
+// Target returns an HTTPTarget pointed at the in-process API.
+func (p *InProcess) Target() *HTTPTarget {
+	return &HTTPTarget{BaseURL: p.server.URL, Client: p.server.Client()}
+}
+
+func (p *InProcess) Close() {
+	close(p.stop)
+	p.done.Wait()
+	p.server.Close()
+}
+
+func (p *InProcess) work() {
+	defer p.done.Done()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	seen := 0
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		published := p.Producer.Published()
+		for _, msg := range published[seen:] {
+			jobID := msg.JobID
+			time.AfterFunc(p.delay, func() { p.Store.SetStatus(jobID, state.Done) })
+		}
+		seen = len(published)
+	}
+}
@@ -0,0 +1,447 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mq-redis/internal/state"
+)
+
+const (
+	DefaultRate         = 100
+	DefaultDuration     = 10 * time.Second
+	DefaultConcurrency  = 16
+	DefaultWaitTimeout  = 30 * time.Second
+	DefaultPollInterval = 100 * time.Millisecond
+)
+
+// DefaultSizes is a webhook-like mix: mostly small bodies, a few large ones.
+var DefaultSizes = []Size{{Bytes: 256, Weight: 70}, {Bytes: 4 << 10, Weight: 25}, {Bytes: 64 << 10, Weight: 5}}
+
+type Size struct {
+	Bytes  int
+	Weight int
+}
+
+// ParseSizes reads a payload mix such as "256:70,4096:25,65536:5".
+func ParseSizes(s string) ([]Size, error) {
+	var out []Size
+	for _, part := range strings.Split(s, ",") {
+		bytesStr, weightStr, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			weightStr = "1"
+		}
+		b, err := strconv.Atoi(bytesStr)
+		if err != nil || b <= 0 {
+			return nil, fmt.Errorf("invalid payload size %q", part)
+		}
+		w, err := strconv.Atoi(weightStr)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid payload weight %q", part)
+		}
+		out = append(out, Size{Bytes: b, Weight: w})
+	}
+	return out, nil
+}
+
+type Config struct {
+	Rate        float64
+	Duration    time.Duration
+	Concurrency int
+	Sizes       []Size
+	// DuplicateRatio is the share of requests that reuse an earlier
+	// idempotency key; each must come back with the original job id.
+	DuplicateRatio float64
+	Types          []string
+	// WaitTimeout bounds how long to poll for completion after the last
+	// submit. Zero skips completion tracking.
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+}
+
+func (c *Config) applyDefaults() {
+	if c.Rate <= 0 {
+		c.Rate = DefaultRate
+	}
+	if c.Duration <= 0 {
+		c.Duration = DefaultDuration
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if len(c.Sizes) == 0 {
+		c.Sizes = DefaultSizes
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+}
+
+type Request struct {
+	IdempotencyKey string
+	Type           string
+	Payload        json.RawMessage
+}
+
+type Submission struct {
+	JobID   string
+	Warning string
+}
+
+// Target is what the generator drives: the HTTP API or a producer directly.
+type Target interface {
+	Submit(ctx context.Context, req Request) (Submission, error)
+	// Status returns the job's current status; ok is false while unknown.
+	Status(ctx context.Context, jobID string) (status state.State, ok bool, err error)
+	// Dedupes reports whether repeated idempotency keys are expected to map
+	// to the same job id.
+	Dedupes() bool
+}
+
+type Latency struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+func summarize(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	slices.Sort(samples)
+	at := func(q float64) float64 {
+		idx := int(q*float64(len(samples))+0.5) - 1
+		idx = max(0, min(idx, len(samples)-1))
+		return float64(samples[idx].Microseconds()) / 1000
+	}
+	return Latency{Count: len(samples), P50Ms: at(0.50), P90Ms: at(0.90), P99Ms: at(0.99), MaxMs: at(1)}
+}
+
+type Report struct {
+	Requests      int            `json:"requests"`
+	Submitted     int            `json:"submitted"`
+	Errors        map[string]int `json:"errors"`
+	Duplicates    int            `json:"duplicates"`
+	DedupeErrors  int            `json:"dedupe_errors"`
+	Warnings      map[string]int `json:"warnings"`
+	ThroughputRPS float64        `json:"throughput_rps"`
+	Submit        Latency        `json:"submit_latency"`
+	Completed     int            `json:"completed"`
+	Failed        int            `json:"failed"`
+	Pending       int            `json:"pending"`
+	EndToEnd      Latency        `json:"end_to_end_latency"`
+}
+
+type tracked struct {
+	submitted time.Time
+	done      bool
+}
+
+type generator struct {
+	cfg    Config
+	target Target
+
+	mu         sync.Mutex
+	report     Report
+	submitLat  []time.Duration
+	e2eLat     []time.Duration
+	keys       []string
+	keyToJob   map[string]string
+	jobs       map[string]*tracked
+	jobOrder   []string
+	keyCounter int
+}
+
+// Run submits jobs at cfg.Rate for cfg.Duration, then waits up to
+// cfg.WaitTimeout for them to reach a terminal status.
+func Run(ctx context.Context, target Target, cfg Config) (Report, error) {
+	cfg.applyDefaults()
+	g := &generator{
+		cfg:      cfg,
+		target:   target,
+		keyToJob: make(map[string]string),
+		jobs:     make(map[string]*tracked),
+		report:   Report{Errors: make(map[string]int), Warnings: make(map[string]int)},
+	}
+
+	var polling sync.WaitGroup
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	defer stopPolling()
+	submitted := make(chan struct{})
+	if cfg.WaitTimeout > 0 {
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			g.pollLoop(pollCtx, submitted)
+		}()
+	}
+
+	start := time.Now()
+	g.submitAll(ctx)
+	if elapsed := time.Since(start); elapsed > 0 {
+		g.setThroughput(elapsed)
+	}
+	close(submitted)
+
+	if cfg.WaitTimeout > 0 {
+		finished := make(chan struct{})
+		go func() {
+			polling.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(cfg.WaitTimeout):
+		case <-ctx.Done():
+		}
+		stopPolling()
+		<-finished
+	}
+	return g.finish(), ctx.Err()
+}
+
+func (g *generator) setThroughput(elapsed time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.report.ThroughputRPS = float64(g.report.Submitted) / elapsed.Seconds()
+}
+
+func (g *generator) submitAll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.Duration)
+	defer cancel()
+
+	work := make(chan Request)
+	var wg sync.WaitGroup
+	for range g.cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range work {
+				g.submit(ctx, req)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.cfg.Rate))
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			req, err := g.next()
+			if err != nil {
+				g.recordError("payload")
+				continue
+			}
+			select {
+			case work <- req:
+			case <-ctx.Done():
+				break loop
+			}
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (g *generator) next() (Request, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.report.Requests++
+
+	req := Request{}
+	if len(g.cfg.Types) > 0 {
+		req.Type = g.cfg.Types[mrand.IntN(len(g.cfg.Types))]
+	}
+	if len(g.keys) > 0 && mrand.Float64() < g.cfg.DuplicateRatio {
+		req.IdempotencyKey = g.keys[mrand.IntN(len(g.keys))]
+		g.report.Duplicates++
+	} else {
+		g.keyCounter++
+		req.IdempotencyKey = "loadgen-" + randomHex(8) + "-" + strconv.Itoa(g.keyCounter)
+		g.keys = append(g.keys, req.IdempotencyKey)
+	}
+
+	var err error
+	req.Payload, err = makePayload(pickSize(g.cfg.Sizes))
+	return req, err
+}
+
+func (g *generator) submit(ctx context.Context, req Request) {
+	began := time.Now()
+	sub, err := g.target.Submit(ctx, req)
+	took := time.Since(began)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+			return
+		}
+		g.recordError(errorLabel(err))
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.report.Submitted++
+	g.submitLat = append(g.submitLat, took)
+	if sub.Warning != "" {
+		g.report.Warnings[sub.Warning]++
+	}
+	if prev, ok := g.keyToJob[req.IdempotencyKey]; ok {
+		if g.target.Dedupes() && prev != sub.JobID {
+			g.report.DedupeErrors++
+		}
+		return
+	}
+	g.keyToJob[req.IdempotencyKey] = sub.JobID
+	if _, ok := g.jobs[sub.JobID]; !ok {
+		g.jobs[sub.JobID] = &tracked{submitted: began}
+		g.jobOrder = append(g.jobOrder, sub.JobID)
+	}
+}
+
+func (g *generator) recordError(label string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.report.Errors[label]++
+}
+
+// pollLoop tracks completion while jobs are still being submitted, so
+// end-to-end latency is not inflated by the submit phase. It returns once
+// submission is over and nothing is pending, or when ctx ends.
+func (g *generator) pollLoop(ctx context.Context, submitted <-chan struct{}) {
+	ticker := time.NewTicker(g.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		final := false
+		select {
+		case <-submitted:
+			final = true
+		default:
+		}
+		if g.poll(ctx) == 0 && final {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll checks every unfinished job once and returns how many remain.
+func (g *generator) poll(ctx context.Context) int {
+	g.mu.Lock()
+	var ids []string
+	for _, id := range g.jobOrder {
+		if !g.jobs[id].done {
+			ids = append(ids, id)
+		}
+	}
+	g.mu.Unlock()
+
+	pending := 0
+	for _, id := range ids {
+		status, ok, err := g.target.Status(ctx, id)
+		if err != nil || !ok || !state.IsTerminal(status) {
+			pending++
+			continue
+		}
+		g.mu.Lock()
+		job := g.jobs[id]
+		job.done = true
+		if status == state.Done {
+			g.report.Completed++
+			g.e2eLat = append(g.e2eLat, time.Since(job.submitted))
+		} else {
+			g.report.Failed++
+		}
+		g.mu.Unlock()
+	}
+	return pending
+}
+
+func (g *generator) finish() Report {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r := g.report
+	r.Submit = summarize(g.submitLat)
+	r.EndToEnd = summarize(g.e2eLat)
+	if g.cfg.WaitTimeout > 0 {
+		r.Pending = len(g.jobOrder) - r.Completed - r.Failed
+	}
+	return r
+}
+
+func pickSize(sizes []Size) int {
+	total := 0
+	for _, s := range sizes {
+		total += s.Weight
+	}
+	n := mrand.IntN(total)
+	for _, s := range sizes {
+		if n < s.Weight {
+			return s.Bytes
+		}
+		n -= s.Weight
+	}
+	return sizes[len(sizes)-1].Bytes
+}
+
+// makePayload builds a JSON object whose encoding is about n bytes.
+func makePayload(n int) (json.RawMessage, error) {
+	const overhead = len(`{"data":""}`)
+	fill := max(0, n-overhead)
+	buf := make([]byte, (fill+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	data := hex.EncodeToString(buf)[:fill]
+	return json.Marshal(map[string]string{"data": data})
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// StatusError is returned by targets for non-success responses so the report
+// can group failures by status code and API error code.
+type StatusError struct {
+	Code   int
+	Reason string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status " + e.label()
+}
+
+func (e *StatusError) label() string {
+	if e.Reason == "" {
+		return strconv.Itoa(e.Code)
+	}
+	return strconv.Itoa(e.Code) + " " + e.Reason
+}
+
+func errorLabel(err error) string {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.label()
+	}
+	return "transport"
+}
@@ -0,0 +1,88 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseSizes(t *testing.T) {
+	sizes, err := ParseSizes("256:70, 4096:25,65536")
+	if err != nil {
+		t.Fatalf("ParseSizes: %v", err)
+	}
+	want := []Size{{256, 70}, {4096, 25}, {65536, 1}}
+	if len(sizes) != len(want) {
+		t.Fatalf("sizes = %+v", sizes)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Fatalf("sizes[%d] = %+v, want %+v", i, sizes[i], want[i])
+		}
+	}
+	for _, bad := range []string{"", "abc", "10:0", "-1:5"} {
+		if _, err := ParseSizes(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestMakePayloadSize(t *testing.T) {
+	for _, n := range []int{64, 1000, 4096} {
+		p, err := makePayload(n)
+		if err != nil {
+			t.Fatalf("makePayload: %v", err)
+		}
+		if len(p) != n || !json.Valid(p) {
+			t.Fatalf("payload len = %d, want %d (valid=%v)", len(p), n, json.Valid(p))
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	got := summarize(samples)
+	if got.Count != 100 || got.P50Ms != 50 || got.P90Ms != 90 || got.P99Ms != 99 || got.MaxMs != 100 {
+		t.Fatalf("summarize = %+v", got)
+	}
+}
+
+func TestRunInProcess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := NewInProcess(10 * time.Millisecond)
+	defer p.Close()
+
+	report, err := Run(context.Background(), p.Target(), Config{
+		Rate:           400,
+		Duration:       250 * time.Millisecond,
+		Concurrency:    4,
+		Sizes:          []Size{{Bytes: 128, Weight: 1}},
+		DuplicateRatio: 0.3,
+		WaitTimeout:    2 * time.Second,
+		PollInterval:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Submitted == 0 || len(report.Errors) != 0 {
+		t.Fatalf("unexpected submit results: %+v", report)
+	}
+	if report.Duplicates == 0 || report.DedupeErrors != 0 {
+		t.Fatalf("dedupe: duplicates=%d errors=%d", report.Duplicates, report.DedupeErrors)
+	}
+	if report.Pending != 0 || report.Completed != report.EndToEnd.Count || report.Completed == 0 {
+		t.Fatalf("completion: %+v", report)
+	}
+	if report.Completed != len(p.Producer.Published()) {
+		t.Fatalf("completed %d, published %d", report.Completed, len(p.Producer.Published()))
+	}
+	if report.Submit.P50Ms <= 0 || report.EndToEnd.P50Ms < 10 {
+		t.Fatalf("latency: submit=%+v e2e=%+v", report.Submit, report.EndToEnd)
+	}
+}
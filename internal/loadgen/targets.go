@@ -0,0 +1,126 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mq-redis/internal/api"
+	"mq-redis/internal/auth"
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/state"
+)
+
+// HTTPTarget drives POST /jobs and reads completion back from GET /jobs/:id.
+type HTTPTarget struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func (t *HTTPTarget) Dedupes() bool { return true }
+
+func (t *HTTPTarget) Submit(ctx context.Context, req Request) (Submission, error) {
+	body, err := json.Marshal(api.JobRequest{IdempotencyKey: req.IdempotencyKey, Type: req.Type, Payload: req.Payload})
+	if err != nil {
+		return Submission{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url("/jobs"), bytes.NewReader(body))
+	if err != nil {
+		return Submission{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	var resp api.JobResponse
+	code, err := t.do(httpReq, &resp)
+	if err != nil {
+		return Submission{}, err
+	}
+	if code != http.StatusCreated && code != http.StatusAccepted {
+		return Submission{}, &StatusError{Code: code, Reason: resp.Warning}
+	}
+	return Submission{JobID: resp.JobID, Warning: resp.Warning}, nil
+}
+
+func (t *HTTPTarget) Status(ctx context.Context, jobID string) (state.State, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url("/jobs/"+jobID), nil)
+	if err != nil {
+		return "", false, err
+	}
+	var resp api.JobResponse
+	code, err := t.do(httpReq, &resp)
+	if err != nil {
+		return "", false, err
+	}
+	switch code {
+	case http.StatusOK:
+		return state.State(resp.Status), true, nil
+	case http.StatusNotFound:
+		return "", false, nil
+	default:
+		return "", false, &StatusError{Code: code}
+	}
+}
+
+// do sends the request and decodes either a JobResponse or, for errors, the
+// API error code into resp.Warning.
+func (t *HTTPTarget) do(req *http.Request, resp *api.JobResponse) (int, error) {
+	if t.APIKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, t.APIKey)
+	}
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		var errResp api.ErrorResponse
+		_ = json.NewDecoder(res.Body).Decode(&errResp)
+		resp.Warning = errResp.Error
+		return res.StatusCode, nil
+	}
+	return res.StatusCode, json.NewDecoder(res.Body).Decode(resp)
+}
+
+func (t *HTTPTarget) url(path string) string {
+	return strings.TrimRight(t.BaseURL, "/") + path
+}
+
+// StatusFunc reads a job's status from wherever the worker writes it.
+type StatusFunc func(ctx context.Context, jobID string) (state.State, bool, error)
+
+// ProducerTarget publishes straight to an api.Producer, bypassing the API and
+// its dedupe, to measure the queue and workers on their own.
+type ProducerTarget struct {
+	Producer api.Producer
+	Tenant   string
+	Statuses StatusFunc
+}
+
+func (t *ProducerTarget) Dedupes() bool { return false }
+
+func (t *ProducerTarget) Submit(ctx context.Context, req Request) (Submission, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Submission{}, err
+	}
+	jobID := hex.EncodeToString(buf)
+	if err := t.Producer.Publish(ctx, jobID, req.Payload, jobmeta.Meta{Tenant: t.Tenant, Type: req.Type}); err != nil {
+		return Submission{}, err
+	}
+	return Submission{JobID: jobID}, nil
+}
+
+func (t *ProducerTarget) Status(ctx context.Context, jobID string) (state.State, bool, error) {
+	if t.Statuses == nil {
+		return "", false, nil
+	}
+	return t.Statuses(ctx, jobID)
+}
@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds labelled counters and gauges and renders them in the
+// Prometheus text exposition format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]*vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*vec)}
+}
+
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+type value struct {
+	labels []string
+
+	mu sync.Mutex
+	v  float64
+}
+
+type CounterVec struct{ v *vec }
+
+type GaugeVec struct{ v *vec }
+
+type Counter struct{ v *value }
+
+type Gauge struct{ v *value }
+
+// Counter registers (or returns the existing) counter vector with the given
+// label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: r.register(name, help, "counter", labels)}
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: r.register(name, help, "gauge", labels)}
+}
+
+func (r *Registry) register(name, help, kind string, labels []string) *vec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.metrics[name]; ok {
+		if existing.kind != kind || len(existing.labels) != len(labels) {
+			panic(fmt.Sprintf("metrics: %s re-registered with a different shape", name))
+		}
+		return existing
+	}
+	v := &vec{name: name, help: help, kind: kind, labels: labels, values: make(map[string]*value)}
+	r.metrics[name] = v
+	return v
+}
+
+func (v *vec) with(values []string) *value {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	val, ok := v.values[key]
+	if !ok {
+		val = &value{labels: append([]string(nil), values...)}
+		v.values[key] = val
+	}
+	return val
+}
+
+func (c *CounterVec) With(values ...string) Counter {
+	return Counter{v: c.v.with(values)}
+}
+
+func (g *GaugeVec) With(values ...string) Gauge {
+	return Gauge{v: g.v.with(values)}
+}
+
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+// Add ignores negative deltas; counters only go up.
+func (c Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+func (c Counter) Value() float64 {
+	return c.v.get()
+}
+
+func (g Gauge) Set(v float64) {
+	g.v.mu.Lock()
+	g.v.v = v
+	g.v.mu.Unlock()
+}
+
+func (g Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g Gauge) Dec() {
+	g.v.add(-1)
+}
+
+func (g Gauge) Value() float64 {
+	return g.v.get()
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// WriteText renders every metric sorted by name, then by label values.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mu.Lock()
+		v := r.metrics[name]
+		r.mu.Unlock()
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind); err != nil {
+			return err
+		}
+		v.mu.Lock()
+		keys := make([]string, 0, len(v.values))
+		for key := range v.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]*value, len(keys))
+		for i, key := range keys {
+			values[i] = v.values[key]
+		}
+		v.mu.Unlock()
+		for _, val := range values {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, val.labels), strconv.FormatFloat(val.get(), 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = r.WriteText(w)
+	})
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	submitted := r.Counter("jobs_submitted_total", "Jobs accepted.", "tenant")
+	submitted.With("a").Inc()
+	submitted.With("a").Add(2)
+	submitted.With("b").Inc()
+	submitted.With("b").Add(-5)
+
+	depth := r.Gauge("retry_depth", "Retry backlog.")
+	depth.With().Set(4)
+	depth.With().Dec()
+
+	if got := submitted.With("a").Value(); got != 3 {
+		t.Fatalf("a = %v", got)
+	}
+	if got := submitted.With("b").Value(); got != 1 {
+		t.Fatalf("b = %v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := `# HELP jobs_submitted_total Jobs accepted.
+# TYPE jobs_submitted_total counter
+jobs_submitted_total{tenant="a"} 3
+jobs_submitted_total{tenant="b"} 1
+# HELP retry_depth Retry backlog.
+# TYPE retry_depth gauge
+retry_depth 3
+`
+	if buf.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRegisterReturnsExisting(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("c", "help", "l").With("x").Inc()
+	r.Counter("c", "help", "l").With("x").Inc()
+	var buf bytes.Buffer
+	_ = r.WriteText(&buf)
+	if !strings.Contains(buf.String(), `c{l="x"} 2`) {
+		t.Fatalf("output = %s", buf.String())
+	}
+}
@@ -0,0 +1,183 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+)
+
+const (
+	DefaultGrace     = 10 * time.Second
+	DefaultLease     = 30 * time.Second
+	DefaultBatchSize = 100
+)
+
+// Config tunes the relay. Grace leaves fresh entries to the API, which
+// normally publishes and clears them itself; Lease is how long a claimed
+// entry stays hidden from other relays before it is retried.
+type Config struct {
+	Grace     time.Duration `yaml:"grace"`
+	Lease     time.Duration `yaml:"lease"`
+	BatchSize int64         `yaml:"batch_size"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error
+}
+
+// claimScript leases up to ARGV[2] entries created before ARGV[1] by moving
+// their score to the lease expiry ARGV[3].
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+// Relay publishes jobs whose outbox entry was not cleared by the API, so every
+// job written by CreateJob eventually reaches Kafka.
+type Relay struct {
+	redis     redis.UniversalClient
+	publisher Publisher
+	mu        sync.Mutex
+	interval  time.Duration
+	cfg       Config
+	keys      rediskeys.Keys
+	now       func() time.Time
+}
+
+type Option func(*Relay)
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(r *Relay) {
+		r.keys = keys
+	}
+}
+
+func New(redisClient redis.UniversalClient, publisher Publisher, interval time.Duration, cfg Config, opts ...Option) (*Relay, error) {
+	if redisClient == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if publisher == nil {
+		return nil, errors.New("publisher is required")
+	}
+	if interval <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+	if cfg.Grace <= 0 {
+		cfg.Grace = DefaultGrace
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	r := &Relay{redis: redisClient, publisher: publisher, interval: interval, cfg: cfg, now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// SetInterval changes the poll interval from the next tick on.
+func (r *Relay) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.interval = interval
+	r.mu.Unlock()
+}
+
+func (r *Relay) currentInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interval
+}
+
+// Run relays pending entries every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	interval := r.currentInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if next := r.currentInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
+		n, err := r.RelayPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox relay error: %v", err)
+		}
+		if int64(n) == r.cfg.BatchSize && err == nil && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending claims one batch of entries older than the grace period and
+// publishes them. Entries that fail stay leased and are retried after Lease.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	now := r.now()
+	ids, err := claimScript.Run(ctx, r.redis, []string{r.keys.OutboxKey()},
+		now.Add(-r.cfg.Grace).UnixMilli(), r.cfg.BatchSize, now.Add(r.cfg.Lease).UnixMilli()).StringSlice()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := r.relay(ctx, id); err != nil {
+			log.Printf("outbox relay failed job_id=%s: %v", id, err)
+			continue
+		}
+		if err := r.redis.ZRem(ctx, r.keys.OutboxKey(), id).Err(); err != nil {
+			log.Printf("outbox clear failed job_id=%s: %v", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// relay publishes a still-queued job. Any other status means a worker already
+// received it, and a missing snapshot means there is nothing left to send;
+// both just clear the entry.
+func (r *Relay) relay(ctx context.Context, jobID string) error {
+	status, err := r.redis.Get(ctx, r.keys.JobKey(jobID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if state.State(status) != state.Queued {
+		return nil
+	}
+	payload, err := r.redis.Get(ctx, r.keys.JobDataKey(jobID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		log.Printf("outbox dropped job_id=%s: payload snapshot expired", jobID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields, err := r.redis.HGetAll(ctx, r.keys.JobMetaKey(jobID)).Result()
+	if err != nil {
+		return err
+	}
+	return r.publisher.Publish(ctx, jobID, payload, jobmeta.FromFields(fields))
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+type fakePublisher struct {
+	jobIDs []string
+	metas  []jobmeta.Meta
+	err    error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.jobIDs = append(p.jobIDs, jobID)
+	p.metas = append(p.metas, meta)
+	return nil
+}
+
+func newRelay(t *testing.T, pub Publisher) (*Relay, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r, err := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), pub, time.Second, Config{Grace: 10 * time.Second, Lease: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("new relay: %v", err)
+	}
+	r.now = func() time.Time { return time.UnixMilli(100_000) }
+	return r, mr
+}
+
+func seed(t *testing.T, mr *miniredis.Miniredis, id, status string, createdMS float64) {
+	t.Helper()
+	mr.Set(keys.JobKey(id), status)
+	mr.Set(keys.JobDataKey(id), `{}`)
+	mr.HSet(keys.JobMetaKey(id), jobmeta.FieldTenant, "team-a")
+	if _, err := mr.ZAdd(keys.OutboxKey(), createdMS, id); err != nil {
+		t.Fatalf("zadd: %v", err)
+	}
+}
+
+func TestRelayPendingPublishesStaleEntries(t *testing.T) {
+	pub := &fakePublisher{}
+	r, mr := newRelay(t, pub)
+	seed(t, mr, "stuck", "queued", 50_000)
+	seed(t, mr, "fresh", "queued", 95_000)
+	seed(t, mr, "consumed", "processing", 50_000)
+
+	n, err := r.RelayPending(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if len(pub.jobIDs) != 1 || pub.jobIDs[0] != "stuck" || pub.metas[0].Tenant != "team-a" {
+		t.Fatalf("published = %v %+v", pub.jobIDs, pub.metas)
+	}
+	if members, _ := mr.ZMembers(keys.OutboxKey()); len(members) != 1 || members[0] != "fresh" {
+		t.Fatalf("outbox = %v", members)
+	}
+}
+
+func TestRelayPendingKeepsLeaseOnFailure(t *testing.T) {
+	r, mr := newRelay(t, &fakePublisher{err: errors.New("kafka down")})
+	seed(t, mr, "stuck", "queued", 50_000)
+
+	if _, err := r.RelayPending(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	score, err := mr.ZScore(keys.OutboxKey(), "stuck")
+	if err != nil || score != 130_000 {
+		t.Fatalf("score=%v err=%v", score, err)
+	}
+	if n, _ := r.RelayPending(context.Background()); n != 0 {
+		t.Fatalf("expected leased entry to be hidden, n=%d", n)
+	}
+}
@@ -9,7 +9,13 @@ import (
 
 type pingFunc func(ctx context.Context, dsn string) error
 
-func CheckConnectivity(ctx context.Context, dsn string) error {
+// CheckConnectivity pings with the merged connection string, so the
+// configured sslmode and certificates are exercised too.
+func CheckConnectivity(ctx context.Context, cfg Config) error {
+	dsn, err := cfg.ConnString()
+	if err != nil {
+		return err
+	}
 	return checkConnectivity(ctx, dsn, defaultPing)
 }
 
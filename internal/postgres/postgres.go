@@ -2,16 +2,122 @@ package postgres
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 )
 
+// Config holds the DSN plus TLS settings kept as separate keys, so they can
+// be set per environment without editing the DSN. Keys that are set here
+// are merged into the DSN by ConnString; a DSN that already sets one of them
+// to a different value is rejected rather than silently overridden.
 type Config struct {
-	DSN string `yaml:"dsn"`
+	DSN         string `yaml:"dsn" secret:"true"`
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"`
+	SSLCert     string `yaml:"sslcert"`
+	SSLKey      string `yaml:"sslkey"`
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
 }
 
 func (c Config) Validate() error {
 	if strings.TrimSpace(c.DSN) == "" {
 		return fmt.Errorf("postgres.dsn is required")
 	}
-	return nil
+	if c.SSLMode != "" && !sslModes[c.SSLMode] {
+		return fmt.Errorf("postgres.sslmode %q is not one of disable, allow, prefer, require, verify-ca, verify-full", c.SSLMode)
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		return fmt.Errorf("postgres.sslcert and postgres.sslkey must be set together")
+	}
+	if c.SSLMode == "disable" && (c.SSLRootCert != "" || c.SSLCert != "") {
+		return fmt.Errorf("postgres.sslmode disable conflicts with certificate settings")
+	}
+	_, err := c.ConnString()
+	return err
+}
+
+func (c Config) params() [][2]string {
+	var out [][2]string
+	for _, kv := range [][2]string{
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+	} {
+		if kv[1] != "" {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// ConnString returns the DSN with the ssl* settings merged in. Both URL
+// (postgres://...) and keyword/value (host=... sslmode=...) DSNs are
+// supported.
+func (c Config) ConnString() (string, error) {
+	params := c.params()
+	if len(params) == 0 {
+		return c.DSN, nil
+	}
+	if strings.HasPrefix(c.DSN, "postgres://") || strings.HasPrefix(c.DSN, "postgresql://") {
+		return mergeURL(c.DSN, params)
+	}
+	return mergeKeywords(c.DSN, params)
+}
+
+func mergeURL(dsn string, params [][2]string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("parse postgres.dsn: %w", err)
+	}
+	q := u.Query()
+	for _, kv := range params {
+		if existing := q.Get(kv[0]); existing != "" && existing != kv[1] {
+			return "", conflict(kv[0], existing, kv[1])
+		}
+		q.Set(kv[0], kv[1])
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+var keywordParam = regexp.MustCompile(`(?:^|\s)(\w+)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+func mergeKeywords(dsn string, params [][2]string) (string, error) {
+	existing := map[string]string{}
+	for _, m := range keywordParam.FindAllStringSubmatch(dsn, -1) {
+		existing[m[1]] = strings.Trim(m[2], "'")
+	}
+	out := strings.TrimSpace(dsn)
+	for _, kv := range params {
+		if v, ok := existing[kv[0]]; ok {
+			if v != kv[1] {
+				return "", conflict(kv[0], v, kv[1])
+			}
+			continue
+		}
+		out += " " + kv[0] + "=" + quoteKeyword(kv[1])
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func quoteKeyword(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, `'`, `\'`) + "'"
+}
+
+func conflict(key, inDSN, inConfig string) error {
+	return fmt.Errorf("postgres.%s %q conflicts with %s=%s in postgres.dsn", key, inConfig, key, inDSN)
 }
@@ -15,3 +15,53 @@ func TestValidateMissing(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestValidateSSL(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"verify-full", Config{DSN: "postgres://db/mq", SSLMode: "verify-full", SSLRootCert: "/etc/ca.pem"}, true},
+		{"unknown mode", Config{DSN: "postgres://db/mq", SSLMode: "strict"}, false},
+		{"cert without key", Config{DSN: "postgres://db/mq", SSLMode: "require", SSLCert: "c.pem"}, false},
+		{"disable with certs", Config{DSN: "postgres://db/mq", SSLMode: "disable", SSLRootCert: "/etc/ca.pem"}, false},
+		{"conflicts with dsn", Config{DSN: "postgres://db/mq?sslmode=disable", SSLMode: "require"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestConnString(t *testing.T) {
+	cases := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{DSN: "postgres://u:p@db:5432/mq"}, "postgres://u:p@db:5432/mq"},
+		{Config{DSN: "postgres://u:p@db:5432/mq", SSLMode: "verify-full", SSLRootCert: "/etc/ca.pem"}, "postgres://u:p@db:5432/mq?sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem"},
+		{Config{DSN: "postgres://db/mq?sslmode=require", SSLMode: "require"}, "postgres://db/mq?sslmode=require"},
+		{Config{DSN: "host=db dbname=mq", SSLMode: "require"}, "host=db dbname=mq sslmode=require"},
+		{Config{DSN: "host=db sslmode=require", SSLMode: "require", SSLRootCert: "/etc/my ca.pem"}, `host=db sslmode=require sslrootcert='/etc/my ca.pem'`},
+	}
+	for _, tc := range cases {
+		got, err := tc.cfg.ConnString()
+		if err != nil {
+			t.Fatalf("ConnString(%+v): %v", tc.cfg, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ConnString = %q, want %q", got, tc.want)
+		}
+	}
+	if _, err := (Config{DSN: "host=db sslmode='disable'", SSLMode: "verify-ca"}).ConnString(); err == nil {
+		t.Fatalf("expected conflict for keyword DSN")
+	}
+}
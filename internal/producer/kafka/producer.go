@@ -5,15 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"mq-redis/internal/jobmeta"
 	"mq-redis/internal/kafka"
 )
 
 type Producer struct {
 	topic    string
+	topics   map[string]string
 	producer kafka.Producer
 }
 
-func New(cfg kafka.Config, producer kafka.Producer) (*Producer, error) {
+type Option func(*Producer)
+
+// WithTenantTopics routes jobs of the listed tenants to their own topic so a
+// flood from one tenant does not queue behind another's.
+func WithTenantTopics(topics map[string]string) Option {
+	return func(p *Producer) {
+		p.topics = topics
+	}
+}
+
+func New(cfg kafka.Config, producer kafka.Producer, opts ...Option) (*Producer, error) {
 	if err := cfg.ValidateJobs(); err != nil {
 		return nil, err
 	}
@@ -24,15 +36,27 @@ func New(cfg kafka.Config, producer kafka.Producer) (*Producer, error) {
 		}
 		producer = real
 	}
-	return &Producer{topic: cfg.JobsTopic, producer: producer}, nil
+	p := &Producer{topic: cfg.JobsTopic, producer: producer}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
 }
 
-func (p *Producer) Publish(ctx context.Context, jobID string, payload json.RawMessage) error {
+func (p *Producer) Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
 	if p == nil || p.producer == nil {
 		return fmt.Errorf("kafka producer not configured")
 	}
-	msg := kafka.Message{Key: jobID, Value: payload}
-	return p.producer.Publish(ctx, p.topic, msg)
+	msg := kafka.Message{Key: jobID, Value: payload, Headers: meta.Fields()}
+	return p.producer.Publish(ctx, p.TopicFor(meta.Tenant), msg)
+}
+
+// TopicFor returns the jobs topic for a tenant.
+func (p *Producer) TopicFor(tenant string) string {
+	if topic, ok := p.topics[tenant]; ok {
+		return topic
+	}
+	return p.topic
 }
 
 func (p *Producer) Close() error {
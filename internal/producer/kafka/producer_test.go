@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/kafka"
+)
+
+type recordingProducer struct {
+	topics []string
+	msgs   []kafka.Message
+}
+
+func (p *recordingProducer) Publish(ctx context.Context, topic string, msg kafka.Message) error {
+	p.topics = append(p.topics, topic)
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func TestPublishRoutesByTenant(t *testing.T) {
+	rec := &recordingProducer{}
+	cfg := kafka.Config{Brokers: []string{"b1"}, JobsTopic: "jobs"}
+	p, err := New(cfg, rec, WithTenantTopics(map[string]string{"team-a": "jobs.team-a"}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	payload := json.RawMessage(`{"a":1}`)
+	if err := p.Publish(context.Background(), "job1", payload, jobmeta.Meta{Tenant: "team-a", ClientID: "a-ci"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := p.Publish(context.Background(), "job2", payload, jobmeta.Meta{Tenant: "team-b"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	if rec.topics[0] != "jobs.team-a" || rec.topics[1] != "jobs" {
+		t.Fatalf("topics = %v", rec.topics)
+	}
+	if rec.msgs[0].Headers[jobmeta.FieldTenant] != "team-a" || rec.msgs[0].Headers[jobmeta.FieldClientID] != "a-ci" {
+		t.Fatalf("headers = %v", rec.msgs[0].Headers)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+
+	"mq-redis/internal/jobmeta"
 )
 
 // Producer is an in-memory implementation of the API Producer interface.
@@ -15,16 +17,17 @@ type Producer struct {
 type Message struct {
 	JobID   string
 	Payload json.RawMessage
+	Meta    jobmeta.Meta
 }
 
 func New() *Producer {
 	return &Producer{}
 }
 
-func (p *Producer) Publish(ctx context.Context, jobID string, payload json.RawMessage) error {
+func (p *Producer) Publish(ctx context.Context, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.published = append(p.published, Message{JobID: jobID, Payload: payload})
+	p.published = append(p.published, Message{JobID: jobID, Payload: payload, Meta: meta})
 	return nil
 }
 
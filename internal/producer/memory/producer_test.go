@@ -4,13 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+
+	"mq-redis/internal/jobmeta"
 )
 
 func TestProducer_Publish(t *testing.T) {
 	producer := New()
 	payload := json.RawMessage(`{"a":1}`)
 
-	if err := producer.Publish(context.Background(), "job1", payload); err != nil {
+	if err := producer.Publish(context.Background(), "job1", payload, jobmeta.Meta{Tenant: "team-a"}); err != nil {
 		t.Fatalf("Publish error: %v", err)
 	}
 
@@ -24,4 +26,7 @@ func TestProducer_Publish(t *testing.T) {
 	if string(published[0].Payload) != string(payload) {
 		t.Fatalf("payload mismatch")
 	}
+	if published[0].Meta.Tenant != "team-a" {
+		t.Fatalf("tenant = %q", published[0].Meta.Tenant)
+	}
 }
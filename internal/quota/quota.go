@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/tenant"
+)
+
+type Decision int
+
+const (
+	Allowed Decision = iota
+	RejectedQueued
+	RejectedRate
+)
+
+// reserveScript drops stale entries, enforces the queued cap and the
+// per-second submit rate, then records the job, all in one round trip.
+var reserveScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local maxQueued = tonumber(ARGV[3])
+if maxQueued > 0 and redis.call('ZCARD', KEYS[1]) >= maxQueued then
+	return 1
+end
+local maxRate = tonumber(ARGV[4])
+if maxRate > 0 then
+	local n = redis.call('INCR', KEYS[2])
+	if n == 1 then
+		redis.call('PEXPIRE', KEYS[2], 2000)
+	end
+	if n > maxRate then
+		return 2
+	end
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[5])
+redis.call('PEXPIRE', KEYS[1], ARGV[6])
+return 0
+`)
+
+// Limiter tracks each tenant's non-terminal jobs in a ZSET so the worker can
+// release them idempotently, and counts submissions per one-second window.
+type Limiter struct {
+	client    redis.UniversalClient
+	statusTTL time.Duration
+	keys      rediskeys.Keys
+	now       func() time.Time
+}
+
+type Option func(*Limiter)
+
+// WithTTL matches the stale-entry horizon to the configured job status TTL:
+// an entry older than that belongs to a job whose status has expired.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(l *Limiter) {
+		l.statusTTL = ttl.WithDefaults().JobStatus
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(l *Limiter) {
+		l.keys = keys
+	}
+}
+
+func New(client redis.UniversalClient, opts ...Option) *Limiter {
+	l := &Limiter{client: client, statusTTL: rediskeys.JobStatusTTL, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *Limiter) Reserve(ctx context.Context, tenantID, jobID string, q tenant.Quota) (Decision, error) {
+	if q.Unlimited() {
+		return Allowed, nil
+	}
+	now := l.now()
+	staleBefore := now.Add(-l.statusTTL)
+	res, err := reserveScript.Run(ctx, l.client,
+		[]string{l.keys.TenantQueuedJobsKey(tenantID), l.keys.TenantSubmitRateKey(tenantID, now.Unix())},
+		now.UnixMilli(), staleBefore.UnixMilli(), q.MaxQueued, q.SubmitRate, jobID, l.statusTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return Allowed, err
+	}
+	switch res {
+	case 0:
+		return Allowed, nil
+	case 1:
+		return RejectedQueued, nil
+	case 2:
+		return RejectedRate, nil
+	default:
+		return Allowed, errors.New("unexpected quota result")
+	}
+}
+
+// Release frees a job's slot; it is safe to call more than once.
+func (l *Limiter) Release(ctx context.Context, tenantID, jobID string) error {
+	return Release(ctx, l.client, l.keys, tenantID, jobID)
+}
+
+// Release is used by the worker once a job reaches a terminal state.
+func Release(ctx context.Context, client redis.UniversalClient, keys rediskeys.Keys, tenantID, jobID string) error {
+	return client.ZRem(ctx, keys.TenantQueuedJobsKey(tenantID), jobID).Err()
+}
@@ -0,0 +1,76 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/tenant"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	l := New(client)
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	return l, mr
+}
+
+func TestReserveMaxQueued(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	ctx := context.Background()
+	q := tenant.Quota{MaxQueued: 2}
+
+	for i := 0; i < 2; i++ {
+		if d, err := l.Reserve(ctx, "team-a", fmt.Sprintf("job%d", i), q); err != nil || d != Allowed {
+			t.Fatalf("reserve %d: decision=%v err=%v", i, d, err)
+		}
+	}
+	if d, _ := l.Reserve(ctx, "team-a", "job2", q); d != RejectedQueued {
+		t.Fatalf("decision = %v, want RejectedQueued", d)
+	}
+	if d, _ := l.Reserve(ctx, "team-b", "job3", q); d != Allowed {
+		t.Fatalf("other tenant decision = %v", d)
+	}
+
+	if err := l.Release(ctx, "team-a", "job0"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if d, _ := l.Reserve(ctx, "team-a", "job2", q); d != Allowed {
+		t.Fatalf("decision after release = %v", d)
+	}
+}
+
+func TestReserveSubmitRate(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	ctx := context.Background()
+	q := tenant.Quota{SubmitRate: 1}
+
+	if d, _ := l.Reserve(ctx, "team-a", "job1", q); d != Allowed {
+		t.Fatalf("decision = %v", d)
+	}
+	if d, _ := l.Reserve(ctx, "team-a", "job2", q); d != RejectedRate {
+		t.Fatalf("decision = %v, want RejectedRate", d)
+	}
+	now := l.now().Add(time.Second)
+	l.now = func() time.Time { return now }
+	if d, _ := l.Reserve(ctx, "team-a", "job2", q); d != Allowed {
+		t.Fatalf("next window decision = %v", d)
+	}
+}
+
+func TestReserveUnavailable(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	mr.Close()
+	if _, err := l.Reserve(context.Background(), "team-a", "job1", tenant.Quota{MaxQueued: 1}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if d, err := l.Reserve(context.Background(), "team-a", "job1", tenant.Quota{}); err != nil || d != Allowed {
+		t.Fatalf("unlimited quota should not touch redis: decision=%v err=%v", d, err)
+	}
+}
@@ -0,0 +1,212 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+)
+
+const (
+	FailOpen   = "open"
+	FailClosed = "closed"
+
+	DimensionClient = "client"
+	DimensionTenant = "tenant"
+	DimensionType   = "type"
+)
+
+// Config lists the token-bucket rules applied to job submission. FailureMode
+// decides what happens when Redis cannot be reached: "open" (the default)
+// admits the request like dedupe does, "closed" rejects it.
+type Config struct {
+	FailureMode string `yaml:"failure_mode"`
+	Rules       []Rule `yaml:"rules"`
+}
+
+// Rule allows Rate requests per second with bursts up to Burst for every
+// distinct combination of the By dimensions. Match restricts the rule to
+// requests whose dimension values equal the given ones.
+type Rule struct {
+	Name  string            `yaml:"name"`
+	By    []string          `yaml:"by"`
+	Rate  float64           `yaml:"rate"`
+	Burst int64             `yaml:"burst"`
+	Match map[string]string `yaml:"match"`
+}
+
+type Dimensions struct {
+	Client string
+	Tenant string
+	Type   string
+}
+
+func (d Dimensions) value(name string) string {
+	switch name {
+	case DimensionClient:
+		return d.Client
+	case DimensionTenant:
+		return d.Tenant
+	case DimensionType:
+		return d.Type
+	default:
+		return ""
+	}
+}
+
+func (c Config) FailClosed() bool {
+	return c.FailureMode == FailClosed
+}
+
+func (c Config) Validate() error {
+	switch c.FailureMode {
+	case "", FailOpen, FailClosed:
+	default:
+		return fmt.Errorf("api.rate_limit.failure_mode must be %q or %q", FailOpen, FailClosed)
+	}
+	seen := make(map[string]struct{}, len(c.Rules))
+	for i, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("api.rate_limit.rules[%d]: %w", i, err)
+		}
+		if _, dup := seen[r.Name]; dup {
+			return fmt.Errorf("api.rate_limit.rules[%d]: duplicate name %q", i, r.Name)
+		}
+		seen[r.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if strings.TrimSpace(r.Name) == "" || strings.Contains(r.Name, ":") {
+		return fmt.Errorf("name is required and must not contain ':'")
+	}
+	if r.Rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if r.Burst < 1 {
+		return fmt.Errorf("burst must be >= 1")
+	}
+	for _, dim := range r.By {
+		if !validDimension(dim) {
+			return fmt.Errorf("unknown dimension %q", dim)
+		}
+	}
+	for dim := range r.Match {
+		if !validDimension(dim) {
+			return fmt.Errorf("unknown match dimension %q", dim)
+		}
+	}
+	return nil
+}
+
+func validDimension(dim string) bool {
+	return dim == DimensionClient || dim == DimensionTenant || dim == DimensionType
+}
+
+// Key returns the bucket key for a request in the keys layout, or false if
+// the rule's Match does not apply to it.
+func (r Rule) Key(keys rediskeys.Keys, d Dimensions) (string, bool) {
+	for dim, want := range r.Match {
+		if d.value(dim) != want {
+			return "", false
+		}
+	}
+	values := make([]string, 0, len(r.By))
+	for _, dim := range r.By {
+		values = append(values, d.value(dim))
+	}
+	return keys.RateLimitKey(r.Name, values...), true
+}
+
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// bucketScript refills the bucket for the elapsed time, takes one token if
+// available and otherwise reports how long until one is.
+var bucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+local elapsed = now - ts
+if elapsed < 0 then
+	elapsed = 0
+end
+tokens = math.min(burst, tokens + elapsed * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, retry}
+`)
+
+// Limiter is a Redis token bucket shared by every API replica.
+type Limiter struct {
+	client redis.UniversalClient
+	now    func() time.Time
+}
+
+func New(client redis.UniversalClient) *Limiter {
+	return &Limiter{client: client, now: time.Now}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, rate float64, burst int64) (Result, error) {
+	res, err := bucketScript.Run(ctx, l.client, []string{key}, rate, burst, l.now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(res) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit result: %v", res)
+	}
+	return Result{Allowed: res[0] == 1, RetryAfter: time.Duration(res[1]) * time.Millisecond}, nil
+}
+
+// refundScript returns one token taken by bucketScript, never filling the
+// bucket past burst. A bucket that has expired meanwhile is already full.
+var refundScript = redis.NewScript(`
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens == nil then
+	return 0
+end
+tokens = math.min(tonumber(ARGV[1]), tokens + 1)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens))
+return 1
+`)
+
+// Refund gives back a token Allow took for a request that another rule then
+// rejected. Buckets of different rules live in different cluster slots, so
+// they cannot be checked in one script; refunding keeps a rejected request
+// from draining the buckets that admitted it.
+func (l *Limiter) Refund(ctx context.Context, key string, burst int64) error {
+	return refundScript.Run(ctx, l.client, []string{key}, burst).Err()
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds for the Retry-After
+// header, never returning less than one.
+func RetryAfterSeconds(d time.Duration) int64 {
+	secs := int64(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		return 1
+	}
+	return secs
+}
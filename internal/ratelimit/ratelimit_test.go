@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+)
+
+func TestAllowTokenBucket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, err := l.Allow(ctx, "ratelimit:r:a", 1, 2)
+		if err != nil || !res.Allowed {
+			t.Fatalf("request %d: res=%+v err=%v", i, res, err)
+		}
+	}
+	res, err := l.Allow(ctx, "ratelimit:r:a", 1, 2)
+	if err != nil || res.Allowed {
+		t.Fatalf("expected rejection, res=%+v err=%v", res, err)
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("retry after = %v", res.RetryAfter)
+	}
+	if res, _ := l.Allow(ctx, "ratelimit:r:b", 1, 2); !res.Allowed {
+		t.Fatalf("expected separate bucket to allow")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := l.Allow(ctx, "ratelimit:r:a", 1, 2); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("half refill: res=%+v", res)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := l.Allow(ctx, "ratelimit:r:a", 1, 2); !res.Allowed {
+		t.Fatalf("expected refill after one second")
+	}
+}
+
+func TestRefund(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := l.Refund(ctx, "ratelimit:r:a", 2); err != nil || mr.Exists("ratelimit:r:a") {
+		t.Fatalf("refund of a missing bucket: err=%v exists=%v", err, mr.Exists("ratelimit:r:a"))
+	}
+	l.Allow(ctx, "ratelimit:r:a", 1, 2)
+	l.Allow(ctx, "ratelimit:r:a", 1, 2)
+	if err := l.Refund(ctx, "ratelimit:r:a", 2); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if res, _ := l.Allow(ctx, "ratelimit:r:a", 1, 2); !res.Allowed {
+		t.Fatalf("expected the refunded token to be available")
+	}
+	for range 3 {
+		l.Refund(ctx, "ratelimit:r:a", 2)
+	}
+	if got := mr.HGet("ratelimit:r:a", "tokens"); got != "2" {
+		t.Fatalf("tokens = %q, want capped at burst", got)
+	}
+}
+
+func TestRuleKey(t *testing.T) {
+	rule := Rule{Name: "per-type", By: []string{DimensionTenant, DimensionType}, Match: map[string]string{DimensionType: "email"}}
+	key, ok := rule.Key(rediskeys.Keys{}, Dimensions{Client: "c", Tenant: "team-a", Type: "email"})
+	if !ok || key != "ratelimit:per-type:team-a:email" {
+		t.Fatalf("key = %q ok=%v", key, ok)
+	}
+	if _, ok := rule.Key(rediskeys.Keys{}, Dimensions{Type: "sms"}); ok {
+		t.Fatalf("expected match to exclude other types")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Rules: []Rule{{Name: "r", By: []string{DimensionClient}, Rate: 1, Burst: 1}}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	cases := map[string]Config{
+		"mode":      {FailureMode: "maybe"},
+		"rate":      {Rules: []Rule{{Name: "r", Burst: 1}}},
+		"burst":     {Rules: []Rule{{Name: "r", Rate: 1}}},
+		"dimension": {Rules: []Rule{{Name: "r", Rate: 1, Burst: 1, By: []string{"region"}}}},
+		"duplicate": {Rules: []Rule{{Name: "r", Rate: 1, Burst: 1}, {Name: "r", Rate: 1, Burst: 1}}},
+	}
+	for name, cfg := range cases {
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	if got := RetryAfterSeconds(10 * time.Millisecond); got != 1 {
+		t.Fatalf("got %d", got)
+	}
+	if got := RetryAfterSeconds(2100 * time.Millisecond); got != 3 {
+		t.Fatalf("got %d", got)
+	}
+}
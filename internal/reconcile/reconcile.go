@@ -0,0 +1,283 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/quota"
+	"mq-redis/internal/redisclient"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+)
+
+const (
+	DefaultProcessingTimeout = 15 * time.Minute
+	DefaultQueuedTimeout     = 10 * time.Minute
+	DefaultRetryingGrace     = time.Minute
+	DefaultLeaseGrace        = 2 * time.Minute
+	DefaultScanCount         = 500
+)
+
+// Config sets how old a job must be in a state before it counts as drifted.
+// ProcessingTimeout must exceed the longest legitimate job, and QueuedTimeout
+// the longest expected consumer lag, or healthy jobs get published twice.
+// A processing job whose worker lease is gone is recovered after LeaseGrace,
+// which must exceed the worker lease TTL. A job past ProcessingTimeout whose
+// lease is still live is only reported: a worker is still renewing it, and
+// rescheduling would run it twice.
+type Config struct {
+	ProcessingTimeout time.Duration `yaml:"processing_timeout"`
+	LeaseGrace        time.Duration `yaml:"lease_grace"`
+	QueuedTimeout     time.Duration `yaml:"queued_timeout"`
+	RetryingGrace     time.Duration `yaml:"retrying_grace"`
+	ScanCount         int64         `yaml:"scan_count"`
+	Interval          time.Duration `yaml:"interval"`
+}
+
+type Issue string
+
+const (
+	IssueStuckProcessing     Issue = "stuck_processing"
+	IssueLeaseExpired        Issue = "lease_expired"
+	IssueUnpublishedQueued   Issue = "unpublished_queued"
+	IssueRetryingUnscheduled Issue = "retrying_unscheduled"
+	IssueMissingData         Issue = "missing_data"
+)
+
+type Action string
+
+const (
+	ActionReschedule Action = "reschedule"
+	ActionRequeue    Action = "requeue"
+	ActionDLQ        Action = "dlq"
+	// ActionNone reports a finding for an operator without repairing it.
+	ActionNone Action = "none"
+)
+
+type Finding struct {
+	JobID      string      `json:"job_id"`
+	Status     state.State `json:"status"`
+	AgeSeconds float64     `json:"age_seconds"`
+	Issue      Issue       `json:"issue"`
+	Action     Action      `json:"action"`
+	Repaired   bool        `json:"repaired"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun   bool          `json:"dry_run"`
+	Scanned  int           `json:"scanned"`
+	Counts   map[Issue]int `json:"counts"`
+	Findings []Finding     `json:"findings"`
+}
+
+// repairScript applies a repair only if the job is still in the status the
+// scan saw. ARGV[4] is the retry:jobs score to schedule at; an empty score
+// means a terminal repair that removes the job from retry:jobs and the outbox.
+var repairScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] ~= '' then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	redis.call('HSET', KEYS[2], 'updated_at', ARGV[5])
+end
+if ARGV[4] ~= '' then
+	redis.call('ZADD', KEYS[3], ARGV[4], ARGV[6])
+else
+	redis.call('ZREM', KEYS[3], ARGV[6])
+	redis.call('ZREM', KEYS[4], ARGV[6])
+end
+return 1
+`)
+
+// Reconciler scans job status keys and repairs jobs left behind by crashes
+// or partial writes. Repairs go through retry:jobs, so the retry dispatcher
+// does the actual republish.
+type Reconciler struct {
+	redis redis.UniversalClient
+	cfg   Config
+	ttl   rediskeys.TTL
+	keys  rediskeys.Keys
+	now   func() time.Time
+}
+
+type Option func(*Reconciler)
+
+// WithTTL sets the status TTLs repairs write and the fallback age estimate
+// reads; zero fields keep their default.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(r *Reconciler) {
+		r.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(r *Reconciler) {
+		r.keys = keys
+	}
+}
+
+func New(client redis.UniversalClient, cfg Config, opts ...Option) *Reconciler {
+	if cfg.ProcessingTimeout <= 0 {
+		cfg.ProcessingTimeout = DefaultProcessingTimeout
+	}
+	if cfg.QueuedTimeout <= 0 {
+		cfg.QueuedTimeout = DefaultQueuedTimeout
+	}
+	if cfg.LeaseGrace <= 0 {
+		cfg.LeaseGrace = DefaultLeaseGrace
+	}
+	if cfg.RetryingGrace <= 0 {
+		cfg.RetryingGrace = DefaultRetryingGrace
+	}
+	if cfg.ScanCount <= 0 {
+		cfg.ScanCount = DefaultScanCount
+	}
+	r := &Reconciler{redis: client, cfg: cfg, ttl: rediskeys.DefaultTTL(), now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run performs one full scan. With dryRun set, findings are reported but
+// nothing is written.
+func (r *Reconciler) Run(ctx context.Context, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, Counts: make(map[Issue]int), Findings: []Finding{}}
+	scanner, err := redisclient.ScanClient(ctx, r.redis, r.keys)
+	if err != nil {
+		return report, err
+	}
+	var cursor uint64
+	for {
+		keys, next, err := scanner.Scan(ctx, cursor, r.keys.JobScanPattern(), r.cfg.ScanCount).Result()
+		if err != nil {
+			return report, err
+		}
+		for _, key := range keys {
+			jobID, ok := r.keys.StatusKeyJobID(key)
+			if !ok {
+				continue
+			}
+			report.Scanned++
+			finding, drifted, err := r.inspect(ctx, jobID)
+			if err != nil {
+				log.Printf("reconcile inspect failed job_id=%s: %v", jobID, err)
+				continue
+			}
+			if !drifted {
+				continue
+			}
+			if !dryRun && finding.Action != ActionNone {
+				r.repair(ctx, &finding)
+			}
+			report.Counts[finding.Issue]++
+			report.Findings = append(report.Findings, finding)
+		}
+		cursor = next
+		if cursor == 0 {
+			return report, nil
+		}
+	}
+}
+
+func (r *Reconciler) inspect(ctx context.Context, jobID string) (Finding, bool, error) {
+	pipe := r.redis.Pipeline()
+	statusCmd := pipe.Get(ctx, r.keys.JobKey(jobID))
+	ttlCmd := pipe.PTTL(ctx, r.keys.JobKey(jobID))
+	metaCmd := pipe.HGetAll(ctx, r.keys.JobMetaKey(jobID))
+	dataCmd := pipe.Exists(ctx, r.keys.JobDataKey(jobID))
+	retryCmd := pipe.ZScore(ctx, r.keys.RetryJobsKey(), jobID)
+	outboxCmd := pipe.ZScore(ctx, r.keys.OutboxKey(), jobID)
+	leaseCmd := pipe.Exists(ctx, r.keys.JobLeaseKey(jobID))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return Finding{}, false, err
+	}
+	status := state.State(statusCmd.Val())
+	if statusCmd.Err() != nil {
+		return Finding{}, false, nil
+	}
+	scheduled := retryCmd.Err() == nil
+	inOutbox := outboxCmd.Err() == nil
+
+	age := r.age(metaCmd.Val(), ttlCmd.Val())
+	finding := Finding{JobID: jobID, Status: status, AgeSeconds: age.Seconds()}
+
+	switch status {
+	case state.Queued, state.Processing, state.Retrying:
+	default:
+		return finding, false, nil
+	}
+	if dataCmd.Val() == 0 {
+		finding.Issue, finding.Action = IssueMissingData, ActionDLQ
+		return finding, true, nil
+	}
+	switch {
+	case status == state.Processing && age > r.cfg.ProcessingTimeout && leaseCmd.Val() == 0:
+		finding.Issue, finding.Action = IssueStuckProcessing, ActionReschedule
+	case status == state.Processing && age > r.cfg.ProcessingTimeout:
+		finding.Issue, finding.Action = IssueStuckProcessing, ActionNone
+	case status == state.Processing && leaseCmd.Val() == 0 && age > r.cfg.LeaseGrace:
+		finding.Issue, finding.Action = IssueLeaseExpired, ActionReschedule
+	case status == state.Queued && age > r.cfg.QueuedTimeout && !scheduled && !inOutbox:
+		finding.Issue, finding.Action = IssueUnpublishedQueued, ActionRequeue
+	case status == state.Retrying && age > r.cfg.RetryingGrace && !scheduled:
+		finding.Issue, finding.Action = IssueRetryingUnscheduled, ActionReschedule
+	default:
+		return finding, false, nil
+	}
+	return finding, true, nil
+}
+
+// age prefers the updated_at stamp; jobs written before it existed fall back
+// to how much of the status TTL has elapsed, since every status write resets
+// it.
+func (r *Reconciler) age(meta map[string]string, ttl time.Duration) time.Duration {
+	if at, ok := jobmeta.UpdatedAt(meta); ok {
+		return r.now().Sub(at)
+	}
+	if ttl > 0 {
+		return r.ttl.JobStatus - ttl
+	}
+	return 0
+}
+
+func (r *Reconciler) repair(ctx context.Context, f *Finding) {
+	now := r.now()
+	newStatus, ttl, score := "", time.Duration(0), ""
+	switch f.Action {
+	case ActionReschedule:
+		newStatus, ttl = string(state.Retrying), r.ttl.JobStatus
+		score = strconv.FormatInt(now.UnixMilli(), 10)
+	case ActionRequeue:
+		score = strconv.FormatInt(now.UnixMilli(), 10)
+	case ActionDLQ:
+		newStatus, ttl = string(state.DLQ), r.ttl.DLQ
+	}
+	keys := []string{r.keys.JobKey(f.JobID), r.keys.JobMetaKey(f.JobID), r.keys.RetryJobsKey(), r.keys.OutboxKey()}
+	applied, err := repairScript.Run(ctx, r.redis, keys,
+		string(f.Status), newStatus, ttl.Milliseconds(), score, jobmeta.FormatUpdatedAt(now), f.JobID).Int64()
+	if err != nil {
+		f.Error = err.Error()
+		return
+	}
+	if applied == 0 {
+		f.Error = "status changed during reconcile; skipped"
+		return
+	}
+	f.Repaired = true
+	if f.Action == ActionDLQ {
+		tenantID, _ := r.redis.HGet(ctx, r.keys.JobMetaKey(f.JobID), jobmeta.FieldTenant).Result()
+		if err := quota.Release(ctx, r.redis, r.keys, tenantID, f.JobID); err != nil {
+			log.Printf("quota release failed job_id=%s: %v", f.JobID, err)
+		}
+	}
+}
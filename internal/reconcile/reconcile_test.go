@@ -0,0 +1,169 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+var now = time.Unix(1_700_000_000, 0)
+
+func newReconciler(t *testing.T) (*Reconciler, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), Config{
+		ProcessingTimeout: 10 * time.Minute,
+		LeaseGrace:        2 * time.Minute,
+		QueuedTimeout:     5 * time.Minute,
+		RetryingGrace:     time.Minute,
+		ScanCount:         10,
+	})
+	r.now = func() time.Time { return now }
+	return r, mr
+}
+
+func seed(mr *miniredis.Miniredis, id, status string, age time.Duration, withData bool) {
+	mr.Set(keys.JobKey(id), status)
+	mr.HSet(keys.JobMetaKey(id), jobmeta.FieldUpdatedAt, jobmeta.FormatUpdatedAt(now.Add(-age)), jobmeta.FieldTenant, "team-a")
+	if withData {
+		mr.Set(keys.JobDataKey(id), `{}`)
+	}
+}
+
+func seedDrift(t *testing.T, mr *miniredis.Miniredis) {
+	t.Helper()
+	seed(mr, "stuck", "processing", time.Hour, true)
+	seed(mr, "busy", "processing", time.Minute, true)
+	seed(mr, "abandoned", "processing", 5*time.Minute, true)
+	seed(mr, "leased", "processing", 5*time.Minute, true)
+	mr.Set(keys.JobLeaseKey("leased"), "w1")
+	seed(mr, "lost", "queued", time.Hour, true)
+	seed(mr, "outboxed", "queued", time.Hour, true)
+	mr.ZAdd(keys.OutboxKey(), 1, "outboxed")
+	seed(mr, "orphan", "retrying", time.Hour, true)
+	seed(mr, "waiting", "retrying", time.Hour, true)
+	mr.ZAdd(keys.RetryJobsKey(), 1, "waiting")
+	seed(mr, "nodata", "queued", time.Second, false)
+	mr.ZAdd(keys.TenantQueuedJobsKey("team-a"), 1, "nodata")
+	seed(mr, "finished", "done", time.Hour, false)
+}
+
+func TestRunDryRunReportsWithoutWriting(t *testing.T) {
+	r, mr := newReconciler(t)
+	seedDrift(t, mr)
+
+	report, err := r.Run(context.Background(), true)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Scanned != 10 {
+		t.Fatalf("scanned = %d", report.Scanned)
+	}
+	want := map[Issue]int{IssueStuckProcessing: 1, IssueLeaseExpired: 1, IssueUnpublishedQueued: 1, IssueRetryingUnscheduled: 1, IssueMissingData: 1}
+	for issue, n := range want {
+		if report.Counts[issue] != n {
+			t.Fatalf("counts = %v", report.Counts)
+		}
+	}
+	for _, f := range report.Findings {
+		if f.Repaired {
+			t.Fatalf("dry run repaired %+v", f)
+		}
+	}
+	if members, _ := mr.ZMembers(keys.RetryJobsKey()); len(members) != 1 {
+		t.Fatalf("retry:jobs = %v", members)
+	}
+}
+
+func TestRunRepairs(t *testing.T) {
+	r, mr := newReconciler(t)
+	seedDrift(t, mr)
+
+	report, err := r.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for _, f := range report.Findings {
+		if !f.Repaired {
+			t.Fatalf("not repaired: %+v", f)
+		}
+	}
+	for _, id := range []string{"stuck", "abandoned", "lost", "orphan"} {
+		if _, err := mr.ZScore(keys.RetryJobsKey(), id); err != nil {
+			t.Fatalf("%s not scheduled: %v", id, err)
+		}
+	}
+	if status, _ := mr.Get(keys.JobKey("stuck")); status != "retrying" {
+		t.Fatalf("stuck status = %q", status)
+	}
+	if status, _ := mr.Get(keys.JobKey("lost")); status != "queued" {
+		t.Fatalf("lost status = %q", status)
+	}
+	if status, _ := mr.Get(keys.JobKey("nodata")); status != "dlq" {
+		t.Fatalf("nodata status = %q", status)
+	}
+	if members, _ := mr.ZMembers(keys.TenantQueuedJobsKey("team-a")); len(members) != 0 {
+		t.Fatalf("quota not released: %v", members)
+	}
+	for _, id := range []string{"busy", "leased"} {
+		if status, _ := mr.Get(keys.JobKey(id)); status != "processing" {
+			t.Fatalf("%s status = %q", id, status)
+		}
+	}
+}
+
+func TestRepairSkipsWhenStatusChanged(t *testing.T) {
+	r, mr := newReconciler(t)
+	seed(mr, "stuck", "processing", time.Hour, true)
+	f, drifted, err := r.inspect(context.Background(), "stuck")
+	if err != nil || !drifted {
+		t.Fatalf("drifted=%v err=%v", drifted, err)
+	}
+	mr.Set(keys.JobKey("stuck"), "done")
+	r.repair(context.Background(), &f)
+	if f.Repaired || f.Error == "" {
+		t.Fatalf("finding = %+v", f)
+	}
+	if status, _ := mr.Get(keys.JobKey("stuck")); status != "done" {
+		t.Fatalf("status = %q", status)
+	}
+}
+
+func TestStuckProcessingWithLiveLeaseIsOnlyReported(t *testing.T) {
+	r, mr := newReconciler(t)
+	seed(mr, "overrun", "processing", time.Hour, true)
+	mr.Set(keys.JobLeaseKey("overrun"), "w1")
+
+	report, err := r.Run(context.Background(), false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(report.Findings) != 1 {
+		t.Fatalf("findings = %+v", report.Findings)
+	}
+	if f := report.Findings[0]; f.Issue != IssueStuckProcessing || f.Action != ActionNone || f.Repaired {
+		t.Fatalf("finding = %+v", f)
+	}
+	if status, _ := mr.Get(keys.JobKey("overrun")); status != "processing" {
+		t.Fatalf("status = %q", status)
+	}
+	if _, err := mr.ZScore(keys.RetryJobsKey(), "overrun"); err == nil {
+		t.Fatalf("overrun was scheduled")
+	}
+}
+
+func TestAgeFallsBackToStatusTTL(t *testing.T) {
+	r, _ := newReconciler(t)
+	if got := r.age(nil, rediskeys.JobStatusTTL-time.Hour); got != time.Hour {
+		t.Fatalf("age = %v", got)
+	}
+}
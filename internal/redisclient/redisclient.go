@@ -0,0 +1,169 @@
+// Package redisclient builds the Redis client every binary shares, for a
+// single node, a Sentinel-managed master or a Redis Cluster.
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/tlsconfig"
+)
+
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+
+	// DefaultClusterHashTag is used in cluster mode when hash_tag is unset.
+	DefaultClusterHashTag = "mq"
+)
+
+// Config selects the topology. Single mode dials Addr; sentinel mode asks
+// the sentinels in Addrs for MasterName; cluster mode seeds from Addrs.
+type Config struct {
+	Mode             string   `yaml:"mode"`
+	Addr             string   `yaml:"addr"`
+	Addrs            []string `yaml:"addrs"`
+	MasterName       string   `yaml:"master_name"`
+	SentinelPassword string   `yaml:"sentinel_password" secret:"true"`
+	// Username selects a Redis 6 ACL user; empty means the default user.
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+	DB       int    `yaml:"db"`
+	// HashTag keeps every job-lifecycle key in one cluster slot; see
+	// rediskeys.Keys.
+	HashTag string `yaml:"hash_tag"`
+	// Namespace prefixes every key so environments can share one Redis; see
+	// rediskeys.Keys.
+	Namespace string `yaml:"namespace"`
+	// TTL overrides the job key TTLs; zero fields keep the defaults.
+	TTL rediskeys.TTL `yaml:"ttl"`
+	// TLS applies to the data nodes and, in sentinel mode, the sentinels.
+	TLS tlsconfig.Config `yaml:"tls"`
+}
+
+// ApplyDefaults fills in the mode and, for clusters, the hash tag.
+func (c *Config) ApplyDefaults() {
+	if strings.TrimSpace(c.Mode) == "" {
+		c.Mode = ModeSingle
+	}
+	if c.Mode == ModeCluster && c.HashTag == "" {
+		c.HashTag = DefaultClusterHashTag
+	}
+}
+
+func (c Config) Validate() error {
+	if strings.ContainsAny(c.HashTag, "{}") {
+		return fmt.Errorf("redis.hash_tag must not contain braces")
+	}
+	if err := rediskeys.ValidateNamespace(c.Namespace); err != nil {
+		return err
+	}
+	if err := c.TTL.Validate(); err != nil {
+		return err
+	}
+	if err := c.TLS.Validate("redis.tls"); err != nil {
+		return err
+	}
+	switch c.Mode {
+	case "", ModeSingle:
+		if strings.TrimSpace(c.Addr) == "" {
+			return fmt.Errorf("redis.addr is required")
+		}
+	case ModeSentinel:
+		if len(c.Addrs) == 0 {
+			return fmt.Errorf("redis.addrs is required in sentinel mode")
+		}
+		if strings.TrimSpace(c.MasterName) == "" {
+			return fmt.Errorf("redis.master_name is required in sentinel mode")
+		}
+	case ModeCluster:
+		if len(c.Addrs) == 0 {
+			return fmt.Errorf("redis.addrs is required in cluster mode")
+		}
+		if c.DB != 0 {
+			return fmt.Errorf("redis.db must be 0 in cluster mode")
+		}
+		if c.HashTag == "" {
+			return fmt.Errorf("redis.hash_tag is required in cluster mode")
+		}
+	default:
+		return fmt.Errorf("redis.mode %q is not one of single, sentinel, cluster", c.Mode)
+	}
+	return nil
+}
+
+// Describe is a short form of the topology for startup logs.
+func (c Config) Describe() string {
+	switch c.Mode {
+	case ModeSentinel:
+		return fmt.Sprintf("sentinel master=%s sentinels=%v", c.MasterName, c.Addrs)
+	case ModeCluster:
+		return fmt.Sprintf("cluster seeds=%v", c.Addrs)
+	default:
+		return c.Addr
+	}
+}
+
+func (c Config) universalOptions() (*redis.UniversalOptions, error) {
+	tlsCfg, err := c.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("redis tls: %w", err)
+	}
+	return &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		SentinelPassword: c.SentinelPassword,
+		Username:         c.Username,
+		Password:         c.Password,
+		DB:               c.DB,
+		TLSConfig:        tlsCfg,
+	}, nil
+}
+
+// New builds the client for cfg.Mode. The mode is explicit rather than
+// guessed from the address count: a cluster seeded from one node is still a
+// cluster.
+func New(cfg Config) (redis.UniversalClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	opts, err := cfg.universalOptions()
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Mode {
+	case ModeSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		opts.Addrs = []string{cfg.Addr}
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+// Keys is the key layout for cfg.HashTag and cfg.Namespace. Every component
+// that touches Redis takes it from here, so every binary reading the same
+// config agrees on key names.
+func (c Config) Keys() rediskeys.Keys {
+	return rediskeys.Keys{Namespace: c.Namespace, HashTag: c.HashTag}
+}
+
+// ScanClient returns the client to SCAN the job keyspace with. A cluster
+// client sends SCAN to an arbitrary node, so it is narrowed to the master
+// that owns the hash tag's slot, where all job keys live.
+func ScanClient(ctx context.Context, client redis.UniversalClient, keys rediskeys.Keys) (redis.UniversalClient, error) {
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return client, nil
+	}
+	if keys.HashTag == "" {
+		return nil, fmt.Errorf("scanning a cluster needs a redis.hash_tag")
+	}
+	return cluster.MasterForKey(ctx, keys.JobKey(""))
+}
@@ -0,0 +1,130 @@
+package redisclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/tlsconfig"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	var cfg Config
+	cfg.ApplyDefaults()
+	if cfg.Mode != ModeSingle || cfg.HashTag != "" {
+		t.Fatalf("defaults = %+v", cfg)
+	}
+	cfg = Config{Mode: ModeCluster}
+	cfg.ApplyDefaults()
+	if cfg.HashTag != DefaultClusterHashTag {
+		t.Fatalf("cluster hash tag = %q", cfg.HashTag)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"single", Config{Addr: "localhost:6379"}, true},
+		{"single without addr", Config{Mode: ModeSingle}, false},
+		{"sentinel", Config{Mode: ModeSentinel, Addrs: []string{"s1:26379"}, MasterName: "mq"}, true},
+		{"sentinel without master", Config{Mode: ModeSentinel, Addrs: []string{"s1:26379"}}, false},
+		{"sentinel without addrs", Config{Mode: ModeSentinel, MasterName: "mq"}, false},
+		{"cluster", Config{Mode: ModeCluster, Addrs: []string{"n1:6379"}, HashTag: "mq"}, true},
+		{"cluster without tag", Config{Mode: ModeCluster, Addrs: []string{"n1:6379"}}, false},
+		{"cluster with db", Config{Mode: ModeCluster, Addrs: []string{"n1:6379"}, HashTag: "mq", DB: 1}, false},
+		{"braces in tag", Config{Addr: "localhost:6379", HashTag: "{mq}"}, false},
+		{"unknown mode", Config{Mode: "ring", Addr: "localhost:6379"}, false},
+		{"namespace", Config{Addr: "localhost:6379", Namespace: "staging"}, true},
+		{"namespace with separator", Config{Addr: "localhost:6379", Namespace: "mq:staging"}, false},
+		{"data outlived by status", Config{Addr: "localhost:6379", TTL: rediskeys.TTL{JobData: time.Hour}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestNewPicksClientForMode(t *testing.T) {
+	single, err := New(Config{Addr: "localhost:6379"})
+	if err != nil {
+		t.Fatalf("New(single): %v", err)
+	}
+	defer single.Close()
+	if _, ok := single.(*redis.Client); !ok {
+		t.Fatalf("single mode client = %T", single)
+	}
+
+	cluster, err := New(Config{Mode: ModeCluster, Addrs: []string{"localhost:7000"}, HashTag: "mq"})
+	if err != nil {
+		t.Fatalf("New(cluster): %v", err)
+	}
+	defer cluster.Close()
+	if _, ok := cluster.(*redis.ClusterClient); !ok {
+		t.Fatalf("cluster mode client = %T", cluster)
+	}
+
+	if _, err := New(Config{Mode: ModeSentinel}); err == nil {
+		t.Fatalf("expected validation error")
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	keys := Config{Namespace: "staging", HashTag: "mq"}.Keys()
+	if got := keys.JobKey("j1"); got != "staging:{mq}:job:j1" {
+		t.Fatalf("JobKey() = %q", got)
+	}
+	if got := (Config{}).Keys().JobKey("j1"); got != "job:j1" {
+		t.Fatalf("plain JobKey() = %q", got)
+	}
+}
+
+func TestSingleNodeRoundTrip(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := New(Config{Mode: ModeSingle, Addr: mr.Addr(), DB: 2})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+	if err := client.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	mr.Select(2)
+	if got, _ := mr.Get("k"); got != "v" {
+		t.Fatalf("db 2 value = %q", got)
+	}
+	scan, err := ScanClient(ctx, client, rediskeys.Keys{})
+	if err != nil || scan != client {
+		t.Fatalf("ScanClient = %v, %v; want the client itself", scan, err)
+	}
+}
+
+func TestNewAppliesTLS(t *testing.T) {
+	client, err := New(Config{Addr: "localhost:6380", Username: "mq", TLS: tlsconfig.Config{Enabled: true, ServerName: "redis.internal"}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer client.Close()
+	opts := client.(*redis.Client).Options()
+	if opts.TLSConfig == nil || opts.TLSConfig.ServerName != "redis.internal" || opts.Username != "mq" {
+		t.Fatalf("options = %+v", opts)
+	}
+
+	if _, err := New(Config{Addr: "localhost:6380", TLS: tlsconfig.Config{Enabled: true, CAFile: "/nonexistent/ca.pem"}}); err == nil {
+		t.Fatalf("expected error for a missing CA file")
+	}
+}
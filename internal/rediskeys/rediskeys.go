@@ -1,17 +1,43 @@
 package rediskeys
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	JobKeyPrefix         = "job:"
 	JobDataKeyPrefix     = "job:data:"
 	AttemptKeyPrefix     = "job:attempt:"
+	JobMetaKeyPrefix     = "job:meta:"
+	JobLeaseKeyPrefix    = "job:lease:"
 	IdempotencyKeyPrefix = "idem:"
 
-	RetryJobsKey = "retry:jobs"
-	RetryLockKey = "retry:lock"
+	TenantKeyPrefix  = "tenant:"
+	QueuedJobsKey    = "quota:queued"
+	SubmitRatePrefix = "quota:rate:"
+	RateLimitPrefix  = "ratelimit:"
+
+	ThrottleSlotsPrefix = "throttle:slots:"
+	ThrottleRatePrefix  = "throttle:rate:"
+
+	retryJobsKey = "retry:jobs"
+	retryLockKey = "retry:lock"
+
+	outboxKey = "outbox:jobs"
+
+	payloadUploadsKey = "payload:uploads"
+
+	schemasKey = "schema:registry"
+
+	WorkerHeartbeatPrefix = "worker:hb:"
+	workersKey            = "worker:registry"
 )
 
+// Default TTLs, used for any TTL field left at zero.
 const (
 	DedupeTTL    = 72 * time.Hour
 	JobStatusTTL = 14 * 24 * time.Hour
@@ -19,18 +45,233 @@ const (
 	DLQTTL       = 14 * 24 * time.Hour
 )
 
-func JobKey(id string) string {
-	return JobKeyPrefix + id
+// TTL sets how long job keys live: Dedupe for idem:<key>, JobStatus for
+// job:<id> while the job is live or done, JobData for job:data:<id> and its
+// meta and attempt keys, and DLQ for job:<id> once the job is dead-lettered.
+type TTL struct {
+	Dedupe    time.Duration `yaml:"dedupe"`
+	JobStatus time.Duration `yaml:"job_status"`
+	JobData   time.Duration `yaml:"job_data"`
+	DLQ       time.Duration `yaml:"dlq"`
+}
+
+func DefaultTTL() TTL {
+	return TTL{Dedupe: DedupeTTL, JobStatus: JobStatusTTL, JobData: JobDataTTL, DLQ: DLQTTL}
+}
+
+// WithDefaults fills zero fields from DefaultTTL.
+func (t TTL) WithDefaults() TTL {
+	d := DefaultTTL()
+	if t.Dedupe == 0 {
+		t.Dedupe = d.Dedupe
+	}
+	if t.JobStatus == 0 {
+		t.JobStatus = d.JobStatus
+	}
+	if t.JobData == 0 {
+		t.JobData = d.JobData
+	}
+	if t.DLQ == 0 {
+		t.DLQ = d.DLQ
+	}
+	return t
+}
+
+// Validate requires the payload to outlive the status, so a retry or a DLQ
+// replay never finds a live job without its data.
+func (t TTL) Validate() error {
+	fields := []struct {
+		name string
+		d    time.Duration
+	}{{"dedupe", t.Dedupe}, {"job_status", t.JobStatus}, {"job_data", t.JobData}, {"dlq", t.DLQ}}
+	for _, f := range fields {
+		if f.d < 0 {
+			return fmt.Errorf("redis.ttl.%s must not be negative", f.name)
+		}
+	}
+	t = t.WithDefaults()
+	if t.JobData < t.JobStatus {
+		return fmt.Errorf("redis.ttl.job_data (%s) must be at least redis.ttl.job_status (%s)", t.JobData, t.JobStatus)
+	}
+	if t.JobData < t.DLQ {
+		return fmt.Errorf("redis.ttl.job_data (%s) must be at least redis.ttl.dlq (%s)", t.JobData, t.DLQ)
+	}
+	return nil
+}
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// ValidateNamespace accepts "" (no namespace) or a short name without the
+// ':' separator or hash-tag braces.
+func ValidateNamespace(ns string) error {
+	if ns != "" && !namespacePattern.MatchString(ns) {
+		return fmt.Errorf("redis.namespace %q must be 1-32 of A-Z a-z 0-9 . _ -", ns)
+	}
+	return nil
+}
+
+// Keys builds the key layout of one deployment. Every binary derives it from
+// the same redis config (redisclient.Config.Keys) and hands it to the
+// components that touch Redis, as it does for TTL. The zero value is the
+// plain layout.
+//
+// Namespace prefixes every key, tagged or not, with "<ns>:", so several
+// environments can share one Redis without seeing each other's jobs.
+//
+// HashTag puts every job-lifecycle key into the {tag} Redis Cluster hash
+// slot, so WATCH/MULTI and scripts spanning a job's keys, the idempotency
+// key, the tenant quota sets and retry:jobs/outbox:jobs stay on one node.
+// Rate limit and throttle buckets are single-key and stay untagged.
+type Keys struct {
+	Namespace string
+	HashTag   string
+}
+
+// plain namespaces a key that is not hash-tagged.
+func (k Keys) plain(key string) string {
+	if k.Namespace == "" {
+		return key
+	}
+	return k.Namespace + ":" + key
+}
+
+// tagged places the hash tag after the namespace; Redis Cluster hashes the
+// first {...} wherever it appears, so the slot does not depend on it.
+func (k Keys) tagged(key string) string {
+	if k.HashTag == "" {
+		return k.plain(key)
+	}
+	return k.plain("{" + k.HashTag + "}:" + key)
+}
+
+// Untag strips the namespace and hash tag prefixes, if any.
+func (k Keys) Untag(key string) string {
+	if k.Namespace != "" {
+		key = strings.TrimPrefix(key, k.Namespace+":")
+	}
+	if k.HashTag == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, "{"+k.HashTag+"}:")
+}
+
+func (k Keys) JobKey(id string) string {
+	return k.tagged(JobKeyPrefix + id)
+}
+
+// JobScanPattern matches job:<id> and its companion keys for SCAN. Under a
+// hash tag they all live on the node that owns the tag's slot.
+func (k Keys) JobScanPattern() string {
+	return k.tagged(JobKeyPrefix) + "*"
+}
+
+// StatusKeyJobID picks job:<id> out of the job:* keyspace, skipping the
+// job:data:, job:meta: and similar companion keys.
+func (k Keys) StatusKeyJobID(key string) (string, bool) {
+	key = k.Untag(key)
+	id := strings.TrimPrefix(key, JobKeyPrefix)
+	if id == key || id == "" || strings.Contains(id, ":") {
+		return "", false
+	}
+	return id, true
+}
+
+func (k Keys) JobDataKey(id string) string {
+	return k.tagged(JobDataKeyPrefix + id)
+}
+
+func (k Keys) AttemptKey(id string) string {
+	return k.tagged(AttemptKeyPrefix + id)
+}
+
+func (k Keys) JobMetaKey(id string) string {
+	return k.tagged(JobMetaKeyPrefix + id)
+}
+
+// JobLeaseKey holds the id of the worker currently processing the job; the
+// key's TTL is the lease expiry.
+func (k Keys) JobLeaseKey(id string) string {
+	return k.tagged(JobLeaseKeyPrefix + id)
+}
+
+// WorkerHeartbeatKey is a hash (started_at, last_seen) that expires when the
+// worker stops heartbeating.
+func (k Keys) WorkerHeartbeatKey(workerID string) string {
+	return k.tagged(WorkerHeartbeatPrefix + workerID)
+}
+
+// WorkersKey is a ZSET of worker ids scored by last heartbeat (ms).
+func (k Keys) WorkersKey() string {
+	return k.tagged(workersKey)
+}
+
+// RetryJobsKey is a ZSET of job ids scored by when they are due (ms).
+func (k Keys) RetryJobsKey() string {
+	return k.tagged(retryJobsKey)
+}
+
+func (k Keys) RetryLockKey() string {
+	return k.tagged(retryLockKey)
+}
+
+// OutboxKey is a ZSET of job ids not yet confirmed on Kafka.
+func (k Keys) OutboxKey() string {
+	return k.tagged(outboxKey)
+}
+
+// PayloadUploadsKey is a ZSET of POST /payloads refs not yet used by a job,
+// scored by upload time (ms).
+func (k Keys) PayloadUploadsKey() string {
+	return k.tagged(payloadUploadsKey)
+}
+
+func (k Keys) IdempotencyKey(key string) string {
+	return k.tagged(IdempotencyKeyPrefix + key)
+}
+
+// ForTenant prefixes a key with its tenant namespace. The default tenant has
+// an empty ID and keeps the un-prefixed layout.
+func ForTenant(tenant, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return TenantKeyPrefix + tenant + ":" + key
+}
+
+func (k Keys) TenantIdempotencyKey(tenant, key string) string {
+	return k.tagged(ForTenant(tenant, IdempotencyKeyPrefix+key))
+}
+
+// TenantQueuedJobsKey is a ZSET of the tenant's non-terminal jobs scored by
+// submission time (ms).
+func (k Keys) TenantQueuedJobsKey(tenant string) string {
+	return k.tagged(ForTenant(tenant, QueuedJobsKey))
+}
+
+// TenantSubmitRateKey counts submissions within one window (unix seconds).
+func (k Keys) TenantSubmitRateKey(tenant string, window int64) string {
+	return k.tagged(ForTenant(tenant, SubmitRatePrefix+strconv.FormatInt(window, 10)))
+}
+
+// RateLimitKey is the token bucket for one rule and its dimension values,
+// e.g. ratelimit:<rule>:<client>:<type>.
+func (k Keys) RateLimitKey(rule string, values ...string) string {
+	return k.plain(RateLimitPrefix + strings.Join(append([]string{rule}, values...), ":"))
 }
 
-func JobDataKey(id string) string {
-	return JobDataKeyPrefix + id
+// ThrottleSlotsKey is a ZSET of job ids currently holding a worker slot for
+// a job type, scored by lease expiry (ms).
+func (k Keys) ThrottleSlotsKey(jobType string) string {
+	return k.plain(ThrottleSlotsPrefix + jobType)
 }
 
-func AttemptKey(id string) string {
-	return AttemptKeyPrefix + id
+// ThrottleRateKey is the worker-side token bucket for a job type.
+func (k Keys) ThrottleRateKey(jobType string) string {
+	return k.plain(ThrottleRatePrefix + jobType)
 }
 
-func IdempotencyKey(key string) string {
-	return IdempotencyKeyPrefix + key
+// SchemasKey is a hash of job type to the JSON Schema registered for it
+// through /admin/schemas. It is single-key and stays untagged.
+func (k Keys) SchemasKey() string {
+	return k.plain(schemasKey)
 }
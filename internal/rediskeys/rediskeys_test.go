@@ -5,16 +5,30 @@ import (
 	"time"
 )
 
+// keys is the plain layout; tests of other layouts shadow it.
+var keys Keys
+
 func TestJobKey(t *testing.T) {
-	got := JobKey("abc")
+	got := keys.JobKey("abc")
 	want := "job:abc"
 	if got != want {
 		t.Fatalf("JobKey() = %q, want %q", got, want)
 	}
 }
 
+func TestStatusKeyJobID(t *testing.T) {
+	if id, ok := keys.StatusKeyJobID("job:abc"); !ok || id != "abc" {
+		t.Fatalf("StatusKeyJobID(job:abc) = %q, %v", id, ok)
+	}
+	for _, key := range []string{"job:data:abc", "job:meta:abc", "job:", "retry:jobs"} {
+		if _, ok := keys.StatusKeyJobID(key); ok {
+			t.Fatalf("StatusKeyJobID(%q) should not match", key)
+		}
+	}
+}
+
 func TestJobDataKey(t *testing.T) {
-	got := JobDataKey("xyz")
+	got := keys.JobDataKey("xyz")
 	want := "job:data:xyz"
 	if got != want {
 		t.Fatalf("JobDataKey() = %q, want %q", got, want)
@@ -22,7 +36,7 @@ func TestJobDataKey(t *testing.T) {
 }
 
 func TestIdempotencyKey(t *testing.T) {
-	got := IdempotencyKey("k1")
+	got := keys.IdempotencyKey("k1")
 	want := "idem:k1"
 	if got != want {
 		t.Fatalf("IdempotencyKey() = %q, want %q", got, want)
@@ -30,13 +44,51 @@ func TestIdempotencyKey(t *testing.T) {
 }
 
 func TestAttemptKey(t *testing.T) {
-	got := AttemptKey("job1")
+	got := keys.AttemptKey("job1")
 	want := "job:attempt:job1"
 	if got != want {
 		t.Fatalf("AttemptKey() = %q, want %q", got, want)
 	}
 }
 
+func TestJobMetaKey(t *testing.T) {
+	got := keys.JobMetaKey("job1")
+	want := "job:meta:job1"
+	if got != want {
+		t.Fatalf("JobMetaKey() = %q, want %q", got, want)
+	}
+}
+
+func TestLeaseAndHeartbeatKeys(t *testing.T) {
+	if got := keys.JobLeaseKey("job1"); got != "job:lease:job1" {
+		t.Fatalf("JobLeaseKey() = %q", got)
+	}
+	if got := keys.WorkerHeartbeatKey("w1"); got != "worker:hb:w1" {
+		t.Fatalf("WorkerHeartbeatKey() = %q", got)
+	}
+}
+
+func TestTenantKeys(t *testing.T) {
+	cases := []struct {
+		got  string
+		want string
+	}{
+		{keys.TenantIdempotencyKey("", "k1"), "idem:k1"},
+		{keys.TenantIdempotencyKey("team-a", "k1"), "tenant:team-a:idem:k1"},
+		{keys.TenantQueuedJobsKey(""), "quota:queued"},
+		{keys.TenantQueuedJobsKey("team-a"), "tenant:team-a:quota:queued"},
+		{keys.TenantSubmitRateKey("team-a", 42), "tenant:team-a:quota:rate:42"},
+		{keys.RateLimitKey("per-type", "team-a", "email"), "ratelimit:per-type:team-a:email"},
+		{keys.ThrottleSlotsKey("email"), "throttle:slots:email"},
+		{keys.ThrottleRateKey("email"), "throttle:rate:email"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Fatalf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+}
+
 func TestConstants(t *testing.T) {
 	if JobKeyPrefix != "job:" {
 		t.Fatalf("JobKeyPrefix = %q, want %q", JobKeyPrefix, "job:")
@@ -47,14 +99,17 @@ func TestConstants(t *testing.T) {
 	if AttemptKeyPrefix != "job:attempt:" {
 		t.Fatalf("AttemptKeyPrefix = %q, want %q", AttemptKeyPrefix, "job:attempt:")
 	}
+	if JobMetaKeyPrefix != "job:meta:" {
+		t.Fatalf("JobMetaKeyPrefix = %q, want %q", JobMetaKeyPrefix, "job:meta:")
+	}
 	if IdempotencyKeyPrefix != "idem:" {
 		t.Fatalf("IdempotencyKeyPrefix = %q, want %q", IdempotencyKeyPrefix, "idem:")
 	}
-	if RetryJobsKey != "retry:jobs" {
-		t.Fatalf("RetryJobsKey = %q, want %q", RetryJobsKey, "retry:jobs")
+	if keys.RetryJobsKey() != "retry:jobs" {
+		t.Fatalf("RetryJobsKey() = %q, want %q", keys.RetryJobsKey(), "retry:jobs")
 	}
-	if RetryLockKey != "retry:lock" {
-		t.Fatalf("RetryLockKey = %q, want %q", RetryLockKey, "retry:lock")
+	if keys.RetryLockKey() != "retry:lock" {
+		t.Fatalf("RetryLockKey() = %q, want %q", keys.RetryLockKey(), "retry:lock")
 	}
 
 	if DedupeTTL != 72*time.Hour {
@@ -70,3 +125,97 @@ func TestConstants(t *testing.T) {
 		t.Fatalf("DLQTTL = %v, want 14d", DLQTTL)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	got := TTL{Dedupe: time.Hour}.WithDefaults()
+	if got.Dedupe != time.Hour || got.JobStatus != JobStatusTTL || got.JobData != JobDataTTL || got.DLQ != DLQTTL {
+		t.Fatalf("WithDefaults() = %+v", got)
+	}
+	cases := []struct {
+		ttl TTL
+		ok  bool
+	}{
+		{TTL{}, true},
+		{TTL{JobStatus: 24 * time.Hour, JobData: 48 * time.Hour, DLQ: 48 * time.Hour}, true},
+		{TTL{Dedupe: -time.Second}, false},
+		// Data would expire before the default status TTL.
+		{TTL{JobData: 24 * time.Hour}, false},
+		{TTL{JobStatus: time.Hour, DLQ: 30 * 24 * time.Hour}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.ttl.Validate(); (err == nil) != tc.ok {
+			t.Fatalf("Validate(%+v) = %v, want ok=%v", tc.ttl, err, tc.ok)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	keys := Keys{Namespace: "staging"}
+
+	if got := keys.JobKey("j1"); got != "staging:job:j1" {
+		t.Fatalf("JobKey() = %q", got)
+	}
+	if got := keys.RateLimitKey("r", "c"); got != "staging:ratelimit:r:c" {
+		t.Fatalf("RateLimitKey() = %q", got)
+	}
+	if got := keys.SchemasKey(); got != "staging:schema:registry" {
+		t.Fatalf("SchemasKey() = %q", got)
+	}
+
+	keys = Keys{Namespace: "staging", HashTag: "mq"}
+	if got := keys.JobKey("j1"); got != "staging:{mq}:job:j1" {
+		t.Fatalf("tagged JobKey() = %q", got)
+	}
+	if got := keys.JobScanPattern(); got != "staging:{mq}:job:*" {
+		t.Fatalf("JobScanPattern() = %q", got)
+	}
+	if id, ok := keys.StatusKeyJobID("staging:{mq}:job:abc"); !ok || id != "abc" {
+		t.Fatalf("StatusKeyJobID = %q, %v", id, ok)
+	}
+	if got := keys.ThrottleRateKey("email"); got != "staging:throttle:rate:email" {
+		t.Fatalf("ThrottleRateKey() = %q", got)
+	}
+
+	for _, ns := range []string{"a:b", "{x}", "has space"} {
+		if err := ValidateNamespace(ns); err == nil {
+			t.Fatalf("ValidateNamespace(%q) should fail", ns)
+		}
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	keys := Keys{HashTag: "mq"}
+
+	cases := []struct {
+		got  string
+		want string
+	}{
+		{keys.JobKey("j1"), "{mq}:job:j1"},
+		{keys.JobDataKey("j1"), "{mq}:job:data:j1"},
+		{keys.JobMetaKey("j1"), "{mq}:job:meta:j1"},
+		{keys.AttemptKey("j1"), "{mq}:job:attempt:j1"},
+		{keys.JobLeaseKey("j1"), "{mq}:job:lease:j1"},
+		{keys.TenantIdempotencyKey("", "k1"), "{mq}:idem:k1"},
+		{keys.TenantIdempotencyKey("team-a", "k1"), "{mq}:tenant:team-a:idem:k1"},
+		{keys.TenantQueuedJobsKey("team-a"), "{mq}:tenant:team-a:quota:queued"},
+		{keys.TenantSubmitRateKey("team-a", 42), "{mq}:tenant:team-a:quota:rate:42"},
+		{keys.RetryJobsKey(), "{mq}:retry:jobs"},
+		{keys.OutboxKey(), "{mq}:outbox:jobs"},
+		{keys.WorkersKey(), "{mq}:worker:registry"},
+		{keys.WorkerHeartbeatKey("w1"), "{mq}:worker:hb:w1"},
+		{keys.JobScanPattern(), "{mq}:job:*"},
+		{keys.RateLimitKey("r", "c"), "ratelimit:r:c"},
+		{keys.ThrottleSlotsKey("email"), "throttle:slots:email"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Fatalf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+	if id, ok := keys.StatusKeyJobID("{mq}:job:abc"); !ok || id != "abc" {
+		t.Fatalf("StatusKeyJobID({mq}:job:abc) = %q, %v", id, ok)
+	}
+	if _, ok := keys.StatusKeyJobID("{mq}:job:meta:abc"); ok {
+		t.Fatalf("companion key should not match")
+	}
+}
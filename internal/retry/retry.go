@@ -7,9 +7,9 @@ import (
 )
 
 type Config struct {
-	Base   time.Duration
-	Max    time.Duration
-	Jitter float64
+	Base   time.Duration `yaml:"base"`
+	Max    time.Duration `yaml:"max"`
+	Jitter float64       `yaml:"jitter"`
 }
 
 func DefaultConfig() Config {
@@ -20,6 +20,22 @@ func DefaultConfig() Config {
 	}
 }
 
+// WithDefaults returns DefaultConfig for an unset config and otherwise fills
+// a zero Base or Max. Jitter is kept as given, so 0 turns it off.
+func (c Config) WithDefaults() Config {
+	def := DefaultConfig()
+	if c == (Config{}) {
+		return def
+	}
+	if c.Base == 0 {
+		c.Base = def.Base
+	}
+	if c.Max == 0 {
+		c.Max = def.Max
+	}
+	return c
+}
+
 func (c Config) Validate() error {
 	if c.Base <= 0 {
 		return errors.New("base must be positive")
@@ -67,3 +67,13 @@ func TestNextScore(t *testing.T) {
 		t.Fatalf("score = %v", score)
 	}
 }
+
+func TestWithDefaults(t *testing.T) {
+	if got := (Config{}).WithDefaults(); got != DefaultConfig() {
+		t.Fatalf("unset config = %+v", got)
+	}
+	got := Config{Max: 5 * time.Minute}.WithDefaults()
+	if got.Base != time.Second || got.Max != 5*time.Minute || got.Jitter != 0 {
+		t.Fatalf("partial config = %+v", got)
+	}
+}
@@ -0,0 +1,261 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+)
+
+const (
+	SourceFile  = "file"
+	SourceAdmin = "admin"
+
+	DefaultRefreshInterval = 30 * time.Second
+
+	// MaxSchemaBytes bounds a schema registered through the admin API.
+	MaxSchemaBytes = 64 << 10
+)
+
+var (
+	ErrNotFound = errors.New("no schema registered for job type")
+	// ErrReadOnly means the type's schema comes from schemas.dir and can only
+	// be changed by redeploying the file.
+	ErrReadOnly = errors.New("schema is defined by a file")
+)
+
+// Config loads <job type>.json files from Dir and names the clients allowed
+// to manage schemas through /admin/schemas. Admin-registered schemas are kept
+// in Redis and picked up by every replica within RefreshInterval.
+type Config struct {
+	Dir             string        `yaml:"dir"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	AdminClients    []string      `yaml:"admin_clients"`
+}
+
+func (c Config) Validate() error {
+	if c.Dir != "" && strings.TrimSpace(c.Dir) == "" {
+		return fmt.Errorf("api.schemas.dir must not be blank")
+	}
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("api.schemas.refresh_interval must not be negative")
+	}
+	for i, id := range c.AdminClients {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("api.schemas.admin_clients[%d] must not be blank", i)
+		}
+	}
+	return nil
+}
+
+// Info describes one registered schema.
+type Info struct {
+	Type   string          `json:"type"`
+	Source string          `json:"source"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+type entry struct {
+	raw    json.RawMessage
+	schema *Schema
+}
+
+// Registry maps job types to schemas. File schemas take precedence over
+// admin-registered ones, which are shared through the schema:registry hash.
+type Registry struct {
+	redis redis.UniversalClient
+	keys  rediskeys.Keys
+
+	mu    sync.RWMutex
+	files map[string]entry
+	admin map[string]entry
+}
+
+// NewRegistry builds a registry backed by redisClient. A nil client keeps
+// admin-registered schemas in this process only.
+func NewRegistry(redisClient redis.UniversalClient, keys rediskeys.Keys) *Registry {
+	return &Registry{redis: redisClient, keys: keys, files: map[string]entry{}, admin: map[string]entry{}}
+}
+
+// LoadDir replaces the file schemas with every <type>.json in dir. Any schema
+// that does not compile fails the whole load, so a bad deploy is caught at
+// startup rather than leaving a type unvalidated.
+func (r *Registry) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	files := make(map[string]entry, len(paths))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read schema: %w", err)
+		}
+		s, err := Compile(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		files[strings.TrimSuffix(filepath.Base(path), ".json")] = entry{raw: raw, schema: s}
+	}
+	r.mu.Lock()
+	r.files = files
+	r.mu.Unlock()
+	return nil
+}
+
+// Validate checks payload against the schema for jobType. Types without a
+// schema are accepted.
+func (r *Registry) Validate(jobType string, payload []byte) ([]FieldError, error) {
+	e, ok := r.lookup(jobType)
+	if !ok {
+		return nil, nil
+	}
+	return e.schema.Validate(payload)
+}
+
+func (r *Registry) lookup(jobType string) (entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if e, ok := r.files[jobType]; ok {
+		return e, true
+	}
+	e, ok := r.admin[jobType]
+	return e, ok
+}
+
+func (r *Registry) Get(jobType string) (Info, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if e, ok := r.files[jobType]; ok {
+		return Info{Type: jobType, Source: SourceFile, Schema: e.raw}, true
+	}
+	if e, ok := r.admin[jobType]; ok {
+		return Info{Type: jobType, Source: SourceAdmin, Schema: e.raw}, true
+	}
+	return Info{}, false
+}
+
+// List returns every registered schema, sorted by job type.
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	out := make([]Info, 0, len(r.files)+len(r.admin))
+	for t, e := range r.files {
+		out = append(out, Info{Type: t, Source: SourceFile, Schema: e.raw})
+	}
+	for t, e := range r.admin {
+		if _, shadowed := r.files[t]; !shadowed {
+			out = append(out, Info{Type: t, Source: SourceAdmin, Schema: e.raw})
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// Put compiles and registers raw for jobType. It is stored in Redis before it
+// takes effect locally, so a failed write changes nothing.
+func (r *Registry) Put(ctx context.Context, jobType string, raw []byte) error {
+	if r.isFile(jobType) {
+		return ErrReadOnly
+	}
+	s, err := Compile(raw)
+	if err != nil {
+		return err
+	}
+	if r.redis != nil {
+		if err := r.redis.HSet(ctx, r.keys.SchemasKey(), jobType, raw).Err(); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.admin[jobType] = entry{raw: append(json.RawMessage(nil), raw...), schema: s}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) Delete(ctx context.Context, jobType string) error {
+	if r.isFile(jobType) {
+		return ErrReadOnly
+	}
+	r.mu.RLock()
+	_, ok := r.admin[jobType]
+	r.mu.RUnlock()
+	if r.redis != nil {
+		removed, err := r.redis.HDel(ctx, r.keys.SchemasKey(), jobType).Result()
+		if err != nil {
+			return err
+		}
+		ok = ok || removed > 0
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	r.mu.Lock()
+	delete(r.admin, jobType)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) isFile(jobType string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.files[jobType]
+	return ok
+}
+
+// Refresh replaces the admin schemas with the contents of schema:registry.
+// An entry that no longer compiles is skipped with a log line, so one bad
+// write cannot disable validation for every other type.
+func (r *Registry) Refresh(ctx context.Context) error {
+	if r.redis == nil {
+		return nil
+	}
+	all, err := r.redis.HGetAll(ctx, r.keys.SchemasKey()).Result()
+	if err != nil {
+		return err
+	}
+	admin := make(map[string]entry, len(all))
+	for jobType, raw := range all {
+		s, err := Compile([]byte(raw))
+		if err != nil {
+			log.Printf("skipping stored schema type=%s: %v", jobType, err)
+			continue
+		}
+		admin[jobType] = entry{raw: json.RawMessage(raw), schema: s}
+	}
+	r.mu.Lock()
+	r.admin = admin
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the admin schemas every interval until ctx is done. A failed
+// refresh keeps the schemas already loaded.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("schema refresh failed: %v", err)
+			}
+		}
+	}
+}
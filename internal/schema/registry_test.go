@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "email.send.json"), []byte(`{"required":["to"]}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := NewRegistry(client, rediskeys.Keys{})
+	if err := r.LoadDir(dir); err != nil {
+		t.Fatalf("load dir: %v", err)
+	}
+
+	if errs, _ := r.Validate("email.send", []byte(`{}`)); len(errs) != 1 {
+		t.Fatalf("file schema errors = %v", errs)
+	}
+	if errs, _ := r.Validate("unregistered", []byte(`{}`)); len(errs) != 0 {
+		t.Fatalf("unregistered type errors = %v", errs)
+	}
+	if err := r.Put(ctx, "email.send", []byte(`{}`)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("put over file schema err = %v", err)
+	}
+	if err := r.Put(ctx, "report", []byte(`{"type":"object","required":["id"]}`)); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := r.Put(ctx, "report", []byte(`{"type":"obj"}`)); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("put invalid err = %v", err)
+	}
+
+	// Another replica picks the admin schema up from Redis.
+	replica := NewRegistry(client, rediskeys.Keys{})
+	if err := replica.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if errs, _ := replica.Validate("report", []byte(`{}`)); len(errs) != 1 {
+		t.Fatalf("replica errors = %v", errs)
+	}
+	if info, ok := replica.Get("report"); !ok || info.Source != SourceAdmin {
+		t.Fatalf("replica get = %+v, %v", info, ok)
+	}
+
+	if err := r.Delete(ctx, "report"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := r.Delete(ctx, "report"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second delete err = %v", err)
+	}
+	if err := replica.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if list := replica.List(); len(list) != 0 {
+		t.Fatalf("replica list = %+v", list)
+	}
+
+	// A bad file fails the load and keeps the schemas already loaded.
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"type":1}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := r.LoadDir(dir); err == nil {
+		t.Fatalf("expected error for broken schema file")
+	}
+	if _, ok := r.Get("email.send"); !ok {
+		t.Fatalf("file schemas dropped by a failed load")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{RefreshInterval: -1}).Validate(); err == nil {
+		t.Fatalf("expected error for negative refresh interval")
+	}
+	if err := (Config{AdminClients: []string{" "}}).Validate(); err == nil {
+		t.Fatalf("expected error for blank admin client")
+	}
+}
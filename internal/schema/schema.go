@@ -0,0 +1,691 @@
+// Package schema validates job payloads against a JSON Schema registered for
+// their job type. It implements the subset of JSON Schema that payload
+// contracts need; a schema using any other keyword is rejected when it is
+// registered rather than silently not enforced.
+//
+// Keywords follow draft 2020-12, whatever $schema says. items is the 2020-12
+// single-schema form; the draft-07 array form is rejected. Not implemented,
+// and so rejected: patternProperties, propertyNames, dependentRequired,
+// dependentSchemas, prefixItems, contains/minContains/maxContains,
+// if/then/else, unevaluatedProperties/unevaluatedItems, multipleOf, remote
+// references, $anchor and $dynamicRef. format is an annotation and is not
+// checked.
+//
+// pattern is compiled with Go's regexp (RE2), not as an ECMA-262 regular
+// expression as the specification asks. Like ECMA-262 it matches anywhere in
+// the string unless anchored. Lookaround and backreferences do not exist in
+// RE2, so a pattern using them is rejected at registration. \s matches only
+// ASCII whitespace, where ECMA-262 also matches Unicode spaces. Matching is
+// by code point rather than UTF-16 unit, so "." matches one astral character
+// where ECMA-262 without the u flag sees two. Most patterns written for other
+// validators behave the same; one that relies on these differences must be
+// rewritten.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxErrors bounds the field errors reported for one payload.
+const MaxErrors = 20
+
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// FieldError is one violation. Path is a JSON pointer into the payload; the
+// payload root is "".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// annotations carry no validation meaning and are accepted anywhere.
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "$defs": true, "definitions": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"format": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+var typeNames = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	// never is the false schema; a true schema is an empty Schema.
+	never bool
+
+	types    []string
+	enum     []any
+	hasConst bool
+	constVal any
+
+	properties    map[string]*Schema
+	required      []string
+	additional    *Schema
+	minProperties *int
+	maxProperties *int
+
+	items       *Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+
+	ref *Schema
+}
+
+// Compile parses a schema document. $ref may point into the document's own
+// $defs or definitions ("#/$defs/name"), including recursively.
+func Compile(data []byte) (*Schema, error) {
+	root, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	c := &compiler{root: root, refs: map[string]*Schema{}, paths: map[*Schema]string{}}
+	s, err := c.compile(root, "")
+	if err == nil {
+		err = c.checkCycles(s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	return s, nil
+}
+
+type compiler struct {
+	root any
+	refs map[string]*Schema
+	// paths records where each schema was compiled, for cycle errors.
+	paths map[*Schema]string
+}
+
+func (c *compiler) compile(node any, at string) (*Schema, error) {
+	var s *Schema
+	var err error
+	switch v := node.(type) {
+	case bool:
+		s = &Schema{never: !v}
+	case map[string]any:
+		s, err = c.compileObject(v, at)
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", where(at))
+	}
+	if s != nil {
+		c.paths[s] = at
+	}
+	return s, err
+}
+
+// checkCycles rejects a $ref cycle along which validation never moves into
+// the payload. $ref, allOf, anyOf, oneOf and not apply their subschemas to
+// the same value, so a cycle made only of them recurses forever; a cycle
+// through properties, additionalProperties or items ends with the payload.
+func (c *compiler) checkCycles(root *Schema) error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := map[*Schema]int{}
+	var pending []*Schema
+	seen := map[*Schema]bool{root: true}
+	var walk func(s *Schema) error
+	walk = func(s *Schema) error {
+		switch state[s] {
+		case visiting:
+			return fmt.Errorf("%s: $ref cycle does not descend into properties, additionalProperties or items", where(c.paths[s]))
+		case done:
+			return nil
+		}
+		state[s] = visiting
+		for _, next := range s.sameValue() {
+			if err := walk(next); err != nil {
+				return err
+			}
+		}
+		state[s] = done
+		for _, next := range s.children() {
+			if !seen[next] {
+				seen[next] = true
+				pending = append(pending, next)
+			}
+		}
+		return nil
+	}
+	for pending = append(pending, root); len(pending) > 0; {
+		s := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if err := walk(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameValue lists the subschemas applied to the value s is applied to.
+func (s *Schema) sameValue() []*Schema {
+	out := append(append(append([]*Schema{}, s.allOf...), s.anyOf...), s.oneOf...)
+	if s.not != nil {
+		out = append(out, s.not)
+	}
+	if s.ref != nil {
+		out = append(out, s.ref)
+	}
+	return out
+}
+
+// children lists the subschemas applied to values inside it.
+func (s *Schema) children() []*Schema {
+	out := make([]*Schema, 0, len(s.properties)+2)
+	for _, sub := range s.properties {
+		out = append(out, sub)
+	}
+	if s.additional != nil {
+		out = append(out, s.additional)
+	}
+	if s.items != nil {
+		out = append(out, s.items)
+	}
+	return out
+}
+
+func (c *compiler) compileObject(m map[string]any, at string) (*Schema, error) {
+	s := &Schema{}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val, path := m[key], at+"/"+escape(key)
+		var err error
+		switch key {
+		case "type":
+			s.types, err = compileTypes(val, path)
+		case "enum":
+			list, ok := val.([]any)
+			if !ok || len(list) == 0 {
+				err = fmt.Errorf("%s: must be a non-empty array", where(path))
+			}
+			s.enum = list
+		case "const":
+			s.hasConst, s.constVal = true, val
+		case "properties":
+			props, ok := val.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", where(path))
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, sub := range props {
+				if s.properties[name], err = c.compile(sub, path+"/"+escape(name)); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = stringList(val, path)
+		case "additionalProperties":
+			s.additional, err = c.compile(val, path)
+		case "minProperties":
+			s.minProperties, err = count(val, path)
+		case "maxProperties":
+			s.maxProperties, err = count(val, path)
+		case "items":
+			s.items, err = c.compile(val, path)
+		case "minItems":
+			s.minItems, err = count(val, path)
+		case "maxItems":
+			s.maxItems, err = count(val, path)
+		case "uniqueItems":
+			b, ok := val.(bool)
+			if !ok {
+				err = fmt.Errorf("%s: must be a boolean", where(path))
+			}
+			s.uniqueItems = b
+		case "minLength":
+			s.minLength, err = count(val, path)
+		case "maxLength":
+			s.maxLength, err = count(val, path)
+		case "pattern":
+			p, ok := val.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", where(path))
+			}
+			if s.pattern, err = regexp.Compile(p); err != nil {
+				err = fmt.Errorf("%s: %v", where(path), err)
+			}
+		case "minimum":
+			s.minimum, err = number(val, path)
+		case "maximum":
+			s.maximum, err = number(val, path)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = number(val, path)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = number(val, path)
+		case "allOf":
+			s.allOf, err = c.compileList(val, path)
+		case "anyOf":
+			s.anyOf, err = c.compileList(val, path)
+		case "oneOf":
+			s.oneOf, err = c.compileList(val, path)
+		case "not":
+			s.not, err = c.compile(val, path)
+		case "$ref":
+			ref, ok := val.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", where(path))
+			}
+			s.ref, err = c.resolve(ref, path)
+		default:
+			if !annotations[key] {
+				err = fmt.Errorf("%s: keyword %q is not supported", where(at), key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (c *compiler) compileList(val any, at string) ([]*Schema, error) {
+	list, ok := val.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: must be a non-empty array", where(at))
+	}
+	out := make([]*Schema, len(list))
+	for i, sub := range list {
+		var err error
+		if out[i], err = c.compile(sub, at+"/"+strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// resolve compiles a local reference once. The placeholder is cached before
+// its target is compiled, so recursive schemas terminate.
+func (c *compiler) resolve(ref, at string) (*Schema, error) {
+	if s, ok := c.refs[ref]; ok {
+		return s, nil
+	}
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok || (pointer != "" && !strings.HasPrefix(pointer, "/")) {
+		return nil, fmt.Errorf("%s: only local references (#/$defs/...) are supported", where(at))
+	}
+	node := c.root
+	if pointer != "" {
+		for _, token := range strings.Split(pointer[1:], "/") {
+			m, ok := node.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: %q does not resolve", where(at), ref)
+			}
+			if node, ok = m[unescape(token)]; !ok {
+				return nil, fmt.Errorf("%s: %q does not resolve", where(at), ref)
+			}
+		}
+	}
+	s := &Schema{}
+	c.refs[ref] = s
+	c.paths[s] = pointer
+	target, err := c.compile(node, pointer)
+	if err != nil {
+		return nil, err
+	}
+	*s = *target
+	return s, nil
+}
+
+func compileTypes(val any, at string) ([]string, error) {
+	var names []string
+	switch v := val.(type) {
+	case string:
+		names = []string{v}
+	case []any:
+		var err error
+		if names, err = stringList(v, at); err != nil {
+			return nil, err
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: must be a type name or a non-empty array of them", where(at))
+	}
+	for _, name := range names {
+		if !typeNames[name] {
+			return nil, fmt.Errorf("%s: unknown type %q", where(at), name)
+		}
+	}
+	return names, nil
+}
+
+func stringList(val any, at string) ([]string, error) {
+	list, ok := val.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array of strings", where(at))
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		if out[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("%s: must be an array of strings", where(at))
+		}
+	}
+	return out, nil
+}
+
+func count(val any, at string) (*int, error) {
+	n, ok := val.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", where(at))
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil || i < 0 {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", where(at))
+	}
+	return &i, nil
+}
+
+func number(val any, at string) (*float64, error) {
+	n, ok := val.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", where(at))
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("%s: must be a number", where(at))
+	}
+	return &f, nil
+}
+
+// Validate checks a JSON document and returns up to MaxErrors violations.
+// An error means the document is not JSON at all.
+func (s *Schema) Validate(doc []byte) ([]FieldError, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	var errs []FieldError
+	s.validate(v, "", &errs)
+	if len(errs) > MaxErrors {
+		errs = errs[:MaxErrors]
+	}
+	return errs, nil
+}
+
+func (s *Schema) validate(v any, path string, errs *[]FieldError) {
+	if len(*errs) > MaxErrors {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.never {
+		fail("is not allowed")
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, path, errs)
+	}
+	if len(s.types) > 0 && !matchesType(v, s.types) {
+		fail("must be %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		return
+	}
+	if s.hasConst && !equal(v, s.constVal) {
+		fail("must equal %s", encode(s.constVal))
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, option := range s.enum {
+			if equal(v, option) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", encode(s.enum))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		s.validateObject(v, path, errs, fail)
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if equal(v[i], v[j]) {
+						fail("items %d and %d are equal", j, i)
+					}
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %q", s.pattern.String())
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+			fail("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+			fail("must be < %v", *s.exclusiveMaximum)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, errs)
+	}
+	if len(s.anyOf) > 0 && matching(s.anyOf, v) == 0 {
+		fail("must match at least one anyOf schema")
+	}
+	if len(s.oneOf) > 0 {
+		if n := matching(s.oneOf, v); n != 1 {
+			fail("must match exactly one oneOf schema, matched %d", n)
+		}
+	}
+	if s.not != nil && s.not.matches(v) {
+		fail("must not match the not schema")
+	}
+}
+
+func (s *Schema) validateObject(v map[string]any, path string, errs *[]FieldError, fail func(string, ...any)) {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			*errs = append(*errs, FieldError{Path: path + "/" + escape(name), Message: "is required"})
+		}
+	}
+	if s.minProperties != nil && len(v) < *s.minProperties {
+		fail("must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(v) > *s.maxProperties {
+		fail("must have at most %d properties", *s.maxProperties)
+	}
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := path + "/" + escape(name)
+		if sub, ok := s.properties[name]; ok {
+			sub.validate(v[name], child, errs)
+			continue
+		}
+		if s.additional == nil {
+			continue
+		}
+		if s.additional.never {
+			*errs = append(*errs, FieldError{Path: child, Message: "is not an allowed property"})
+			continue
+		}
+		s.additional.validate(v[name], child, errs)
+	}
+}
+
+func (s *Schema) matches(v any) bool {
+	var errs []FieldError
+	s.validate(v, "", &errs)
+	return len(errs) == 0
+}
+
+func matching(schemas []*Schema, v any) int {
+	n := 0
+	for _, sub := range schemas {
+		if sub.matches(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(v any, types []string) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names v's JSON type; numbers without a fractional part are
+// integers, as JSON Schema defines them.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// equal compares decoded JSON values, treating 1 and 1.0 as equal.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aerr := a.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	case map[string]any:
+		bm, ok := b.(map[string]any)
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := bm[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bl, ok := b.([]any)
+		if !ok || len(a) != len(bl) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// decode keeps numbers as json.Number, so "1.5" is never rounded into an
+// integer before its type is checked.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func encode(v any) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+func where(path string) string {
+	if path == "" {
+		return "schema root"
+	}
+	return path
+}
@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const invoiceSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["invoice_id", "amount", "lines"],
+  "additionalProperties": false,
+  "properties": {
+    "invoice_id": {"type": "string", "pattern": "^inv_[0-9]+$"},
+    "amount": {"type": "number", "exclusiveMinimum": 0},
+    "currency": {"enum": ["EUR", "USD"]},
+    "lines": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/line"}}
+  },
+  "$defs": {
+    "line": {
+      "type": "object",
+      "required": ["sku", "qty"],
+      "properties": {
+        "sku": {"type": "string", "minLength": 1},
+        "qty": {"type": "integer", "minimum": 1}
+      }
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(invoiceSchema))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	valid := `{"invoice_id":"inv_1","amount":9.5,"currency":"EUR","lines":[{"sku":"a","qty":2.0}]}`
+	if errs, err := s.Validate([]byte(valid)); err != nil || len(errs) != 0 {
+		t.Fatalf("valid payload: %v, %v", errs, err)
+	}
+
+	invalid := `{"invoice_id":"x","amount":0,"currency":"GBP","lines":[{"sku":"","qty":1.5}],"note":"hi"}`
+	errs, err := s.Validate([]byte(invalid))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"/amount", "/currency", "/invoice_id", "/lines/0/qty", "/lines/0/sku", "/note"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths = %v, want %v (%v)", paths, want, errs)
+	}
+
+	errs, _ = s.Validate([]byte(`[]`))
+	if len(errs) != 1 || errs[0].Path != "" || errs[0].Message != "must be object, got array" {
+		t.Fatalf("root type errors = %v", errs)
+	}
+	errs, _ = s.Validate([]byte(`{}`))
+	if len(errs) != 3 || errs[0].Path != "/invoice_id" || errs[0].Message != "is required" {
+		t.Fatalf("required errors = %v", errs)
+	}
+	if _, err := s.Validate([]byte(`{`)); err == nil {
+		t.Fatalf("expected error for non-JSON document")
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	s, err := Compile([]byte(`{
+	  "oneOf": [{"type": "integer"}, {"type": "number", "maximum": 10}],
+	  "not": {"const": 3}
+	}`))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cases := map[string]int{`11`: 0, `2.5`: 0, `4`: 1, `3`: 2, `"x"`: 1}
+	for doc, want := range cases {
+		if errs, _ := s.Validate([]byte(doc)); len(errs) != want {
+			t.Fatalf("%s: errors = %v, want %d", doc, errs, want)
+		}
+	}
+
+	tree, err := Compile([]byte(`{"$ref": "#/$defs/node", "$defs": {"node": {
+	  "type": "object",
+	  "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}},
+	  "additionalProperties": {"type": "integer"}
+	}}}`))
+	if err != nil {
+		t.Fatalf("compile recursive: %v", err)
+	}
+	errs, _ := tree.Validate([]byte(`{"v":1,"children":[{"v":2,"children":[{"v":"x"}]}]}`))
+	if len(errs) != 1 || errs[0].Path != "/children/0/children/0/v" {
+		t.Fatalf("recursive errors = %v", errs)
+	}
+}
+
+func TestCompileRejects(t *testing.T) {
+	cases := map[string]string{
+		"unsupported keyword": `{"type": "object", "patternProperties": {}}`,
+		"unknown type":        `{"type": "int"}`,
+		"remote ref":          `{"$ref": "https://example.com/s.json"}`,
+		"dangling ref":        `{"$ref": "#/$defs/missing"}`,
+		"bad pattern":         `{"pattern": "("}`,
+		"negative length":     `{"minLength": -1}`,
+		"not a schema":        `[]`,
+		"not JSON":            `{`,
+	}
+	for name, doc := range cases {
+		if _, err := Compile([]byte(doc)); !errors.Is(err, ErrInvalidSchema) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestCompileRejectsRefCycles(t *testing.T) {
+	cycles := []string{
+		`{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`,
+		`{"$ref": "#"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"anyOf": [{"type": "string"}, {"not": {"$ref": "#"}}]}`,
+		`{"type": "object", "properties": {"a": {"oneOf": [{"$ref": "#/properties/a"}]}}}`,
+	}
+	for _, doc := range cycles {
+		if _, err := Compile([]byte(doc)); !errors.Is(err, ErrInvalidSchema) {
+			t.Fatalf("%s: err = %v", doc, err)
+		}
+	}
+
+	descending := []string{
+		`{"type": "object", "properties": {"next": {"$ref": "#"}}}`,
+		`{"type": "array", "items": {"$ref": "#"}}`,
+		`{"additionalProperties": {"allOf": [{"$ref": "#"}]}}`,
+	}
+	for _, doc := range descending {
+		s, err := Compile([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: compile: %v", doc, err)
+		}
+		if _, err := s.Validate([]byte(`{"next": {"next": {}}}`)); err != nil {
+			t.Fatalf("%s: validate: %v", doc, err)
+		}
+	}
+}
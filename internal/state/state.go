@@ -12,6 +12,7 @@ const (
 	SagaStepFailed    State = "saga_step_failed"
 	SagaCompensating  State = "saga_compensating"
 	SagaCompensated   State = "saga_compensated"
+	Cancelled         State = "cancelled"
 )
 
 var allStates = []State{
@@ -24,11 +25,13 @@ var allStates = []State{
 	SagaStepFailed,
 	SagaCompensating,
 	SagaCompensated,
+	Cancelled,
 }
 
 var transitions = map[State]map[State]bool{
 	Queued: {
 		Processing: true,
+		Cancelled:  true,
 	},
 	Processing: {
 		Done:     true,
@@ -36,6 +39,11 @@ var transitions = map[State]map[State]bool{
 		DLQ:      true,
 	},
 	Retrying: {
+		Queued:    true,
+		Cancelled: true,
+	},
+	// Operator replay puts a dead-lettered job back in the queue.
+	DLQ: {
 		Queued: true,
 	},
 	SagaRunning: {
@@ -68,7 +76,7 @@ func CanTransition(from, to State) bool {
 
 func IsTerminal(s State) bool {
 	switch s {
-	case Done, DLQ:
+	case Done, DLQ, Cancelled:
 		return true
 	default:
 		return false
@@ -12,6 +12,9 @@ func TestCanTransition_AllowsExpected(t *testing.T) {
 		{Processing, Retrying},
 		{Processing, DLQ},
 		{Retrying, Queued},
+		{Queued, Cancelled},
+		{Retrying, Cancelled},
+		{DLQ, Queued},
 		{SagaRunning, SagaStepFailed},
 		{SagaStepFailed, Retrying},
 		{SagaCompensating, SagaCompensated},
@@ -35,6 +38,8 @@ func TestCanTransition_BlocksUnexpected(t *testing.T) {
 		{DLQ, Processing},
 		{Retrying, Processing},
 		{SagaRunning, DLQ},
+		{Processing, Cancelled},
+		{Cancelled, Queued},
 	}
 
 	for _, tc := range cases {
@@ -51,6 +56,9 @@ func TestIsTerminal(t *testing.T) {
 	if !IsTerminal(DLQ) {
 		t.Fatalf("expected DLQ to be terminal")
 	}
+	if !IsTerminal(Cancelled) {
+		t.Fatalf("expected Cancelled to be terminal")
+	}
 	if IsTerminal(Queued) {
 		t.Fatalf("expected Queued to be non-terminal")
 	}
@@ -0,0 +1,13 @@
+package store
+
+import (
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/state"
+)
+
+// Job is the status view of a job returned by GET /jobs/:id.
+type Job struct {
+	ID     string
+	Status state.State
+	Meta   jobmeta.Meta
+}
@@ -3,39 +3,308 @@ package memory
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
 	"mq-redis/internal/store"
 )
 
-// Store is an in-memory implementation of the API Store interface.
+// Operation names passed to a Fault hook.
+const (
+	OpGetJobID      = "get_job_id"
+	OpCreateJob     = "create_job"
+	OpMarkPublished = "mark_published"
+	OpGetJob        = "get_job"
+)
+
+// Fault is consulted before every store operation; a non-nil error makes the
+// operation fail with store.ErrStoreUnavailable, as a Redis outage would.
+type Fault func(op string) error
+
+type idemEntry struct {
+	jobID   string
+	expires time.Time
+}
+
+// job mirrors the Redis keys of one job: job:<id> (status), job:data:<id> and
+// job:meta:<id> (payload, meta), and job:attempt:<id>. Each expires on its
+// own, with the same TTLs as the Redis store.
+type job struct {
+	status         state.State
+	statusExpires  time.Time
+	payload        json.RawMessage
+	meta           jobmeta.Meta
+	dataExpires    time.Time
+	attempts       int64
+	attemptExpires time.Time
+}
+
+// Store is an in-memory implementation of the API Store interface that
+// models the Redis store's keys, TTLs and retry:jobs ZSET.
 type Store struct {
-	mu       sync.RWMutex
-	byKey    map[string]string
-	payloads map[string]json.RawMessage
+	mu     sync.RWMutex
+	now    func() time.Time
+	ttl    rediskeys.TTL
+	fault  Fault
+	idem   map[string]idemEntry
+	jobs   map[string]*job
+	outbox map[string]time.Time
+	retry  map[string]time.Time
 }
 
-func New() *Store {
-	return &Store{
-		byKey:    make(map[string]string),
-		payloads: make(map[string]json.RawMessage),
+type Option func(*Store)
+
+// WithClock sets the time source used for TTL expiry.
+func WithClock(now func() time.Time) Option {
+	return func(s *Store) {
+		s.now = now
 	}
 }
 
-func (s *Store) GetJobIDByIdempotencyKey(ctx context.Context, key string) (string, bool, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	jobID, ok := s.byKey[key]
-	return jobID, ok, nil
+// WithTTL overrides the default key TTLs, as redisstore.WithTTL does.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(s *Store) {
+		s.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithFault installs a fault injection hook.
+func WithFault(f Fault) Option {
+	return func(s *Store) {
+		s.fault = f
+	}
+}
+
+func New(opts ...Option) *Store {
+	s := &Store{
+		now:    time.Now,
+		ttl:    rediskeys.DefaultTTL(),
+		idem:   make(map[string]idemEntry),
+		jobs:   make(map[string]*job),
+		outbox: make(map[string]time.Time),
+		retry:  make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SetFault replaces the fault injection hook; nil clears it.
+func (s *Store) SetFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = f
+}
+
+func (s *Store) check(op string) error {
+	if s.fault == nil {
+		return nil
+	}
+	if err := s.fault(op); err != nil {
+		return fmt.Errorf("%w: %v", store.ErrStoreUnavailable, err)
+	}
+	return nil
+}
+
+func (s *Store) GetJobIDByIdempotencyKey(ctx context.Context, tenant, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpGetJobID); err != nil {
+		return "", false, err
+	}
+	e, ok := s.idemLocked(rediskeys.ForTenant(tenant, key))
+	return e.jobID, ok, nil
 }
 
-func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage) error {
+func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, exists := s.byKey[key]; exists {
+	if err := s.check(OpCreateJob); err != nil {
+		return err
+	}
+	idemKey := rediskeys.ForTenant(meta.Tenant, key)
+	if _, exists := s.idemLocked(idemKey); exists {
 		return store.ErrAlreadyExists
 	}
-	s.byKey[key] = jobID
-	s.payloads[jobID] = payload
+	now := s.now()
+	s.idem[idemKey] = idemEntry{jobID: jobID, expires: now.Add(s.ttl.Dedupe)}
+	s.jobs[jobID] = &job{
+		status:        state.Queued,
+		statusExpires: now.Add(s.ttl.JobStatus),
+		payload:       payload,
+		meta:          meta,
+		dataExpires:   now.Add(s.ttl.JobData),
+	}
+	s.outbox[jobID] = now
+	return nil
+}
+
+func (s *Store) MarkPublished(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpMarkPublished); err != nil {
+		return err
+	}
+	delete(s.outbox, jobID)
 	return nil
 }
+
+func (s *Store) GetJob(ctx context.Context, jobID string) (store.Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpGetJob); err != nil {
+		return store.Job{}, false, err
+	}
+	j, ok := s.jobLocked(jobID)
+	if !ok || j.status == "" {
+		return store.Job{}, false, nil
+	}
+	out := store.Job{ID: jobID, Status: j.status}
+	if s.now().Before(j.dataExpires) {
+		out.Meta = j.meta
+	}
+	return out, true, nil
+}
+
+// idemLocked returns a live idempotency entry, dropping it if it expired.
+func (s *Store) idemLocked(key string) (idemEntry, bool) {
+	e, ok := s.idem[key]
+	if !ok {
+		return idemEntry{}, false
+	}
+	if !s.now().Before(e.expires) {
+		delete(s.idem, key)
+		return idemEntry{}, false
+	}
+	return e, true
+}
+
+// jobLocked returns the job with expired parts cleared. The record is
+// dropped once every part has expired.
+func (s *Store) jobLocked(jobID string) (*job, bool) {
+	j, ok := s.jobs[jobID]
+	if !ok {
+		return nil, false
+	}
+	now := s.now()
+	if j.status != "" && !now.Before(j.statusExpires) {
+		j.status = ""
+	}
+	if j.payload != nil && !now.Before(j.dataExpires) {
+		j.payload, j.meta = nil, jobmeta.Meta{}
+	}
+	if j.attempts > 0 && !now.Before(j.attemptExpires) {
+		j.attempts = 0
+	}
+	if j.status == "" && j.payload == nil && j.attempts == 0 {
+		delete(s.jobs, jobID)
+		return nil, false
+	}
+	return j, true
+}
+
+// Unpublished reports whether the job still has a pending outbox entry.
+func (s *Store) Unpublished(jobID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.outbox[jobID]
+	return ok
+}
+
+func (s *Store) JobMeta(jobID string) (jobmeta.Meta, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobLocked(jobID)
+	if !ok || j.payload == nil {
+		return jobmeta.Meta{}, false
+	}
+	return j.meta, true
+}
+
+// Payload returns job:data:<id> while it is live.
+func (s *Store) Payload(jobID string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobLocked(jobID)
+	if !ok || j.payload == nil {
+		return nil, false
+	}
+	return j.payload, true
+}
+
+// SetStatus stands in for the worker when the store backs an in-process
+// pipeline. Like the worker, it refreshes the status TTL, using the DLQ TTL
+// for dlq.
+func (s *Store) SetStatus(jobID string, status state.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobLocked(jobID)
+	if !ok {
+		j = &job{}
+		s.jobs[jobID] = j
+	}
+	ttl := s.ttl.JobStatus
+	if status == state.DLQ {
+		ttl = s.ttl.DLQ
+	}
+	j.status = status
+	j.statusExpires = s.now().Add(ttl)
+}
+
+// IncrAttempt bumps job:attempt:<id>; the first increment starts its TTL, as
+// in the worker.
+func (s *Store) IncrAttempt(jobID string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobLocked(jobID)
+	if !ok {
+		j = &job{}
+		s.jobs[jobID] = j
+	}
+	j.attempts++
+	if j.attempts == 1 {
+		j.attemptExpires = s.now().Add(s.ttl.JobData)
+	}
+	return j.attempts
+}
+
+// ScheduleRetry adds or moves the job in retry:jobs.
+func (s *Store) ScheduleRetry(jobID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retry[jobID] = at
+}
+
+// ClaimDueRetries removes and returns up to limit due retry:jobs entries in
+// due order, like the dispatcher's claim script.
+func (s *Store) ClaimDueRetries(limit int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []string
+	for id, at := range s.retry {
+		if !at.After(now) {
+			due = append(due, id)
+		}
+	}
+	slices.SortFunc(due, func(a, b string) int {
+		if c := s.retry[a].Compare(s.retry[b]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for _, id := range due {
+		delete(s.retry, id)
+	}
+	return due
+}
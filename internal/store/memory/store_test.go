@@ -4,20 +4,58 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
 	storeerr "mq-redis/internal/store"
+	"mq-redis/internal/store/storetest"
 )
 
+// fakeClock is a settable time source for TTL tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+		store := New(WithClock(clock.Now))
+		return storetest.Harness{
+			Store:   store,
+			Advance: clock.Advance,
+			Break: func() {
+				store.SetFault(func(string) error { return errors.New("injected") })
+			},
+		}
+	})
+}
+
 func TestStore_CreateAndGet(t *testing.T) {
 	store := New()
 	payload := json.RawMessage(`{"a":1}`)
 
-	if err := store.CreateJob(context.Background(), "key1", "job1", payload); err != nil {
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{}); err != nil {
 		t.Fatalf("CreateJob error: %v", err)
 	}
 
-	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "key1")
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "", "key1")
 	if err != nil {
 		t.Fatalf("GetJobIDByIdempotencyKey error: %v", err)
 	}
@@ -33,17 +71,17 @@ func TestStore_CreateDuplicate(t *testing.T) {
 	store := New()
 	payload := json.RawMessage(`{"a":1}`)
 
-	if err := store.CreateJob(context.Background(), "key1", "job1", payload); err != nil {
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{}); err != nil {
 		t.Fatalf("CreateJob error: %v", err)
 	}
-	if err := store.CreateJob(context.Background(), "key1", "job2", payload); !errors.Is(err, storeerr.ErrAlreadyExists) {
+	if err := store.CreateJob(context.Background(), "key1", "job2", payload, jobmeta.Meta{}); !errors.Is(err, storeerr.ErrAlreadyExists) {
 		t.Fatalf("expected ErrAlreadyExists, got %v", err)
 	}
 }
 
 func TestStore_GetMissing(t *testing.T) {
 	store := New()
-	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "missing")
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "", "missing")
 	if err != nil {
 		t.Fatalf("GetJobIDByIdempotencyKey error: %v", err)
 	}
@@ -54,3 +92,126 @@ func TestStore_GetMissing(t *testing.T) {
 		t.Fatalf("expected empty jobID for missing key")
 	}
 }
+
+func TestStore_TenantsDoNotCollide(t *testing.T) {
+	store := New()
+	payload := json.RawMessage(`{"a":1}`)
+
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{Tenant: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	if err := store.CreateJob(context.Background(), "key1", "job2", payload, jobmeta.Meta{Tenant: "team-b"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "team-b", "key1")
+	if err != nil || !found || jobID != "job2" {
+		t.Fatalf("team-b lookup = %q found=%v err=%v", jobID, found, err)
+	}
+	if _, found, _ := store.GetJobIDByIdempotencyKey(context.Background(), "", "key1"); found {
+		t.Fatalf("expected default tenant to be isolated")
+	}
+}
+
+func TestStore_OutboxMarkPublished(t *testing.T) {
+	store := New()
+	if err := store.CreateJob(context.Background(), "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	if !store.Unpublished("job1") {
+		t.Fatalf("expected outbox entry after create")
+	}
+	if err := store.MarkPublished(context.Background(), "job1"); err != nil {
+		t.Fatalf("MarkPublished error: %v", err)
+	}
+	if store.Unpublished("job1") {
+		t.Fatalf("expected outbox entry to be cleared")
+	}
+}
+
+func TestStore_GetJob(t *testing.T) {
+	store := New()
+	ctx := context.Background()
+	if _, found, _ := store.GetJob(ctx, "job1"); found {
+		t.Fatalf("expected missing job")
+	}
+	if err := store.CreateJob(ctx, "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{Tenant: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	store.SetStatus("job1", state.Done)
+	job, found, err := store.GetJob(ctx, "job1")
+	if err != nil || !found || job.Status != state.Done || job.Meta.Tenant != "team-a" {
+		t.Fatalf("GetJob = %+v found=%v err=%v", job, found, err)
+	}
+}
+
+func TestStore_FaultPerOperation(t *testing.T) {
+	store := New(WithFault(func(op string) error {
+		if op == OpCreateJob {
+			return errors.New("injected")
+		}
+		return nil
+	}))
+	ctx := context.Background()
+	if err := store.CreateJob(ctx, "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); !errors.Is(err, storeerr.ErrStoreUnavailable) {
+		t.Fatalf("CreateJob err = %v", err)
+	}
+	if _, _, err := store.GetJobIDByIdempotencyKey(ctx, "", "key1"); err != nil {
+		t.Fatalf("lookup err = %v", err)
+	}
+	store.SetFault(nil)
+	if err := store.CreateJob(ctx, "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); err != nil {
+		t.Fatalf("CreateJob after clearing fault: %v", err)
+	}
+}
+
+func TestStore_AttemptsAndRetries(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := New(WithClock(clock.Now))
+
+	if n := store.IncrAttempt("job1"); n != 1 {
+		t.Fatalf("attempt = %d", n)
+	}
+	if n := store.IncrAttempt("job1"); n != 2 {
+		t.Fatalf("attempt = %d", n)
+	}
+	clock.Advance(rediskeys.JobDataTTL)
+	if n := store.IncrAttempt("job1"); n != 1 {
+		t.Fatalf("attempt after TTL = %d, want 1", n)
+	}
+
+	now := clock.Now()
+	store.ScheduleRetry("late", now.Add(time.Minute))
+	store.ScheduleRetry("b", now.Add(-time.Second))
+	store.ScheduleRetry("a", now.Add(-time.Second))
+	store.ScheduleRetry("first", now.Add(-time.Minute))
+	if got := store.ClaimDueRetries(2); len(got) != 2 || got[0] != "first" || got[1] != "a" {
+		t.Fatalf("claim = %v", got)
+	}
+	if got := store.ClaimDueRetries(0); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("claim = %v", got)
+	}
+	clock.Advance(time.Minute)
+	if got := store.ClaimDueRetries(0); len(got) != 1 || got[0] != "late" {
+		t.Fatalf("claim = %v", got)
+	}
+}
+
+func TestStore_SetStatusUsesDLQTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := New(WithClock(clock.Now))
+	if err := store.CreateJob(context.Background(), "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	store.SetStatus("job1", state.DLQ)
+	clock.Advance(rediskeys.DLQTTL - time.Second)
+	if job, found, _ := store.GetJob(context.Background(), "job1"); !found || job.Status != state.DLQ {
+		t.Fatalf("GetJob = %+v found=%v", job, found)
+	}
+	clock.Advance(2 * time.Second)
+	if _, found, _ := store.GetJob(context.Background(), "job1"); found {
+		t.Fatalf("expected dlq status to expire")
+	}
+	if _, ok := store.Payload("job1"); ok {
+		t.Fatalf("expected payload to expire")
+	}
+}
@@ -5,32 +5,57 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"mq-redis/internal/jobmeta"
 	"mq-redis/internal/rediskeys"
 	"mq-redis/internal/state"
 	"mq-redis/internal/store"
 )
 
 type Store struct {
-	client *redis.Client
+	client redis.UniversalClient
+	ttl    rediskeys.TTL
+	keys   rediskeys.Keys
+	now    func() time.Time
 }
 
-func New(opts *redis.Options) *Store {
-	return &Store{client: redis.NewClient(opts)}
+type Option func(*Store)
+
+// WithTTL overrides the default key TTLs; zero fields keep their default.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(s *Store) {
+		s.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(s *Store) {
+		s.keys = keys
+	}
+}
+
+func New(redisOpts *redis.Options, opts ...Option) *Store {
+	return NewWithClient(redis.NewClient(redisOpts), opts...)
 }
 
-func NewWithClient(client *redis.Client) *Store {
-	return &Store{client: client}
+func NewWithClient(client redis.UniversalClient, opts ...Option) *Store {
+	s := &Store{client: client, ttl: rediskeys.DefaultTTL(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *Store) Close() error {
 	return s.client.Close()
 }
 
-func (s *Store) GetJobIDByIdempotencyKey(ctx context.Context, key string) (string, bool, error) {
-	val, err := s.client.Get(ctx, rediskeys.IdempotencyKey(key)).Result()
+func (s *Store) GetJobIDByIdempotencyKey(ctx context.Context, tenant, key string) (string, bool, error) {
+	val, err := s.client.Get(ctx, s.keys.TenantIdempotencyKey(tenant, key)).Result()
 	if err == redis.Nil {
 		return "", false, nil
 	}
@@ -40,10 +65,14 @@ func (s *Store) GetJobIDByIdempotencyKey(ctx context.Context, key string) (strin
 	return val, true, nil
 }
 
-func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage) error {
-	idemKey := rediskeys.IdempotencyKey(key)
-	jobKey := rediskeys.JobKey(jobID)
-	jobDataKey := rediskeys.JobDataKey(jobID)
+func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage, meta jobmeta.Meta) error {
+	idemKey := s.keys.TenantIdempotencyKey(meta.Tenant, key)
+	jobKey := s.keys.JobKey(jobID)
+	jobDataKey := s.keys.JobDataKey(jobID)
+	jobMetaKey := s.keys.JobMetaKey(jobID)
+	metaFields := meta.Fields()
+	now := s.now()
+	metaFields[jobmeta.FieldUpdatedAt] = jobmeta.FormatUpdatedAt(now)
 
 	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
 		exists, err := tx.Exists(ctx, idemKey).Result()
@@ -55,9 +84,12 @@ func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.R
 		}
 
 		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-			pipe.Set(ctx, idemKey, jobID, rediskeys.DedupeTTL)
-			pipe.Set(ctx, jobKey, string(state.Queued), rediskeys.JobStatusTTL)
-			pipe.Set(ctx, jobDataKey, []byte(payload), rediskeys.JobDataTTL)
+			pipe.Set(ctx, idemKey, jobID, s.ttl.Dedupe)
+			pipe.Set(ctx, jobKey, string(state.Queued), s.ttl.JobStatus)
+			pipe.Set(ctx, jobDataKey, []byte(payload), s.ttl.JobData)
+			pipe.HSet(ctx, jobMetaKey, metaFields)
+			pipe.Expire(ctx, jobMetaKey, s.ttl.JobData)
+			pipe.ZAdd(ctx, s.keys.OutboxKey(), redis.Z{Score: float64(now.UnixMilli()), Member: jobID})
 			return nil
 		})
 		return err
@@ -70,3 +102,28 @@ func (s *Store) CreateJob(ctx context.Context, key, jobID string, payload json.R
 	}
 	return fmt.Errorf("%w: %v", store.ErrStoreUnavailable, err)
 }
+
+// MarkPublished removes the job's outbox entry once it is on Kafka.
+func (s *Store) MarkPublished(ctx context.Context, jobID string) error {
+	if err := s.client.ZRem(ctx, s.keys.OutboxKey(), jobID).Err(); err != nil {
+		return fmt.Errorf("%w: %v", store.ErrStoreUnavailable, err)
+	}
+	return nil
+}
+
+func (s *Store) GetJob(ctx context.Context, jobID string) (store.Job, bool, error) {
+	pipe := s.client.Pipeline()
+	statusCmd := pipe.Get(ctx, s.keys.JobKey(jobID))
+	metaCmd := pipe.HGetAll(ctx, s.keys.JobMetaKey(jobID))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return store.Job{}, false, fmt.Errorf("%w: %v", store.ErrStoreUnavailable, err)
+	}
+	if statusCmd.Err() == redis.Nil {
+		return store.Job{}, false, nil
+	}
+	return store.Job{
+		ID:     jobID,
+		Status: state.State(statusCmd.Val()),
+		Meta:   jobmeta.FromFields(metaCmd.Val()),
+	}, true, nil
+}
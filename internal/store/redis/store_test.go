@@ -10,10 +10,29 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 
+	"mq-redis/internal/jobmeta"
 	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
 	storeerr "mq-redis/internal/store"
+	"mq-redis/internal/store/storetest"
 )
 
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+func TestStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		mr := miniredis.RunT(t)
+		store := New(&redis.Options{Addr: mr.Addr(), DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+		t.Cleanup(func() { store.Close() })
+		return storetest.Harness{
+			Store:   store,
+			Advance: mr.FastForward,
+			Break:   mr.Close,
+		}
+	})
+}
+
 func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
 	mr, err := miniredis.Run()
 	if err != nil {
@@ -43,11 +62,11 @@ func TestStore_CreateAndGet(t *testing.T) {
 	defer store.Close()
 
 	payload := json.RawMessage(`{"a":1}`)
-	if err := store.CreateJob(context.Background(), "key1", "job1", payload); err != nil {
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{}); err != nil {
 		t.Fatalf("CreateJob error: %v", err)
 	}
 
-	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "key1")
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "", "key1")
 	if err != nil {
 		t.Fatalf("GetJobIDByIdempotencyKey error: %v", err)
 	}
@@ -55,34 +74,77 @@ func TestStore_CreateAndGet(t *testing.T) {
 		t.Fatalf("expected job1, got %q (found=%v)", jobID, found)
 	}
 
-	if got, err := mr.Get(rediskeys.JobKey("job1")); err != nil || got != "queued" {
+	if got, err := mr.Get(keys.JobKey("job1")); err != nil || got != "queued" {
 		t.Fatalf("job status not set: %q err=%v", got, err)
 	}
-	if got, err := mr.Get(rediskeys.JobDataKey("job1")); err != nil || got != string(payload) {
+	if got, err := mr.Get(keys.JobDataKey("job1")); err != nil || got != string(payload) {
 		t.Fatalf("job data not set: %q err=%v", got, err)
 	}
 
-	if ttl := mr.TTL(rediskeys.IdempotencyKey("key1")); ttl <= 0*time.Second {
+	if ttl := mr.TTL(keys.IdempotencyKey("key1")); ttl <= 0*time.Second {
 		t.Fatalf("expected dedupe TTL to be set, ttl=%v", ttl)
 	}
-	if ttl := mr.TTL(rediskeys.JobKey("job1")); ttl <= 0*time.Second {
+	if ttl := mr.TTL(keys.JobKey("job1")); ttl <= 0*time.Second {
 		t.Fatalf("expected job TTL to be set, ttl=%v", ttl)
 	}
-	if ttl := mr.TTL(rediskeys.JobDataKey("job1")); ttl <= 0*time.Second {
+	if ttl := mr.TTL(keys.JobDataKey("job1")); ttl <= 0*time.Second {
 		t.Fatalf("expected job data TTL to be set, ttl=%v", ttl)
 	}
 }
 
+func TestStore_ConfiguredTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		WithTTL(rediskeys.TTL{Dedupe: time.Hour, JobStatus: 2 * time.Hour}))
+	defer store.Close()
+
+	if err := store.CreateJob(context.Background(), "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	if ttl := mr.TTL(keys.IdempotencyKey("key1")); ttl != time.Hour {
+		t.Fatalf("dedupe ttl = %v", ttl)
+	}
+	if ttl := mr.TTL(keys.JobKey("job1")); ttl != 2*time.Hour {
+		t.Fatalf("status ttl = %v", ttl)
+	}
+	if ttl := mr.TTL(keys.JobDataKey("job1")); ttl != rediskeys.JobDataTTL {
+		t.Fatalf("data ttl = %v, want the default", ttl)
+	}
+}
+
+func TestStore_Namespace(t *testing.T) {
+	mr := miniredis.RunT(t)
+	staging := rediskeys.Keys{Namespace: "staging"}
+	store := NewWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}), WithKeys(staging))
+	defer store.Close()
+
+	if err := store.CreateJob(context.Background(), "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{Tenant: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	for _, key := range []string{"staging:job:job1", "staging:job:data:job1", "staging:tenant:team-a:idem:key1", "staging:outbox:jobs"} {
+		if !mr.Exists(key) {
+			t.Fatalf("%s not written; keys = %v", key, mr.Keys())
+		}
+	}
+	if mr.Exists(keys.JobKey("job1")) {
+		t.Fatalf("job written outside the namespace")
+	}
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "team-a", "key1")
+	if err != nil || !found || jobID != "job1" {
+		t.Fatalf("lookup = %q found=%v err=%v", jobID, found, err)
+	}
+}
+
 func TestStore_CreateDuplicate(t *testing.T) {
 	store, mr := newTestStore(t)
 	defer mr.Close()
 	defer store.Close()
 
 	payload := json.RawMessage(`{"a":1}`)
-	if err := store.CreateJob(context.Background(), "key1", "job1", payload); err != nil {
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{}); err != nil {
 		t.Fatalf("CreateJob error: %v", err)
 	}
-	if err := store.CreateJob(context.Background(), "key1", "job2", payload); !errors.Is(err, storeerr.ErrAlreadyExists) {
+	if err := store.CreateJob(context.Background(), "key1", "job2", payload, jobmeta.Meta{}); !errors.Is(err, storeerr.ErrAlreadyExists) {
 		t.Fatalf("expected ErrAlreadyExists, got %v", err)
 	}
 }
@@ -92,8 +154,96 @@ func TestStore_Unavailable(t *testing.T) {
 	mr.Close()
 
 	payload := json.RawMessage(`{"a":1}`)
-	err := store.CreateJob(context.Background(), "key1", "job1", payload)
+	err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{})
 	if !errors.Is(err, storeerr.ErrStoreUnavailable) {
 		t.Fatalf("expected ErrStoreUnavailable, got %v", err)
 	}
 }
+
+func TestStore_CreateRecordsMeta(t *testing.T) {
+	store, mr := newTestStore(t)
+	defer mr.Close()
+	defer store.Close()
+
+	payload := json.RawMessage(`{"a":1}`)
+	if err := store.CreateJob(context.Background(), "team-a:key1", "job1", payload, jobmeta.Meta{ClientID: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	if got := mr.HGet(keys.JobMetaKey("job1"), jobmeta.FieldClientID); got != "team-a" {
+		t.Fatalf("client_id = %q", got)
+	}
+	if ttl := mr.TTL(keys.JobMetaKey("job1")); ttl <= 0 {
+		t.Fatalf("expected job meta TTL to be set, ttl=%v", ttl)
+	}
+	if mr.Exists(keys.JobMetaKey("job2")) {
+		t.Fatalf("unexpected meta for unknown job")
+	}
+}
+
+func TestStore_TenantPrefixedIdempotencyKey(t *testing.T) {
+	store, mr := newTestStore(t)
+	defer mr.Close()
+	defer store.Close()
+
+	payload := json.RawMessage(`{"a":1}`)
+	if err := store.CreateJob(context.Background(), "key1", "job1", payload, jobmeta.Meta{Tenant: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	if got, err := mr.Get("tenant:team-a:idem:key1"); err != nil || got != "job1" {
+		t.Fatalf("tenant idempotency key = %q err=%v", got, err)
+	}
+	if mr.Exists(keys.IdempotencyKey("key1")) {
+		t.Fatalf("unexpected un-prefixed idempotency key")
+	}
+	jobID, found, err := store.GetJobIDByIdempotencyKey(context.Background(), "team-a", "key1")
+	if err != nil || !found || jobID != "job1" {
+		t.Fatalf("lookup = %q found=%v err=%v", jobID, found, err)
+	}
+}
+
+func TestStore_OutboxEntry(t *testing.T) {
+	store, mr := newTestStore(t)
+	defer mr.Close()
+	defer store.Close()
+	store.now = func() time.Time { return time.UnixMilli(42_000) }
+
+	if err := store.CreateJob(context.Background(), "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	score, err := mr.ZScore(keys.OutboxKey(), "job1")
+	if err != nil || score != 42_000 {
+		t.Fatalf("outbox score=%v err=%v", score, err)
+	}
+	if err := store.MarkPublished(context.Background(), "job1"); err != nil {
+		t.Fatalf("MarkPublished error: %v", err)
+	}
+	if members, _ := mr.ZMembers(keys.OutboxKey()); len(members) != 0 {
+		t.Fatalf("outbox = %v", members)
+	}
+}
+
+func TestStore_GetJob(t *testing.T) {
+	store, mr := newTestStore(t)
+	defer mr.Close()
+	defer store.Close()
+	ctx := context.Background()
+
+	if _, found, err := store.GetJob(ctx, "job1"); found || err != nil {
+		t.Fatalf("GetJob missing found=%v err=%v", found, err)
+	}
+	if err := store.CreateJob(ctx, "key1", "job1", json.RawMessage(`{}`), jobmeta.Meta{Tenant: "team-a"}); err != nil {
+		t.Fatalf("CreateJob error: %v", err)
+	}
+	job, found, err := store.GetJob(ctx, "job1")
+	if err != nil || !found {
+		t.Fatalf("GetJob found=%v err=%v", found, err)
+	}
+	if job.Status != state.Queued || job.Meta.Tenant != "team-a" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	mr.Close()
+	if _, _, err := store.GetJob(ctx, "job1"); !errors.Is(err, storeerr.ErrStoreUnavailable) {
+		t.Fatalf("expected ErrStoreUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package storetest is the contract every job store must meet. Each
+// implementation runs it from its own tests with a Harness over a fresh
+// store.
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/rediskeys"
+	"mq-redis/internal/state"
+	"mq-redis/internal/store"
+)
+
+// Store is the API's view of a job store.
+type Store interface {
+	GetJobIDByIdempotencyKey(ctx context.Context, tenant, key string) (string, bool, error)
+	CreateJob(ctx context.Context, key, jobID string, payload json.RawMessage, meta jobmeta.Meta) error
+	MarkPublished(ctx context.Context, jobID string) error
+	GetJob(ctx context.Context, jobID string) (store.Job, bool, error)
+}
+
+type Harness struct {
+	Store Store
+	// Advance moves the store's clock forward so TTLs lapse.
+	Advance func(d time.Duration)
+	// Break makes every later call fail as if the backend were down.
+	Break func()
+}
+
+// Run runs the contract. newHarness must return an empty store each call.
+func Run(t *testing.T, newHarness func(t *testing.T) Harness) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, h Harness)
+	}{
+		{"CreateThenLookup", testCreateThenLookup},
+		{"DuplicateKey", testDuplicateKey},
+		{"TenantsIsolated", testTenantsIsolated},
+		{"Missing", testMissing},
+		{"DedupeExpires", testDedupeExpires},
+		{"StatusExpires", testStatusExpires},
+		{"MarkPublishedIdempotent", testMarkPublishedIdempotent},
+		{"Unavailable", testUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newHarness(t))
+		})
+	}
+}
+
+var payload = json.RawMessage(`{"a":1}`)
+
+func create(t *testing.T, s Store, key, jobID string, meta jobmeta.Meta) {
+	t.Helper()
+	if err := s.CreateJob(context.Background(), key, jobID, payload, meta); err != nil {
+		t.Fatalf("CreateJob(%s) error: %v", jobID, err)
+	}
+}
+
+func testCreateThenLookup(t *testing.T, h Harness) {
+	ctx := context.Background()
+	meta := jobmeta.Meta{ClientID: "c1", Tenant: "team-a", Type: "email"}
+	create(t, h.Store, "key1", "job1", meta)
+
+	jobID, found, err := h.Store.GetJobIDByIdempotencyKey(ctx, "team-a", "key1")
+	if err != nil || !found || jobID != "job1" {
+		t.Fatalf("lookup = %q found=%v err=%v", jobID, found, err)
+	}
+	job, found, err := h.Store.GetJob(ctx, "job1")
+	if err != nil || !found {
+		t.Fatalf("GetJob found=%v err=%v", found, err)
+	}
+	if job.ID != "job1" || job.Status != state.Queued || job.Meta != meta {
+		t.Fatalf("GetJob = %+v", job)
+	}
+}
+
+func testDuplicateKey(t *testing.T, h Harness) {
+	create(t, h.Store, "key1", "job1", jobmeta.Meta{})
+	err := h.Store.CreateJob(context.Background(), "key1", "job2", payload, jobmeta.Meta{})
+	if !errors.Is(err, store.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+	if _, found, _ := h.Store.GetJob(context.Background(), "job2"); found {
+		t.Fatalf("rejected job must not be stored")
+	}
+}
+
+func testTenantsIsolated(t *testing.T, h Harness) {
+	ctx := context.Background()
+	create(t, h.Store, "key1", "job1", jobmeta.Meta{Tenant: "team-a"})
+	create(t, h.Store, "key1", "job2", jobmeta.Meta{Tenant: "team-b"})
+
+	if jobID, _, _ := h.Store.GetJobIDByIdempotencyKey(ctx, "team-b", "key1"); jobID != "job2" {
+		t.Fatalf("team-b lookup = %q", jobID)
+	}
+	if _, found, _ := h.Store.GetJobIDByIdempotencyKey(ctx, "", "key1"); found {
+		t.Fatalf("default tenant must not see team keys")
+	}
+}
+
+func testMissing(t *testing.T, h Harness) {
+	ctx := context.Background()
+	if jobID, found, err := h.Store.GetJobIDByIdempotencyKey(ctx, "", "missing"); err != nil || found || jobID != "" {
+		t.Fatalf("lookup = %q found=%v err=%v", jobID, found, err)
+	}
+	if _, found, err := h.Store.GetJob(ctx, "missing"); err != nil || found {
+		t.Fatalf("GetJob found=%v err=%v", found, err)
+	}
+}
+
+func testDedupeExpires(t *testing.T, h Harness) {
+	ctx := context.Background()
+	create(t, h.Store, "key1", "job1", jobmeta.Meta{})
+
+	h.Advance(rediskeys.DedupeTTL + time.Second)
+	if _, found, err := h.Store.GetJobIDByIdempotencyKey(ctx, "", "key1"); err != nil || found {
+		t.Fatalf("lookup after dedupe TTL found=%v err=%v", found, err)
+	}
+	// The job itself outlives its dedupe window.
+	if _, found, err := h.Store.GetJob(ctx, "job1"); err != nil || !found {
+		t.Fatalf("GetJob after dedupe TTL found=%v err=%v", found, err)
+	}
+	create(t, h.Store, "key1", "job2", jobmeta.Meta{})
+}
+
+func testStatusExpires(t *testing.T, h Harness) {
+	create(t, h.Store, "key1", "job1", jobmeta.Meta{})
+	h.Advance(rediskeys.JobStatusTTL + time.Second)
+	if _, found, err := h.Store.GetJob(context.Background(), "job1"); err != nil || found {
+		t.Fatalf("GetJob after status TTL found=%v err=%v", found, err)
+	}
+}
+
+func testMarkPublishedIdempotent(t *testing.T, h Harness) {
+	ctx := context.Background()
+	create(t, h.Store, "key1", "job1", jobmeta.Meta{})
+	for range 2 {
+		if err := h.Store.MarkPublished(ctx, "job1"); err != nil {
+			t.Fatalf("MarkPublished error: %v", err)
+		}
+	}
+	if err := h.Store.MarkPublished(ctx, "unknown"); err != nil {
+		t.Fatalf("MarkPublished(unknown) error: %v", err)
+	}
+}
+
+func testUnavailable(t *testing.T, h Harness) {
+	ctx := context.Background()
+	h.Break()
+	if _, _, err := h.Store.GetJobIDByIdempotencyKey(ctx, "", "key1"); !errors.Is(err, store.ErrStoreUnavailable) {
+		t.Fatalf("lookup err = %v, want ErrStoreUnavailable", err)
+	}
+	if err := h.Store.CreateJob(ctx, "key1", "job1", payload, jobmeta.Meta{}); !errors.Is(err, store.ErrStoreUnavailable) {
+		t.Fatalf("CreateJob err = %v, want ErrStoreUnavailable", err)
+	}
+	if err := h.Store.MarkPublished(ctx, "job1"); !errors.Is(err, store.ErrStoreUnavailable) {
+		t.Fatalf("MarkPublished err = %v, want ErrStoreUnavailable", err)
+	}
+	if _, _, err := h.Store.GetJob(ctx, "job1"); !errors.Is(err, store.ErrStoreUnavailable) {
+		t.Fatalf("GetJob err = %v, want ErrStoreUnavailable", err)
+	}
+}
@@ -0,0 +1,113 @@
+package tenant
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultLabel names the implicit tenant of clients that no tenant claims.
+// Its ID is empty so its Redis keys keep the un-prefixed legacy layout.
+const DefaultLabel = "default"
+
+type Config struct {
+	DefaultQuota Quota    `yaml:"default_quota"`
+	Tenants      []Tenant `yaml:"tenants"`
+}
+
+type Tenant struct {
+	ID        string   `yaml:"id"`
+	Clients   []string `yaml:"clients"`
+	JobsTopic string   `yaml:"jobs_topic"`
+	Quota     *Quota   `yaml:"quota"`
+}
+
+// Quota limits a tenant's non-terminal jobs and its submissions per second.
+// Zero means unlimited.
+type Quota struct {
+	MaxQueued  int64 `yaml:"max_queued"`
+	SubmitRate int64 `yaml:"submit_rate"`
+}
+
+func (q Quota) Unlimited() bool {
+	return q.MaxQueued <= 0 && q.SubmitRate <= 0
+}
+
+// Label is the tenant name used in metrics and logs.
+func Label(id string) string {
+	if id == "" {
+		return DefaultLabel
+	}
+	return id
+}
+
+func (c Config) Validate() error {
+	seenTenants := make(map[string]struct{}, len(c.Tenants))
+	seenClients := make(map[string]string)
+	for i, t := range c.Tenants {
+		id := strings.TrimSpace(t.ID)
+		if id == "" {
+			return fmt.Errorf("tenancy.tenants[%d].id is required", i)
+		}
+		if id == DefaultLabel || strings.Contains(id, ":") {
+			return fmt.Errorf("tenancy.tenants[%d].id %q is reserved or contains ':'", i, id)
+		}
+		if _, dup := seenTenants[id]; dup {
+			return fmt.Errorf("duplicate tenant: %s", id)
+		}
+		seenTenants[id] = struct{}{}
+		for _, client := range t.Clients {
+			if owner, dup := seenClients[client]; dup {
+				return fmt.Errorf("client %s belongs to tenants %s and %s", client, owner, id)
+			}
+			seenClients[client] = id
+		}
+	}
+	return nil
+}
+
+// Resolved is a tenant with its effective quota.
+type Resolved struct {
+	ID        string
+	JobsTopic string
+	Quota     Quota
+}
+
+type Registry struct {
+	byClient     map[string]Resolved
+	defaultQuota Quota
+}
+
+func NewRegistry(cfg Config) *Registry {
+	r := &Registry{byClient: make(map[string]Resolved), defaultQuota: cfg.DefaultQuota}
+	for _, t := range cfg.Tenants {
+		quota := cfg.DefaultQuota
+		if t.Quota != nil {
+			quota = *t.Quota
+		}
+		resolved := Resolved{ID: t.ID, JobsTopic: t.JobsTopic, Quota: quota}
+		for _, client := range t.Clients {
+			r.byClient[client] = resolved
+		}
+	}
+	return r
+}
+
+// Resolve maps an authenticated client to its tenant; unknown and anonymous
+// clients belong to the default tenant.
+func (r *Registry) Resolve(clientID string) Resolved {
+	if t, ok := r.byClient[clientID]; ok {
+		return t
+	}
+	return Resolved{Quota: r.defaultQuota}
+}
+
+// Topics returns the per-tenant jobs topic overrides keyed by tenant ID.
+func (c Config) Topics() map[string]string {
+	out := make(map[string]string)
+	for _, t := range c.Tenants {
+		if t.JobsTopic != "" {
+			out[t.ID] = t.JobsTopic
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package tenant
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	cfg := Config{
+		DefaultQuota: Quota{MaxQueued: 10},
+		Tenants: []Tenant{
+			{ID: "team-a", Clients: []string{"a-ci", "a-prod"}, JobsTopic: "jobs.team-a"},
+			{ID: "team-b", Clients: []string{"b"}, Quota: &Quota{MaxQueued: 1, SubmitRate: 5}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	r := NewRegistry(cfg)
+
+	a := r.Resolve("a-prod")
+	if a.ID != "team-a" || a.JobsTopic != "jobs.team-a" || a.Quota.MaxQueued != 10 {
+		t.Fatalf("team-a = %+v", a)
+	}
+	b := r.Resolve("b")
+	if b.ID != "team-b" || b.Quota.SubmitRate != 5 || b.Quota.MaxQueued != 1 {
+		t.Fatalf("team-b = %+v", b)
+	}
+	anon := r.Resolve("")
+	if anon.ID != "" || anon.Quota.MaxQueued != 10 {
+		t.Fatalf("default = %+v", anon)
+	}
+	if Label(anon.ID) != DefaultLabel {
+		t.Fatalf("label = %q", Label(anon.ID))
+	}
+	if topics := cfg.Topics(); topics["team-a"] != "jobs.team-a" || len(topics) != 1 {
+		t.Fatalf("topics = %v", topics)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]Config{
+		"missing id":    {Tenants: []Tenant{{}}},
+		"reserved id":   {Tenants: []Tenant{{ID: DefaultLabel}}},
+		"duplicate":     {Tenants: []Tenant{{ID: "a"}, {ID: "a"}}},
+		"shared client": {Tenants: []Tenant{{ID: "a", Clients: []string{"c"}}, {ID: "b", Clients: []string{"c"}}}},
+	}
+	for name, cfg := range cases {
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/ratelimit"
+	"mq-redis/internal/rediskeys"
+)
+
+const (
+	DefaultDeferDelay = 5 * time.Second
+	DefaultSlotTTL    = 10 * time.Minute
+)
+
+const (
+	ReasonConcurrency = "concurrency"
+	ReasonRate        = "rate"
+)
+
+// Config caps how hard the worker fleet drives each job type's downstream.
+// SlotTTL bounds how long a crashed worker's slot stays taken and must exceed
+// the longest expected processing time.
+type Config struct {
+	DeferDelay time.Duration `yaml:"defer_delay"`
+	SlotTTL    time.Duration `yaml:"slot_ttl"`
+	Types      []Limit       `yaml:"types"`
+}
+
+// Limit applies to jobs submitted with the given type. Zero MaxConcurrency or
+// Rate leaves that dimension unlimited.
+type Limit struct {
+	Type           string  `yaml:"type"`
+	MaxConcurrency int64   `yaml:"max_concurrency"`
+	Rate           float64 `yaml:"rate"`
+	Burst          int64   `yaml:"burst"`
+}
+
+func (c Config) Validate() error {
+	seen := make(map[string]struct{}, len(c.Types))
+	for i, l := range c.Types {
+		if strings.TrimSpace(l.Type) == "" {
+			return fmt.Errorf("worker.throttle.types[%d].type is required", i)
+		}
+		if _, dup := seen[l.Type]; dup {
+			return fmt.Errorf("worker.throttle.types[%d]: duplicate type %q", i, l.Type)
+		}
+		seen[l.Type] = struct{}{}
+		if l.MaxConcurrency < 0 || l.Rate < 0 || l.Burst < 0 {
+			return fmt.Errorf("worker.throttle.types[%d]: limits must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Result says whether a job may run now; otherwise Reason names the exhausted
+// limit and Delay how long to defer it.
+type Result struct {
+	Admitted bool
+	Reason   string
+	Delay    time.Duration
+}
+
+// acquireScript expires abandoned leases, then admits the job if it already
+// holds a slot (redelivery) or a slot is free.
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZSCORE', KEYS[1], ARGV[3]) or redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+	return 1
+end
+return 0
+`)
+
+// Throttle enforces per-type concurrency with a lease ZSET and per-type rate
+// with the shared token bucket, so limits hold across worker replicas.
+type Throttle struct {
+	client     redis.UniversalClient
+	limiter    *ratelimit.Limiter
+	limits     map[string]Limit
+	deferDelay time.Duration
+	slotTTL    time.Duration
+	keys       rediskeys.Keys
+	now        func() time.Time
+}
+
+func New(client redis.UniversalClient, cfg Config, keys rediskeys.Keys) *Throttle {
+	t := &Throttle{
+		client:     client,
+		keys:       keys,
+		limiter:    ratelimit.New(client),
+		limits:     make(map[string]Limit, len(cfg.Types)),
+		deferDelay: cfg.DeferDelay,
+		slotTTL:    cfg.SlotTTL,
+		now:        time.Now,
+	}
+	if t.deferDelay <= 0 {
+		t.deferDelay = DefaultDeferDelay
+	}
+	if t.slotTTL <= 0 {
+		t.slotTTL = DefaultSlotTTL
+	}
+	for _, l := range cfg.Types {
+		if l.Rate > 0 && l.Burst <= 0 {
+			l.Burst = 1
+		}
+		t.limits[l.Type] = l
+	}
+	return t
+}
+
+// Acquire takes a concurrency slot and a rate token for the job. A job that
+// gets a slot but no token gives the slot back.
+func (t *Throttle) Acquire(ctx context.Context, jobType, jobID string) (Result, error) {
+	l, ok := t.limits[jobType]
+	if !ok {
+		return Result{Admitted: true}, nil
+	}
+	if l.MaxConcurrency > 0 {
+		now := t.now()
+		res, err := acquireScript.Run(ctx, t.client, []string{t.keys.ThrottleSlotsKey(jobType)},
+			now.UnixMilli(), now.Add(t.slotTTL).UnixMilli(), jobID, l.MaxConcurrency, t.slotTTL.Milliseconds()).Int64()
+		if err != nil {
+			return Result{}, err
+		}
+		if res != 1 {
+			return Result{Reason: ReasonConcurrency, Delay: t.deferDelay}, nil
+		}
+	}
+	if l.Rate > 0 {
+		res, err := t.limiter.Allow(ctx, t.keys.ThrottleRateKey(jobType), l.Rate, l.Burst)
+		if err != nil {
+			_ = t.Release(ctx, jobType, jobID)
+			return Result{}, err
+		}
+		if !res.Allowed {
+			if err := t.Release(ctx, jobType, jobID); err != nil {
+				return Result{}, err
+			}
+			return Result{Reason: ReasonRate, Delay: max(t.deferDelay, res.RetryAfter)}, nil
+		}
+	}
+	return Result{Admitted: true}, nil
+}
+
+// Release frees the job's concurrency slot; releasing twice is harmless.
+func (t *Throttle) Release(ctx context.Context, jobType, jobID string) error {
+	if l, ok := t.limits[jobType]; !ok || l.MaxConcurrency <= 0 {
+		return nil
+	}
+	return t.client.ZRem(ctx, t.keys.ThrottleSlotsKey(jobType), jobID).Err()
+}
@@ -0,0 +1,103 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/rediskeys"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+func newThrottle(t *testing.T, cfg Config) (*Throttle, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), cfg, keys), mr
+}
+
+func TestAcquireConcurrency(t *testing.T) {
+	th, mr := newThrottle(t, Config{Types: []Limit{{Type: "email", MaxConcurrency: 1}}})
+	now := time.Unix(1_700_000_000, 0)
+	th.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if res, err := th.Acquire(ctx, "email", "job-1"); err != nil || !res.Admitted {
+		t.Fatalf("job-1: res=%+v err=%v", res, err)
+	}
+	res, err := th.Acquire(ctx, "email", "job-2")
+	if err != nil || res.Admitted || res.Reason != ReasonConcurrency || res.Delay != DefaultDeferDelay {
+		t.Fatalf("job-2: res=%+v err=%v", res, err)
+	}
+	if res, _ := th.Acquire(ctx, "email", "job-1"); !res.Admitted {
+		t.Fatalf("expected redelivered job to keep its slot")
+	}
+	if res, _ := th.Acquire(ctx, "sms", "job-3"); !res.Admitted {
+		t.Fatalf("expected unlimited type to be admitted")
+	}
+
+	if err := th.Release(ctx, "email", "job-1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if res, _ := th.Acquire(ctx, "email", "job-2"); !res.Admitted {
+		t.Fatalf("expected slot after release")
+	}
+	if ttl := mr.TTL(keys.ThrottleSlotsKey("email")); ttl != DefaultSlotTTL {
+		t.Fatalf("slots ttl = %v", ttl)
+	}
+}
+
+func TestAcquireExpiresAbandonedSlots(t *testing.T) {
+	th, _ := newThrottle(t, Config{SlotTTL: time.Minute, Types: []Limit{{Type: "email", MaxConcurrency: 1}}})
+	now := time.Unix(1_700_000_000, 0)
+	th.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if res, _ := th.Acquire(ctx, "email", "crashed"); !res.Admitted {
+		t.Fatalf("expected first job admitted")
+	}
+	now = now.Add(2 * time.Minute)
+	if res, _ := th.Acquire(ctx, "email", "job-2"); !res.Admitted {
+		t.Fatalf("expected abandoned slot to expire")
+	}
+}
+
+func TestAcquireRateReleasesSlot(t *testing.T) {
+	th, mr := newThrottle(t, Config{Types: []Limit{{Type: "email", MaxConcurrency: 5, Rate: 0.01, Burst: 1}}})
+	ctx := context.Background()
+
+	if res, _ := th.Acquire(ctx, "email", "job-1"); !res.Admitted {
+		t.Fatalf("expected first job admitted")
+	}
+	res, err := th.Acquire(ctx, "email", "job-2")
+	if err != nil || res.Admitted || res.Reason != ReasonRate {
+		t.Fatalf("job-2: res=%+v err=%v", res, err)
+	}
+	if res.Delay < 90*time.Second {
+		t.Fatalf("delay = %v, want the bucket refill time", res.Delay)
+	}
+	members, _ := mr.ZMembers(keys.ThrottleSlotsKey("email"))
+	if len(members) != 1 || members[0] != "job-1" {
+		t.Fatalf("slots = %v", members)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{Types: []Limit{{Type: "email", MaxConcurrency: 2}}}).Validate(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	cases := map[string]Config{
+		"missing type": {Types: []Limit{{MaxConcurrency: 1}}},
+		"duplicate":    {Types: []Limit{{Type: "a"}, {Type: "a"}}},
+		"negative":     {Types: []Limit{{Type: "a", Rate: -1}}},
+	}
+	for name, cfg := range cases {
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
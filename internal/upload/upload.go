@@ -0,0 +1,172 @@
+// Package upload tracks payloads uploaded through POST /payloads until a job
+// uses them, and deletes the ones no job claims within the TTL.
+//
+// Claimed uploads are never deleted here: a retried job fetches its payload
+// again, and a dead-lettered one can be replayed. Expire the uploads/ prefix
+// with the bucket's lifecycle rules (or a cron for the local backend) after
+// the longest of redis.ttl.job_data and redis.ttl.dlq.
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/blob"
+	"mq-redis/internal/rediskeys"
+)
+
+const (
+	// KeyPrefix is where uploads live in the blob store, followed by
+	// <tenant>/<id>.
+	KeyPrefix = "uploads/"
+
+	DefaultTTL       = 24 * time.Hour
+	DefaultInterval  = time.Minute
+	DefaultLease     = 5 * time.Minute
+	DefaultBatchSize = 100
+)
+
+// Config tunes orphan collection. TTL is how long an upload may wait for a
+// POST /jobs that uses it; it must comfortably exceed the time clients take
+// between uploading and submitting.
+type Config struct {
+	TTL       time.Duration `yaml:"ttl"`
+	Interval  time.Duration `yaml:"interval"`
+	BatchSize int64         `yaml:"batch_size"`
+}
+
+func (c Config) Validate() error {
+	if c.TTL < 0 {
+		return fmt.Errorf("api.uploads.ttl must not be negative")
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("api.uploads.interval must not be negative")
+	}
+	if c.BatchSize < 0 {
+		return fmt.Errorf("api.uploads.batch_size must not be negative")
+	}
+	return nil
+}
+
+// Tracker records uploads in payload:uploads and clears them once a job
+// refers to them.
+type Tracker struct {
+	redis redis.UniversalClient
+	keys  rediskeys.Keys
+	now   func() time.Time
+}
+
+func NewTracker(redisClient redis.UniversalClient, keys rediskeys.Keys) *Tracker {
+	return &Tracker{redis: redisClient, keys: keys, now: time.Now}
+}
+
+func (t *Tracker) Track(ctx context.Context, ref string) error {
+	return t.redis.ZAdd(ctx, t.keys.PayloadUploadsKey(), redis.Z{Score: float64(t.now().UnixMilli()), Member: ref}).Err()
+}
+
+// Claim marks ref as used by a job. Refs that were never uploaded here, or
+// were already claimed, are a no-op.
+func (t *Tracker) Claim(ctx context.Context, ref string) error {
+	return t.redis.ZRem(ctx, t.keys.PayloadUploadsKey(), ref).Err()
+}
+
+// claimScript leases up to ARGV[2] uploads older than ARGV[1] by moving
+// their score to ARGV[3], which makes them due again once the lease lapses.
+var claimScript = redis.NewScript(`
+local refs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, ref in ipairs(refs) do
+	redis.call('ZADD', KEYS[1], ARGV[3], ref)
+end
+return refs
+`)
+
+// Collector deletes uploads no job claimed within the TTL. Several API
+// replicas can run one each: the claim script hands every expired ref to a
+// single collector.
+type Collector struct {
+	redis redis.UniversalClient
+	store blob.Store
+	cfg   Config
+	keys  rediskeys.Keys
+	lease time.Duration
+	now   func() time.Time
+}
+
+func NewCollector(redisClient redis.UniversalClient, store blob.Store, cfg Config, keys rediskeys.Keys) (*Collector, error) {
+	if redisClient == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if store == nil {
+		return nil, errors.New("blob store is required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	return &Collector{redis: redisClient, store: store, cfg: cfg, keys: keys, lease: DefaultLease, now: time.Now}, nil
+}
+
+// Run collects expired uploads every interval until ctx is cancelled.
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := c.CollectExpired(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("upload collector error: %v", err)
+		}
+		if int64(n) == c.cfg.BatchSize && err == nil && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectExpired claims one batch of uploads older than the TTL and deletes
+// their objects. Each ref is removed from payload:uploads before its object
+// is deleted, and only if the ZREM removed it: Tracker.Claim removes the same
+// member, so a job that claimed the ref since the script ran wins and keeps
+// the object. A failed delete is tracked again and retried after the lease.
+func (c *Collector) CollectExpired(ctx context.Context) (int, error) {
+	now := c.now()
+	due := now.Add(-c.cfg.TTL)
+	refs, err := claimScript.Run(ctx, c.redis, []string{c.keys.PayloadUploadsKey()},
+		due.UnixMilli(), c.cfg.BatchSize, due.Add(c.lease).UnixMilli()).StringSlice()
+	if err != nil {
+		return 0, err
+	}
+	for _, ref := range refs {
+		removed, err := c.redis.ZRem(ctx, c.keys.PayloadUploadsKey(), ref).Result()
+		if err != nil {
+			log.Printf("upload clear failed ref=%s: %v", ref, err)
+			continue
+		}
+		if removed == 0 {
+			continue
+		}
+		if err := c.store.Delete(ctx, ref); err != nil {
+			log.Printf("orphaned upload delete failed ref=%s: %v", ref, err)
+			retry := redis.Z{Score: float64(due.Add(c.lease).UnixMilli()), Member: ref}
+			if err := c.redis.ZAddNX(ctx, c.keys.PayloadUploadsKey(), retry).Err(); err != nil {
+				log.Printf("upload re-track failed ref=%s: %v", ref, err)
+			}
+			continue
+		}
+		log.Printf("deleted orphaned upload ref=%s", ref)
+	}
+	return len(refs), nil
+}
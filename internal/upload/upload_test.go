@@ -0,0 +1,151 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/blob"
+	"mq-redis/internal/rediskeys"
+)
+
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
+type failingDelete struct {
+	blob.Store
+}
+
+func (failingDelete) Delete(ctx context.Context, ref string) error {
+	return errors.New("blob store down")
+}
+
+func setup(t *testing.T, store blob.Store) (*Tracker, *Collector, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tracker := NewTracker(client, keys)
+	c, err := NewCollector(client, store, Config{TTL: time.Hour}, keys)
+	if err != nil {
+		t.Fatalf("new collector: %v", err)
+	}
+	return tracker, c, mr
+}
+
+func put(t *testing.T, tracker *Tracker, store blob.Store, key string, at time.Time) string {
+	t.Helper()
+	ref, err := store.Put(context.Background(), KeyPrefix+key, strings.NewReader("data"), 4)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	tracker.now = func() time.Time { return at }
+	if err := tracker.Track(context.Background(), ref); err != nil {
+		t.Fatalf("track: %v", err)
+	}
+	return ref
+}
+
+func exists(ref string) bool {
+	_, err := os.Stat(strings.TrimPrefix(ref, "file://"))
+	return err == nil
+}
+
+func TestCollectExpiredDeletesUnclaimedUploads(t *testing.T) {
+	store := blob.NewLocal(t.TempDir())
+	tracker, c, mr := setup(t, store)
+	now := time.UnixMilli(10_000_000)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	orphan := put(t, tracker, store, "team-a/orphan", now.Add(-2*time.Hour))
+	claimed := put(t, tracker, store, "team-a/claimed", now.Add(-2*time.Hour))
+	fresh := put(t, tracker, store, "team-a/fresh", now.Add(-time.Minute))
+	if err := tracker.Claim(ctx, claimed); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+
+	n, err := c.CollectExpired(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if exists(orphan) {
+		t.Fatalf("orphaned upload was not deleted")
+	}
+	if !exists(claimed) || !exists(fresh) {
+		t.Fatalf("claimed or fresh upload was deleted")
+	}
+	if members, _ := mr.ZMembers(keys.PayloadUploadsKey()); len(members) != 1 || members[0] != fresh {
+		t.Fatalf("uploads = %v", members)
+	}
+}
+
+// claimAfterScript claims ref as soon as the collector's lease script has
+// run, the window in which a POST /jobs can race the collector.
+type claimAfterScript struct {
+	mr  *miniredis.Miniredis
+	ref string
+}
+
+func (h claimAfterScript) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h claimAfterScript) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if name := cmd.Name(); err == nil && (name == "evalsha" || name == "eval") {
+			h.mr.ZRem(keys.PayloadUploadsKey(), h.ref)
+		}
+		return err
+	}
+}
+
+func (h claimAfterScript) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestCollectExpiredSkipsUploadClaimedMidBatch(t *testing.T) {
+	store := blob.NewLocal(t.TempDir())
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tracker := NewTracker(client, keys)
+	now := time.UnixMilli(10_000_000)
+	ref := put(t, tracker, store, "team-a/racing", now.Add(-2*time.Hour))
+
+	client.AddHook(claimAfterScript{mr: mr, ref: ref})
+	c, err := NewCollector(client, store, Config{TTL: time.Hour}, keys)
+	if err != nil {
+		t.Fatalf("new collector: %v", err)
+	}
+	c.now = func() time.Time { return now }
+	if n, err := c.CollectExpired(context.Background()); err != nil || n != 1 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if !exists(ref) {
+		t.Fatalf("upload claimed after the lease script was deleted")
+	}
+}
+
+func TestCollectExpiredKeepsLeaseOnFailure(t *testing.T) {
+	store := blob.NewLocal(t.TempDir())
+	tracker, c, mr := setup(t, failingDelete{store})
+	now := time.UnixMilli(10_000_000)
+	c.now = func() time.Time { return now }
+
+	orphan := put(t, tracker, store, "team-a/orphan", now.Add(-2*time.Hour))
+	if _, err := c.CollectExpired(context.Background()); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	score, err := mr.ZScore(keys.PayloadUploadsKey(), orphan)
+	want := float64(now.Add(-time.Hour + DefaultLease).UnixMilli())
+	if err != nil || score != want {
+		t.Fatalf("score = %v, want %v (err %v)", score, want, err)
+	}
+	if !exists(orphan) {
+		t.Fatalf("upload deleted despite failure")
+	}
+}
@@ -0,0 +1,191 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"mq-redis/internal/metrics"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+const (
+	DefaultBreakerOpenTimeout = 30 * time.Second
+
+	untypedLabel = "untyped"
+)
+
+// BreakerConfig trips a job type's breaker after FailureThreshold consecutive
+// processor failures. While open, jobs of that type are deferred; after
+// OpenTimeout a single probe job is let through (half-open) and its outcome
+// closes or re-opens the breaker. A zero threshold disables breakers.
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
+
+func (c BreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("worker.breaker.failure_threshold must not be negative")
+	}
+	if c.OpenTimeout < 0 {
+		return fmt.Errorf("worker.breaker.open_timeout must not be negative")
+	}
+	return nil
+}
+
+// BreakerStatus is the admin view of one job type's breaker.
+type BreakerStatus struct {
+	Type     string       `json:"type"`
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"`
+	OpenedAt *time.Time   `json:"opened_at,omitempty"`
+	RetryAt  *time.Time   `json:"retry_at,omitempty"`
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers keeps one in-process breaker per job type. State is per worker
+// replica: each replica learns independently that a downstream is failing.
+type breakers struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+	byType      map[string]*breaker
+	gauge       *metrics.GaugeVec
+	transitions *metrics.CounterVec
+}
+
+func newBreakers(cfg BreakerConfig, now func() time.Time, registry *metrics.Registry) *breakers {
+	b := &breakers{
+		threshold:   cfg.FailureThreshold,
+		openTimeout: cfg.OpenTimeout,
+		now:         now,
+		byType:      make(map[string]*breaker),
+		gauge:       registry.Gauge("mq_worker_breaker_state", "Circuit breaker state per job type (0 closed, 1 half-open, 2 open).", "type"),
+		transitions: registry.Counter("mq_worker_breaker_transitions_total", "Circuit breaker state changes per job type.", "type", "state"),
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = DefaultBreakerOpenTimeout
+	}
+	return b
+}
+
+// allow reports whether a job of jobType may run. When it may not, wait is
+// how long until the breaker will half-open.
+func (b *breakers) allow(jobType string) (ok bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(jobType)
+	switch br.state {
+	case BreakerOpen:
+		retryAt := br.openedAt.Add(b.openTimeout)
+		if now := b.now(); now.Before(retryAt) {
+			return false, retryAt.Sub(now)
+		}
+		b.transition(jobType, br, BreakerHalfOpen)
+		br.probing = true
+		return true, 0
+	case BreakerHalfOpen:
+		if br.probing {
+			return false, b.openTimeout
+		}
+		br.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// abandon returns an unused half-open probe, e.g. when the probe job was
+// deferred by the throttle instead of running.
+func (b *breakers) abandon(jobType string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.get(jobType).probing = false
+}
+
+func (b *breakers) record(jobType string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(jobType)
+	br.probing = false
+	if success {
+		br.failures = 0
+		if br.state != BreakerClosed {
+			b.transition(jobType, br, BreakerClosed)
+		}
+		return
+	}
+	br.failures++
+	if br.state == BreakerHalfOpen || (br.state == BreakerClosed && br.failures >= b.threshold) {
+		br.openedAt = b.now()
+		b.transition(jobType, br, BreakerOpen)
+	}
+}
+
+func (b *breakers) get(jobType string) *breaker {
+	br, ok := b.byType[jobType]
+	if !ok {
+		br = &breaker{state: BreakerClosed}
+		b.byType[jobType] = br
+	}
+	return br
+}
+
+func (b *breakers) transition(jobType string, br *breaker, to BreakerState) {
+	br.state = to
+	label := typeLabel(jobType)
+	b.gauge.With(label).Set(breakerGaugeValue(to))
+	b.transitions.With(label, string(to)).Inc()
+}
+
+func (b *breakers) snapshot() []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]BreakerStatus, 0, len(b.byType))
+	for jobType, br := range b.byType {
+		status := BreakerStatus{Type: typeLabel(jobType), State: br.state, Failures: br.failures}
+		if br.state != BreakerClosed {
+			openedAt := br.openedAt
+			retryAt := openedAt.Add(b.openTimeout)
+			status.OpenedAt = &openedAt
+			status.RetryAt = &retryAt
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+func breakerGaugeValue(s BreakerState) float64 {
+	switch s {
+	case BreakerHalfOpen:
+		return 1
+	case BreakerOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func typeLabel(jobType string) string {
+	if jobType == "" {
+		return untypedLabel
+	}
+	return jobType
+}
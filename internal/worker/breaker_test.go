@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/jobmeta"
+	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	reg := metrics.NewRegistry()
+	b := newBreakers(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, func() time.Time { return now }, reg)
+
+	b.record("email", false)
+	if ok, _ := b.allow("email"); !ok {
+		t.Fatalf("expected closed after one failure")
+	}
+	b.record("email", false)
+	ok, wait := b.allow("email")
+	if ok || wait != time.Minute {
+		t.Fatalf("expected open, ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := b.allow("sms"); !ok {
+		t.Fatalf("expected other types unaffected")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _ := b.allow("email"); !ok {
+		t.Fatalf("expected half-open probe")
+	}
+	if ok, _ := b.allow("email"); ok {
+		t.Fatalf("expected a single probe while half-open")
+	}
+	b.record("email", false)
+	if ok, _ := b.allow("email"); ok {
+		t.Fatalf("expected failed probe to re-open")
+	}
+
+	now = now.Add(time.Minute)
+	b.allow("email")
+	b.record("email", true)
+	if ok, _ := b.allow("email"); !ok {
+		t.Fatalf("expected successful probe to close")
+	}
+	if got := reg.Gauge("mq_worker_breaker_state", "", "type").With("email").Value(); got != 0 {
+		t.Fatalf("gauge = %v", got)
+	}
+	if got := reg.Counter("mq_worker_breaker_transitions_total", "", "type", "state").With("email", "open").Value(); got != 2 {
+		t.Fatalf("open transitions = %v", got)
+	}
+}
+
+func TestHandleDefersWhileBreakerOpen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{err: errors.New("downstream down")}, nil, "",
+		WithBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: 10 * time.Second}))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	worker.now = func() time.Time { return time.UnixMilli(1_000_000) }
+	ctx := context.Background()
+	headers := map[string]string{jobmeta.FieldType: "email"}
+
+	_ = worker.Handle(ctx, kafka.Message{Key: "job1", Value: []byte(`{}`), Headers: headers})
+	if status := client.Get(ctx, keys.JobKey("job1")).Val(); status != "retrying" {
+		t.Fatalf("job1 status = %q", status)
+	}
+
+	if err := worker.Handle(ctx, kafka.Message{Key: "job2", Value: []byte(`{}`), Headers: headers}); err != nil {
+		t.Fatalf("handle job2: %v", err)
+	}
+	if client.Exists(ctx, keys.AttemptKey("job2")).Val() != 0 {
+		t.Fatalf("deferral must not count an attempt")
+	}
+	score, err := client.ZScore(ctx, keys.RetryJobsKey(), "job2").Result()
+	if err != nil || score < 1_010_000 || score > 1_012_000 {
+		t.Fatalf("score=%v err=%v", score, err)
+	}
+
+	statuses := worker.Breakers()
+	if len(statuses) != 1 || statuses[0].Type != "email" || statuses[0].State != BreakerOpen || statuses[0].RetryAt == nil {
+		t.Fatalf("breakers = %+v", statuses)
+	}
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultLeaseTTL = 30 * time.Second
+
+// acquireLeaseScript takes or re-takes the lease for ARGV[1]; a live lease
+// held by another worker is left alone.
+var acquireLeaseScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+var renewLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// lease is this worker's claim on one in-flight job. lost is set when a
+// renewal finds the lease expired or taken, after which the job's result
+// must not be written.
+type lease struct {
+	jobID string
+	lost  atomic.Bool
+	stop  context.CancelFunc
+	done  chan struct{}
+}
+
+// WithIdentity sets the prefix of the id the worker heartbeats under and
+// writes as lease owner; the id defaults to <hostname>-<pid>. A random
+// instance token is appended, because replicas started from one config would
+// otherwise share an owner and re-take each other's leases.
+func WithIdentity(id string) Option {
+	return func(w *Worker) {
+		if id != "" {
+			w.id = id + "-" + instanceToken()
+		}
+	}
+}
+
+// WithLeaseTTL sets how long a job lease and the worker heartbeat survive
+// without renewal; both are renewed every third of it.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(w *Worker) {
+		if ttl > 0 {
+			w.leaseTTL = ttl
+		}
+	}
+}
+
+func defaultIdentity() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func instanceToken() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.Itoa(os.Getpid())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ID is the worker's heartbeat and lease owner id.
+func (w *Worker) ID() string {
+	return w.id
+}
+
+// acquireLease returns nil, nil when another live worker owns the job.
+func (w *Worker) acquireLease(ctx context.Context, jobID string) (*lease, error) {
+	ok, err := acquireLeaseScript.Run(ctx, w.redis, []string{w.keys.JobLeaseKey(jobID)}, w.id, w.leaseTTL.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if ok != 1 {
+		return nil, nil
+	}
+	renewCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	l := &lease{jobID: jobID, stop: stop, done: make(chan struct{})}
+	go w.renewLease(renewCtx, l)
+	return l, nil
+}
+
+func (w *Worker) renewLease(ctx context.Context, l *lease) {
+	defer close(l.done)
+	ticker := time.NewTicker(w.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := renewLeaseScript.Run(ctx, w.redis, []string{w.keys.JobLeaseKey(l.jobID)}, w.id, w.leaseTTL.Milliseconds()).Int64()
+		if err != nil {
+			log.Printf("lease renew failed job_id=%s: %v", l.jobID, err)
+			continue
+		}
+		if ok != 1 {
+			log.Printf("lease lost job_id=%s worker=%s", l.jobID, w.id)
+			l.lost.Store(true)
+			return
+		}
+	}
+}
+
+func (w *Worker) releaseLease(ctx context.Context, l *lease) {
+	l.stop()
+	<-l.done
+	if err := releaseLeaseScript.Run(context.WithoutCancel(ctx), w.redis, []string{w.keys.JobLeaseKey(l.jobID)}, w.id).Err(); err != nil {
+		log.Printf("lease release failed job_id=%s: %v", l.jobID, err)
+	}
+}
+
+// heartbeat registers the worker and refreshes worker:hb:<id> until ctx is
+// cancelled, then deregisters it.
+func (w *Worker) heartbeat(ctx context.Context) {
+	key := w.keys.WorkerHeartbeatKey(w.id)
+	started := w.now().UnixMilli()
+	beat := func(ctx context.Context) {
+		now := w.now().UnixMilli()
+		_, err := w.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, "started_at", started, "last_seen", now)
+			pipe.PExpire(ctx, key, w.leaseTTL)
+			pipe.ZAdd(ctx, w.keys.WorkersKey(), redis.Z{Score: float64(now), Member: w.id})
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("worker heartbeat failed: %v", err)
+		}
+	}
+	beat(ctx)
+	ticker := time.NewTicker(w.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			cleanup := context.WithoutCancel(ctx)
+			if err := w.redis.Del(cleanup, key).Err(); err != nil {
+				log.Printf("worker deregister failed: %v", err)
+			}
+			w.redis.ZRem(cleanup, w.keys.WorkersKey(), w.id)
+			return
+		case <-ticker.C:
+			beat(ctx)
+		}
+	}
+}
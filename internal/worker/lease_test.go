@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
+)
+
+type leaseCheckingProcessor struct {
+	mr    *miniredis.Miniredis
+	owner string
+	ttl   time.Duration
+}
+
+func (p *leaseCheckingProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	p.owner, _ = p.mr.Get(keys.JobLeaseKey(jobID))
+	p.ttl = p.mr.TTL(keys.JobLeaseKey(jobID))
+	return nil
+}
+
+func TestHandleHoldsLeaseWhileProcessing(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	processor := &leaseCheckingProcessor{mr: mr}
+	worker, err := New(&fakeConsumer{}, client, processor, nil, "", WithIdentity("w1"), WithLeaseTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{}`)}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if processor.owner != worker.ID() || processor.ttl != time.Minute {
+		t.Fatalf("lease during process owner=%q ttl=%v", processor.owner, processor.ttl)
+	}
+	if mr.Exists(keys.JobLeaseKey("job1")) {
+		t.Fatalf("expected lease to be released")
+	}
+}
+
+func TestHandleFencesDuplicateDelivery(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	reg := metrics.NewRegistry()
+	processor := &countingProcessor{}
+	worker, err := New(&fakeConsumer{}, client, processor, nil, "", WithIdentity("w2"), WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	mr.Set(keys.JobLeaseKey("job1"), "w1")
+	mr.SetTTL(keys.JobLeaseKey("job1"), time.Minute)
+	mr.Set(keys.JobKey("job1"), "processing")
+
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{}`)}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if processor.calls != 0 {
+		t.Fatalf("expected fenced job not to run")
+	}
+	if owner, _ := mr.Get(keys.JobLeaseKey("job1")); owner != "w1" {
+		t.Fatalf("lease owner = %q", owner)
+	}
+	if got := reg.Counter("mq_worker_jobs_total", "", "tenant", "outcome").With("default", "fenced").Value(); got != 1 {
+		t.Fatalf("fenced count = %v", got)
+	}
+
+	mr.Set(keys.JobKey("job2"), "done")
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job2", Value: []byte(`{}`)}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if processor.calls != 0 {
+		t.Fatalf("expected finished job to be skipped")
+	}
+}
+
+type stealingProcessor struct {
+	mr *miniredis.Miniredis
+}
+
+func (p *stealingProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	p.mr.Set(keys.JobLeaseKey(jobID), "other")
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func TestHandleDiscardsResultAfterLeaseLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	worker, err := New(&fakeConsumer{}, client, &stealingProcessor{mr: mr}, nil, "", WithIdentity("w1"), WithLeaseTTL(30*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{}`)}); err == nil {
+		t.Fatalf("expected lease lost error")
+	}
+	if status, _ := mr.Get(keys.JobKey("job1")); status != "processing" {
+		t.Fatalf("status = %q, want processing left for the new owner", status)
+	}
+	if owner, _ := mr.Get(keys.JobLeaseKey("job1")); owner != "other" {
+		t.Fatalf("lease owner = %q", owner)
+	}
+}
+
+func TestRunHeartbeats(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{}, nil, "", WithIdentity("w1"))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	id := worker.ID()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for !mr.Exists(keys.WorkerHeartbeatKey(id)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("heartbeat not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ttl := mr.TTL(keys.WorkerHeartbeatKey(id)); ttl != DefaultLeaseTTL {
+		t.Fatalf("heartbeat ttl = %v", ttl)
+	}
+	if _, err := mr.ZScore(keys.WorkersKey(), id); err != nil {
+		t.Fatalf("worker not registered: %v", err)
+	}
+
+	cancel()
+	<-done
+	if mr.Exists(keys.WorkerHeartbeatKey(id)) {
+		t.Fatalf("expected heartbeat to be removed on shutdown")
+	}
+}
+
+func TestWithIdentityIsUniquePerInstance(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	a, err := New(&fakeConsumer{}, client, &fakeProcessor{}, nil, "", WithIdentity("w1"))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	b, err := New(&fakeConsumer{}, client, &fakeProcessor{}, nil, "", WithIdentity("w1"))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	if !strings.HasPrefix(a.ID(), "w1-") || a.ID() == b.ID() {
+		t.Fatalf("ids = %q, %q; want distinct ids prefixed w1-", a.ID(), b.ID())
+	}
+}
@@ -4,16 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"mq-redis/internal/blob"
+	"mq-redis/internal/compress"
+	"mq-redis/internal/envelope"
+	"mq-redis/internal/jobmeta"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
+	"mq-redis/internal/payload"
+	"mq-redis/internal/quota"
 	"mq-redis/internal/rediskeys"
 	"mq-redis/internal/retry"
 	"mq-redis/internal/state"
+	"mq-redis/internal/tenant"
+	"mq-redis/internal/throttle"
 )
 
 type Processor interface {
@@ -26,18 +37,128 @@ func (p *NoopProcessor) Process(ctx context.Context, jobID string, payload json.
 	return nil
 }
 
+const DefaultDrainTimeout = 30 * time.Second
+
+const reasonBreakerOpen = "breaker_open"
+
+// Throttle gates jobs by type before they run. See internal/throttle.
+type Throttle interface {
+	Acquire(ctx context.Context, jobType, jobID string) (throttle.Result, error)
+	Release(ctx context.Context, jobType, jobID string) error
+}
+
 type Worker struct {
-	consumer    kafka.Consumer
-	dlqProducer kafka.Producer
-	retryCfg    retry.Config
-	now         func() time.Time
-	dlqTopic    string
-	redis       *redis.Client
-	processor   Processor
-	rng         *rand.Rand
+	consumer     kafka.Consumer
+	dlqProducer  kafka.Producer
+	retryMu      sync.Mutex
+	retryCfg     retry.Config
+	now          func() time.Time
+	dlqTopic     string
+	redis        redis.UniversalClient
+	processor    Processor
+	rng          *rand.Rand
+	drainTimeout time.Duration
+	metrics      *metrics.Registry
+	outcomes     *metrics.CounterVec
+	throttle     Throttle
+	deferred     *metrics.CounterVec
+	breakerCfg   BreakerConfig
+	breakers     *breakers
+	id           string
+	leaseTTL     time.Duration
+	blobs        blob.Resolver
+	blobMaxBytes int64
+	payloadFails *metrics.CounterVec
+	keyring      *envelope.Keyring
+	ttl          rediskeys.TTL
+	keys         rediskeys.Keys
+}
+
+type Option func(*Worker)
+
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(w *Worker) {
+		w.metrics = registry
+	}
+}
+
+// WithThrottle enforces per-type concurrency and rate limits. Over-limit jobs
+// are deferred through retry:jobs without counting an attempt.
+func WithThrottle(t Throttle) Option {
+	return func(w *Worker) {
+		w.throttle = t
+	}
+}
+
+// WithBreaker enables a circuit breaker per job type. While a type's breaker
+// is open its jobs are deferred through retry:jobs without counting attempts.
+func WithBreaker(cfg BreakerConfig) Option {
+	return func(w *Worker) {
+		w.breakerCfg = cfg
+	}
+}
+
+// WithBlobResolver makes the worker fetch payload_ref payloads and hand the
+// verified bytes to the processor. Without it processors receive the ref
+// document itself. maxBytes caps the declared payload_size; zero means
+// blob.DefaultMaxBytes.
+func WithBlobResolver(r blob.Resolver, maxBytes int64) Option {
+	return func(w *Worker) {
+		w.blobs = r
+		w.blobMaxBytes = maxBytes
+	}
+}
+
+// WithKeyring lets the worker open payloads the API sealed. The keyring must
+// hold every KEK the API may have used, so new KEKs reach workers first.
+func WithKeyring(keyring *envelope.Keyring) Option {
+	return func(w *Worker) {
+		w.keyring = keyring
+	}
+}
+
+// WithTTL sets the status and data TTLs the worker writes; zero fields keep
+// their default.
+func WithTTL(ttl rediskeys.TTL) Option {
+	return func(w *Worker) {
+		w.ttl = ttl.WithDefaults()
+	}
+}
+
+// WithKeys sets the key layout; the default is the plain layout.
+func WithKeys(keys rediskeys.Keys) Option {
+	return func(w *Worker) {
+		w.keys = keys
+	}
 }
 
-func New(consumer kafka.Consumer, redisClient *redis.Client, processor Processor, dlqProducer kafka.Producer, dlqTopic string) (*Worker, error) {
+// WithRetry sets the backoff for failed attempts; zero fields keep their
+// default. See SetRetry to change it while running.
+func WithRetry(cfg retry.Config) Option {
+	return func(w *Worker) {
+		w.retryCfg = cfg.WithDefaults()
+	}
+}
+
+// SetRetry replaces the backoff used for retries scheduled from now on.
+// Jobs already in retry:jobs keep their due time.
+func (w *Worker) SetRetry(cfg retry.Config) {
+	w.retryMu.Lock()
+	w.retryCfg = cfg.WithDefaults()
+	w.retryMu.Unlock()
+}
+
+// WithDrainTimeout bounds how long an in-flight job may keep running after
+// Run's context is cancelled before its context is cancelled too.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(w *Worker) {
+		if d > 0 {
+			w.drainTimeout = d
+		}
+	}
+}
+
+func New(consumer kafka.Consumer, redisClient redis.UniversalClient, processor Processor, dlqProducer kafka.Producer, dlqTopic string, opts ...Option) (*Worker, error) {
 	if consumer == nil {
 		return nil, errors.New("consumer is required")
 	}
@@ -47,19 +168,49 @@ func New(consumer kafka.Consumer, redisClient *redis.Client, processor Processor
 	if processor == nil {
 		return nil, errors.New("processor is required")
 	}
-	return &Worker{
-		consumer:    consumer,
-		dlqProducer: dlqProducer,
-		dlqTopic:    dlqTopic,
-		retryCfg:    retry.DefaultConfig(),
-		now:         time.Now,
-		redis:       redisClient,
-		processor:   processor,
-		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
-	}, nil
+	w := &Worker{
+		consumer:     consumer,
+		dlqProducer:  dlqProducer,
+		dlqTopic:     dlqTopic,
+		retryCfg:     retry.DefaultConfig(),
+		now:          time.Now,
+		redis:        redisClient,
+		processor:    processor,
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		drainTimeout: DefaultDrainTimeout,
+		metrics:      metrics.NewRegistry(),
+		id:           defaultIdentity(),
+		leaseTTL:     DefaultLeaseTTL,
+		ttl:          rediskeys.DefaultTTL(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.outcomes = w.metrics.Counter("mq_worker_jobs_total", "Jobs handled by the worker by outcome.", "tenant", "outcome")
+	w.deferred = w.metrics.Counter("mq_worker_jobs_deferred_total", "Jobs deferred by per-type limits.", "type", "reason")
+	w.payloadFails = w.metrics.Counter("mq_worker_payload_resolve_failures_total", "Payloads that failed to decode or resolve, by whether a retry can help.", "kind")
+	if w.breakerCfg.FailureThreshold > 0 {
+		w.breakers = newBreakers(w.breakerCfg, func() time.Time { return w.now() }, w.metrics)
+	}
+	return w, nil
 }
 
+// Run polls until ctx is cancelled. Cancelling ctx stops polling only; the
+// job being handled keeps running for up to the drain timeout and its offset
+// is committed once it finishes, so Run returns after in-flight work drains.
+// The worker heartbeats for as long as Run is running.
 func (w *Worker) Run(ctx context.Context) error {
+	hbCtx, stopHeartbeat := context.WithCancel(context.WithoutCancel(ctx))
+	hbDone := make(chan struct{})
+	go func() {
+		defer close(hbDone)
+		w.heartbeat(hbCtx)
+	}()
+	defer func() {
+		stopHeartbeat()
+		<-hbDone
+	}()
+
 	for {
 		msg, err := w.consumer.Poll(ctx)
 		if err != nil {
@@ -69,22 +220,115 @@ func (w *Worker) Run(ctx context.Context) error {
 			log.Printf("worker poll error: %v", err)
 			continue
 		}
-		if err := w.Handle(ctx, msg); err != nil {
-			log.Printf("worker handle error: %v", err)
+		w.handleAndCommit(ctx, msg)
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 	}
 }
 
+func (w *Worker) handleAndCommit(ctx context.Context, msg kafka.Message) {
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(w.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.Printf("worker drain timeout; cancelling job %s", msg.Key)
+			cancel()
+		case <-jobCtx.Done():
+		}
+	})
+	defer stop()
+
+	if err := w.Handle(jobCtx, msg); err != nil {
+		log.Printf("worker handle error: %v", err)
+	}
+	if jobCtx.Err() != nil {
+		return
+	}
+	if err := w.consumer.Commit(jobCtx, msg); err != nil {
+		log.Printf("worker commit error: %v", err)
+	}
+}
+
 func (w *Worker) Handle(ctx context.Context, msg kafka.Message) error {
 	jobID := msg.Key
 	if jobID == "" {
 		return errors.New("missing job id")
 	}
 
-	w.setStatus(ctx, jobID, state.Processing, rediskeys.JobStatusTTL)
+	meta := jobmeta.FromFields(msg.Headers)
+
+	status, err := w.redis.Get(ctx, w.keys.JobKey(jobID)).Result()
+	if err == nil && state.IsTerminal(state.State(status)) {
+		w.outcomes.With(tenant.Label(meta.Tenant), "duplicate").Inc()
+		return nil
+	}
 
-	if err := w.processor.Process(ctx, jobID, msg.Value); err == nil {
-		w.setStatus(ctx, jobID, state.Done, rediskeys.JobStatusTTL)
+	l, err := w.acquireLease(ctx, jobID)
+	switch {
+	case err != nil:
+		log.Printf("lease acquire failed; running job %s without lease: %v", jobID, err)
+	case l == nil:
+		// Another live worker owns this job; this is a duplicate delivery.
+		w.outcomes.With(tenant.Label(meta.Tenant), "fenced").Inc()
+		return nil
+	default:
+		defer w.releaseLease(ctx, l)
+	}
+
+	if w.breakers != nil {
+		if ok, wait := w.breakers.allow(meta.Type); !ok {
+			err := w.deferJob(ctx, jobID, meta, reasonBreakerOpen, wait)
+			if err == nil {
+				return nil
+			}
+			log.Printf("defer failed; running job %s type=%s: %v", jobID, meta.Type, err)
+		}
+	}
+
+	if w.throttle != nil && meta.Type != "" {
+		res, err := w.throttle.Acquire(ctx, meta.Type, jobID)
+		switch {
+		case err != nil:
+			log.Printf("throttle check failed; running job %s type=%s: %v", jobID, meta.Type, err)
+		case !res.Admitted:
+			if err := w.deferJob(ctx, jobID, meta, res.Reason, res.Delay); err != nil {
+				log.Printf("defer failed; running job %s type=%s: %v", jobID, meta.Type, err)
+				break
+			}
+			if w.breakers != nil {
+				w.breakers.abandon(meta.Type)
+			}
+			return nil
+		default:
+			defer w.releaseSlot(ctx, jobID, meta.Type)
+		}
+	}
+
+	w.setStatus(ctx, jobID, state.Processing, w.ttl.JobStatus)
+
+	value, err := w.preparePayload(ctx, jobID, meta, msg.Value)
+	permanent := err != nil && permanentPayloadError(err)
+	if err != nil {
+		log.Printf("payload preparation failed job_id=%s: %v", jobID, err)
+		if w.breakers != nil {
+			w.breakers.abandon(meta.Type)
+		}
+	} else {
+		err = w.processor.Process(ctx, jobID, value)
+		if w.breakers != nil {
+			w.breakers.record(meta.Type, err == nil)
+		}
+	}
+	if l != nil && l.lost.Load() {
+		return fmt.Errorf("lease lost; discarding result of job %s", jobID)
+	}
+	if err == nil {
+		w.setStatus(ctx, jobID, state.Done, w.ttl.JobStatus)
+		w.finish(ctx, jobID, meta, state.Done)
 		return nil
 	}
 
@@ -94,49 +338,161 @@ func (w *Worker) Handle(ctx context.Context, msg kafka.Message) error {
 		attempt = 1
 	}
 
-	if attempt <= 1 {
-		w.setStatus(ctx, jobID, state.Retrying, rediskeys.JobStatusTTL)
+	// A payload that does not decode, or a ref that is missing or does not
+	// match its declared size and hash, will not get better with a retry.
+	if attempt <= 1 && !permanent {
+		w.setStatus(ctx, jobID, state.Retrying, w.ttl.JobStatus)
 		w.scheduleRetry(ctx, jobID, attempt)
+		w.outcomes.With(tenant.Label(meta.Tenant), string(state.Retrying)).Inc()
 		return errors.New("job failed; scheduled retry")
 	}
 
-	w.setStatus(ctx, jobID, state.DLQ, rediskeys.DLQTTL)
+	w.setStatus(ctx, jobID, state.DLQ, w.ttl.DLQ)
 	if w.dlqProducer != nil && w.dlqTopic != "" {
-		if err := w.dlqProducer.Publish(ctx, w.dlqTopic, kafka.Message{Key: jobID, Value: msg.Value}); err != nil {
+		if err := w.dlqProducer.Publish(ctx, w.dlqTopic, kafka.Message{Key: jobID, Value: msg.Value, Headers: msg.Headers}); err != nil {
 			log.Printf("dlq publish failed: %v", err)
 		}
 	}
+	w.finish(ctx, jobID, meta, state.DLQ)
 	return errors.New("job failed; sent to dlq")
 }
 
+// preparePayload undoes what the API applied, in reverse: it opens a sealed
+// payload, decompresses it per its payload_encoding, and then swaps a
+// payload_ref document for the verified object bytes. Inline payloads, and
+// every ref when no resolver is configured, reach the processor as
+// submitted.
+func (w *Worker) preparePayload(ctx context.Context, jobID string, meta jobmeta.Meta, value json.RawMessage) (json.RawMessage, error) {
+	if meta.PayloadEncryption != "" {
+		opened, err := w.openPayload(jobID, meta, value)
+		if err != nil {
+			kind := "permanent"
+			if errors.Is(err, envelope.ErrUnknownKey) {
+				kind = "transient"
+			}
+			w.payloadFails.With(kind).Inc()
+			return nil, err
+		}
+		value = opened
+	}
+	data, err := compress.Decode(meta.PayloadEncoding, value)
+	if err != nil {
+		w.payloadFails.With("permanent").Inc()
+		return nil, err
+	}
+	if !meta.PayloadRef || w.blobs == nil {
+		return data, nil
+	}
+	var ref payload.RefPayload
+	if err := json.Unmarshal(data, &ref); err != nil {
+		w.payloadFails.With("permanent").Inc()
+		return nil, fmt.Errorf("%w: %v", blob.ErrInvalidRef, err)
+	}
+	data, err = blob.Fetch(ctx, w.blobs, ref, w.blobMaxBytes)
+	if err != nil {
+		kind := "transient"
+		if blob.Permanent(err) {
+			kind = "permanent"
+		}
+		w.payloadFails.With(kind).Inc()
+		return nil, err
+	}
+	return data, nil
+}
+
+// openPayload decrypts a sealed payload. A KEK this worker does not hold
+// yet is reported as ErrUnknownKey, which is retried, since a rotation may
+// still be rolling out.
+func (w *Worker) openPayload(jobID string, meta jobmeta.Meta, value []byte) ([]byte, error) {
+	if meta.PayloadEncryption != envelope.Scheme {
+		return nil, fmt.Errorf("%w: scheme %q", envelope.ErrMalformed, meta.PayloadEncryption)
+	}
+	if w.keyring == nil {
+		return nil, fmt.Errorf("%w: worker has no keyring", envelope.ErrUnknownKey)
+	}
+	return w.keyring.Open(value, []byte(jobID))
+}
+
+func permanentPayloadError(err error) bool {
+	return blob.Permanent(err) ||
+		errors.Is(err, compress.ErrCorrupt) || errors.Is(err, compress.ErrUnknownCodec) ||
+		errors.Is(err, envelope.ErrMalformed) || errors.Is(err, envelope.ErrDecrypt)
+}
+
+// finish records a terminal outcome and frees the job's tenant quota slot.
+func (w *Worker) finish(ctx context.Context, jobID string, meta jobmeta.Meta, outcome state.State) {
+	w.outcomes.With(tenant.Label(meta.Tenant), string(outcome)).Inc()
+	if err := quota.Release(ctx, w.redis, w.keys, meta.Tenant, jobID); err != nil {
+		log.Printf("quota release failed: %v", err)
+	}
+}
+
+// deferJob parks a job that may not run yet in retry:jobs for the dispatcher
+// to republish. The job stays queued and its attempt counter is untouched.
+func (w *Worker) deferJob(ctx context.Context, jobID string, meta jobmeta.Meta, reason string, delay time.Duration) error {
+	delay += time.Duration(w.rng.Float64() * 0.2 * float64(delay))
+	score := retry.NextScore(w.now(), delay)
+	if err := w.redis.ZAdd(ctx, w.keys.RetryJobsKey(), redis.Z{Score: score, Member: jobID}).Err(); err != nil {
+		return err
+	}
+	w.deferred.With(typeLabel(meta.Type), reason).Inc()
+	w.outcomes.With(tenant.Label(meta.Tenant), "deferred").Inc()
+	return nil
+}
+
+// Breakers reports the circuit breaker state of every job type seen so far.
+func (w *Worker) Breakers() []BreakerStatus {
+	if w.breakers == nil {
+		return []BreakerStatus{}
+	}
+	return w.breakers.snapshot()
+}
+
+func (w *Worker) releaseSlot(ctx context.Context, jobID, jobType string) {
+	if err := w.throttle.Release(context.WithoutCancel(ctx), jobType, jobID); err != nil {
+		log.Printf("throttle release failed job_id=%s type=%s: %v", jobID, jobType, err)
+	}
+}
+
 func (w *Worker) bumpAttempt(ctx context.Context, jobID string) (int64, error) {
-	key := rediskeys.AttemptKey(jobID)
+	key := w.keys.AttemptKey(jobID)
 	attempt, err := w.redis.Incr(ctx, key).Result()
 	if err != nil {
 		return 0, err
 	}
 	if attempt == 1 {
-		if err := w.redis.Expire(ctx, key, rediskeys.JobDataTTL).Err(); err != nil {
+		if err := w.redis.Expire(ctx, key, w.ttl.JobData).Err(); err != nil {
 			log.Printf("attempt ttl set failed: %v", err)
 		}
 	}
 	return attempt, nil
 }
 
+// setStatus writes the status and stamps job:meta:<id> with the change time
+// so the reconciler can tell how long a job has been in its state.
 func (w *Worker) setStatus(ctx context.Context, jobID string, status state.State, ttl time.Duration) {
-	if err := w.redis.Set(ctx, rediskeys.JobKey(jobID), string(status), ttl).Err(); err != nil {
+	metaKey := w.keys.JobMetaKey(jobID)
+	_, err := w.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, w.keys.JobKey(jobID), string(status), ttl)
+		pipe.HSet(ctx, metaKey, jobmeta.FieldUpdatedAt, jobmeta.FormatUpdatedAt(w.now()))
+		pipe.Expire(ctx, metaKey, w.ttl.JobData)
+		return nil
+	})
+	if err != nil {
 		log.Printf("status update failed: %v", err)
 	}
 }
 
 func (w *Worker) scheduleRetry(ctx context.Context, jobID string, attempt int64) {
+	w.retryMu.Lock()
 	delay, err := retry.NextDelay(w.retryCfg, attempt, w.rng)
+	w.retryMu.Unlock()
 	if err != nil {
 		log.Printf("retry delay failed: %v", err)
 		return
 	}
 	score := retry.NextScore(w.now(), delay)
-	if err := w.redis.ZAdd(ctx, rediskeys.RetryJobsKey, redis.Z{Score: score, Member: jobID}).Err(); err != nil {
+	if err := w.redis.ZAdd(ctx, w.keys.RetryJobsKey(), redis.Z{Score: score, Member: jobID}).Err(); err != nil {
 		log.Printf("retry schedule failed: %v", err)
 	}
 }
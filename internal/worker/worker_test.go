@@ -2,20 +2,37 @@ package worker
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	miniredis "github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 
+	"mq-redis/internal/blob"
+	"mq-redis/internal/compress"
+	"mq-redis/internal/envelope"
+	"mq-redis/internal/jobmeta"
 	"mq-redis/internal/kafka"
+	"mq-redis/internal/metrics"
+	"mq-redis/internal/payload"
 	"mq-redis/internal/rediskeys"
 	"mq-redis/internal/retry"
+	"mq-redis/internal/throttle"
 )
 
+// keys is the plain layout the tests run with.
+var keys rediskeys.Keys
+
 type fakeProcessor struct {
 	err error
 }
@@ -46,14 +63,14 @@ func TestHandleSuccess(t *testing.T) {
 		t.Fatalf("handle: %v", err)
 	}
 
-	status, err := client.Get(context.Background(), rediskeys.JobKey("job1")).Result()
+	status, err := client.Get(context.Background(), keys.JobKey("job1")).Result()
 	if err != nil {
 		t.Fatalf("status: %v", err)
 	}
 	if status != "done" {
 		t.Fatalf("status = %q", status)
 	}
-	if client.Exists(context.Background(), rediskeys.AttemptKey("job1")).Val() != 0 {
+	if client.Exists(context.Background(), keys.AttemptKey("job1")).Val() != 0 {
 		t.Fatalf("unexpected attempt key")
 	}
 }
@@ -73,17 +90,17 @@ func TestHandleRetryThenDLQ(t *testing.T) {
 	msg := kafka.Message{Key: "job1", Value: []byte(`{"a":1}`)}
 	_ = worker.Handle(context.Background(), msg)
 
-	status, _ := client.Get(context.Background(), rediskeys.JobKey("job1")).Result()
+	status, _ := client.Get(context.Background(), keys.JobKey("job1")).Result()
 	if status != "retrying" {
 		t.Fatalf("status = %q", status)
 	}
 
-	attempt, _ := client.Get(context.Background(), rediskeys.AttemptKey("job1")).Result()
+	attempt, _ := client.Get(context.Background(), keys.AttemptKey("job1")).Result()
 	if attempt != "1" {
 		t.Fatalf("attempt = %q", attempt)
 	}
 
-	members, err := mr.ZMembers(rediskeys.RetryJobsKey)
+	members, err := mr.ZMembers(keys.RetryJobsKey())
 	if err != nil {
 		t.Fatalf("retry members: %v", err)
 	}
@@ -92,7 +109,7 @@ func TestHandleRetryThenDLQ(t *testing.T) {
 	}
 
 	_ = worker.Handle(context.Background(), msg)
-	status, _ = client.Get(context.Background(), rediskeys.JobKey("job1")).Result()
+	status, _ = client.Get(context.Background(), keys.JobKey("job1")).Result()
 	if status != "dlq" {
 		t.Fatalf("status = %q", status)
 	}
@@ -101,6 +118,70 @@ func TestHandleRetryThenDLQ(t *testing.T) {
 	}
 }
 
+func TestHandleUsesNamespace(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	staging := rediskeys.Keys{Namespace: "staging"}
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{err: errors.New("boom")}, nil, "",
+		WithKeys(staging))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	_ = worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{}`)})
+	if status, _ := mr.Get("staging:job:job1"); status != "retrying" {
+		t.Fatalf("status = %q; keys = %v", status, mr.Keys())
+	}
+	if members, _ := mr.ZMembers("staging:retry:jobs"); len(members) != 1 || members[0] != "job1" {
+		t.Fatalf("retry members = %v", members)
+	}
+	if mr.Exists(keys.JobKey("job1")) || mr.Exists(keys.RetryJobsKey()) {
+		t.Fatalf("worker wrote outside the namespace")
+	}
+}
+
+func TestSetRetryAppliesToNextFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{err: errors.New("boom")}, nil, "",
+		WithRetry(retry.Config{Base: time.Second, Max: time.Second}))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	worker.now = func() time.Time { return time.Unix(0, 0) }
+	worker.SetRetry(retry.Config{Base: 7 * time.Second, Max: time.Minute})
+
+	_ = worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{}`)})
+	score, err := mr.ZScore(keys.RetryJobsKey(), "job1")
+	if err != nil {
+		t.Fatalf("retry score: %v", err)
+	}
+	if score != 7000 {
+		t.Fatalf("retry score = %v, want 7000", score)
+	}
+}
+
+func TestHandleUsesConfiguredTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{}, nil, "",
+		WithTTL(rediskeys.TTL{JobStatus: 48 * time.Hour, JobData: 72 * time.Hour}))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	mr.Set(keys.JobDataKey("job1"), `{"a":1}`)
+
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: []byte(`{"a":1}`)}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if ttl := mr.TTL(keys.JobKey("job1")); ttl != 48*time.Hour {
+		t.Fatalf("status ttl = %v", ttl)
+	}
+	if ttl := mr.TTL(keys.JobMetaKey("job1")); ttl != 72*time.Hour {
+		t.Fatalf("meta ttl = %v", ttl)
+	}
+}
+
 type fakeConsumer struct{}
 
 func (c *fakeConsumer) Poll(ctx context.Context) (kafka.Message, error) {
@@ -114,3 +195,359 @@ func (c *fakeConsumer) Commit(ctx context.Context, msg kafka.Message) error {
 func (c *fakeConsumer) Close() error {
 	return nil
 }
+
+type blockingProcessor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	close(p.started)
+	select {
+	case <-p.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type oneShotConsumer struct {
+	msg       kafka.Message
+	polled    bool
+	committed []kafka.Message
+}
+
+func (c *oneShotConsumer) Poll(ctx context.Context) (kafka.Message, error) {
+	if !c.polled {
+		c.polled = true
+		return c.msg, nil
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (c *oneShotConsumer) Commit(ctx context.Context, msg kafka.Message) error {
+	c.committed = append(c.committed, msg)
+	return nil
+}
+
+func (c *oneShotConsumer) Close() error {
+	return nil
+}
+
+func TestRunDrainsInFlightJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	consumer := &oneShotConsumer{msg: kafka.Message{Key: "job1", Value: []byte(`{}`), Offset: 7}}
+	processor := &blockingProcessor{started: make(chan struct{}), release: make(chan struct{})}
+	worker, err := New(consumer, client, processor, nil, "", WithDrainTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- worker.Run(ctx) }()
+
+	<-processor.started
+	cancel()
+	select {
+	case <-errCh:
+		t.Fatalf("run returned before in-flight job finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(processor.release)
+
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run err = %v", err)
+	}
+	if status, _ := client.Get(context.Background(), keys.JobKey("job1")).Result(); status != "done" {
+		t.Fatalf("status = %q", status)
+	}
+	if len(consumer.committed) != 1 || consumer.committed[0].Offset != 7 {
+		t.Fatalf("committed = %+v", consumer.committed)
+	}
+}
+
+func TestRunDrainTimeoutCancelsJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	consumer := &oneShotConsumer{msg: kafka.Message{Key: "job1", Value: []byte(`{}`)}}
+	processor := &blockingProcessor{started: make(chan struct{}), release: make(chan struct{})}
+	worker, err := New(consumer, client, processor, nil, "", WithDrainTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- worker.Run(ctx) }()
+
+	<-processor.started
+	cancel()
+	select {
+	case <-errCh:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("run did not return after drain timeout")
+	}
+	if len(consumer.committed) != 0 {
+		t.Fatalf("expected no commit for abandoned job")
+	}
+}
+
+func TestHandleReleasesTenantQuota(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	reg := metrics.NewRegistry()
+	worker, err := New(&fakeConsumer{}, client, &fakeProcessor{}, nil, "", WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	queued := keys.TenantQueuedJobsKey("team-a")
+	if _, err := mr.ZAdd(queued, 1, "job1"); err != nil {
+		t.Fatalf("zadd: %v", err)
+	}
+
+	msg := kafka.Message{Key: "job1", Value: []byte(`{}`), Headers: map[string]string{jobmeta.FieldTenant: "team-a"}}
+	if err := worker.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if members, _ := mr.ZMembers(queued); len(members) != 0 {
+		t.Fatalf("queued members = %v", members)
+	}
+	if got := reg.Counter("mq_worker_jobs_total", "", "tenant", "outcome").With("team-a", "done").Value(); got != 1 {
+		t.Fatalf("done count = %v", got)
+	}
+}
+
+type countingProcessor struct {
+	calls int
+}
+
+func (p *countingProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	p.calls++
+	return nil
+}
+
+func TestHandleDefersOverLimitJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	reg := metrics.NewRegistry()
+	processor := &countingProcessor{}
+	th := throttle.New(client, throttle.Config{DeferDelay: time.Second, Types: []throttle.Limit{{Type: "email", MaxConcurrency: 1}}}, keys)
+	worker, err := New(&fakeConsumer{}, client, processor, nil, "", WithThrottle(th), WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	worker.now = func() time.Time { return time.UnixMilli(1_000_000) }
+	ctx := context.Background()
+	if _, err := th.Acquire(ctx, "email", "busy"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := client.Set(ctx, keys.JobKey("job1"), "queued", 0).Err(); err != nil {
+		t.Fatalf("seed status: %v", err)
+	}
+
+	msg := kafka.Message{Key: "job1", Value: []byte(`{}`), Headers: map[string]string{jobmeta.FieldType: "email"}}
+	if err := worker.Handle(ctx, msg); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if processor.calls != 0 {
+		t.Fatalf("expected processor not to run")
+	}
+	score, err := client.ZScore(ctx, keys.RetryJobsKey(), "job1").Result()
+	if err != nil {
+		t.Fatalf("retry zscore: %v", err)
+	}
+	if score < 1_001_000 || score > 1_001_200 {
+		t.Fatalf("score = %v", score)
+	}
+	if status := client.Get(ctx, keys.JobKey("job1")).Val(); status != "queued" {
+		t.Fatalf("status = %q", status)
+	}
+	if client.Exists(ctx, keys.AttemptKey("job1")).Val() != 0 {
+		t.Fatalf("deferral must not count an attempt")
+	}
+	if got := reg.Counter("mq_worker_jobs_deferred_total", "", "type", "reason").With("email", throttle.ReasonConcurrency).Value(); got != 1 {
+		t.Fatalf("deferred count = %v", got)
+	}
+
+	if err := th.Release(ctx, "email", "busy"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := worker.Handle(ctx, msg); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if processor.calls != 1 {
+		t.Fatalf("expected processor to run once slot is free")
+	}
+	if members, _ := mr.ZMembers(keys.ThrottleSlotsKey("email")); len(members) != 0 {
+		t.Fatalf("slot not released: %v", members)
+	}
+}
+
+type recordingProcessor struct {
+	payloads []string
+}
+
+func (p *recordingProcessor) Process(ctx context.Context, jobID string, payload json.RawMessage) error {
+	p.payloads = append(p.payloads, string(payload))
+	return nil
+}
+
+func refMessage(t *testing.T, root, name string, data []byte) kafka.Message {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	value, _ := json.Marshal(payload.RefPayload{Ref: "file://" + path, Size: int64(len(data)), Hash: "sha256:" + hex.EncodeToString(sum[:])})
+	return kafka.Message{Key: name, Value: value, Headers: map[string]string{jobmeta.FieldPayloadRef: "1"}}
+}
+
+func TestHandleResolvesPayloadRef(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	root := t.TempDir()
+	processor := &recordingProcessor{}
+	worker, err := New(&fakeConsumer{}, client, processor, nil, "", WithBlobResolver(blob.NewLocal(root), 0))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	msg := refMessage(t, root, "job1", []byte(`{"big":true}`))
+	if err := worker.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(processor.payloads) != 1 || processor.payloads[0] != `{"big":true}` {
+		t.Fatalf("payloads = %v", processor.payloads)
+	}
+
+	// Without the API-set marker the ref document is an ordinary payload.
+	delete(msg.Headers, jobmeta.FieldPayloadRef)
+	msg.Key = "job2"
+	if err := worker.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(processor.payloads) != 2 || processor.payloads[1] != string(msg.Value) {
+		t.Fatalf("unmarked payload = %v", processor.payloads)
+	}
+}
+
+func TestHandlePayloadRefMismatchGoesToDLQ(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	root := t.TempDir()
+	processor := &recordingProcessor{}
+	dlq := &fakeDLQProducer{}
+	reg := metrics.NewRegistry()
+	worker, err := New(&fakeConsumer{}, client, processor, dlq, "jobs.dlq", WithBlobResolver(blob.NewLocal(root), 0), WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	msg := refMessage(t, root, "job1", []byte(`{"big":true}`))
+	if err := os.WriteFile(filepath.Join(root, "job1"), []byte(`{"big":false}`), 0o600); err != nil {
+		t.Fatalf("overwrite blob: %v", err)
+	}
+	_ = worker.Handle(context.Background(), msg)
+
+	if len(processor.payloads) != 0 {
+		t.Fatalf("processor ran on a mismatched payload")
+	}
+	if status := client.Get(context.Background(), keys.JobKey("job1")).Val(); status != "dlq" {
+		t.Fatalf("status = %q", status)
+	}
+	if len(dlq.msgs) != 1 {
+		t.Fatalf("expected dlq publish without a retry")
+	}
+	if got := reg.Counter("mq_worker_payload_resolve_failures_total", "", "kind").With("permanent").Value(); got != 1 {
+		t.Fatalf("permanent failures = %v", got)
+	}
+}
+
+func TestHandleDecompressesPayload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	processor := &recordingProcessor{}
+	dlq := &fakeDLQProducer{}
+	worker, err := New(&fakeConsumer{}, client, processor, dlq, "jobs.dlq")
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+
+	body := `{"text":"` + strings.Repeat("compress me ", 1024) + `"}`
+	value, codec, err := compress.Config{Codec: compress.Zstd}.Encode([]byte(body))
+	if err != nil || codec != compress.Zstd {
+		t.Fatalf("encode: %q %v", codec, err)
+	}
+	headers := map[string]string{jobmeta.FieldPayloadEncoding: codec}
+	if err := worker.Handle(context.Background(), kafka.Message{Key: "job1", Value: value, Headers: headers}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(processor.payloads) != 1 || processor.payloads[0] != body {
+		t.Fatalf("processor got %d payloads", len(processor.payloads))
+	}
+
+	// A payload that does not decode goes to the DLQ without a retry.
+	_ = worker.Handle(context.Background(), kafka.Message{Key: "job2", Value: []byte("garbage"), Headers: headers})
+	if status := client.Get(context.Background(), keys.JobKey("job2")).Val(); status != "dlq" {
+		t.Fatalf("status = %q", status)
+	}
+	if len(dlq.msgs) != 1 || dlq.msgs[0].Headers[jobmeta.FieldPayloadEncoding] != codec {
+		t.Fatalf("dlq = %+v", dlq.msgs)
+	}
+}
+
+func testKeyring(t *testing.T, id string) *envelope.Keyring {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := cryptorand.Read(key); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	k, err := envelope.ParseKeyring([]byte("active: " + id + "\nkeys:\n  - id: " + id + "\n    key: " + base64.StdEncoding.EncodeToString(key) + "\n"))
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	return k
+}
+
+func TestHandleOpensSealedPayload(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	keyring := testKeyring(t, "k1")
+	processor := &recordingProcessor{}
+	worker, err := New(&fakeConsumer{}, client, processor, &fakeDLQProducer{}, "jobs.dlq", WithKeyring(keyring))
+	if err != nil {
+		t.Fatalf("new worker: %v", err)
+	}
+	ctx := context.Background()
+	headers := map[string]string{jobmeta.FieldPayloadEncryption: envelope.Scheme, jobmeta.FieldPayloadEncoding: compress.Gzip}
+
+	body := `{"ssn":"` + strings.Repeat("1", 256) + `"}`
+	compressed, _, _ := compress.Config{Codec: compress.Gzip, MinBytes: 1}.Encode([]byte(body))
+	sealed, err := keyring.Seal(compressed, []byte("job1"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if err := worker.Handle(ctx, kafka.Message{Key: "job1", Value: sealed, Headers: headers}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(processor.payloads) != 1 || processor.payloads[0] != body {
+		t.Fatalf("processor got %v", processor.payloads)
+	}
+
+	// The envelope is bound to job1, so it does not open as another job.
+	_ = worker.Handle(ctx, kafka.Message{Key: "job2", Value: sealed, Headers: headers})
+	if status := client.Get(ctx, keys.JobKey("job2")).Val(); status != "dlq" {
+		t.Fatalf("moved envelope status = %q", status)
+	}
+
+	// A KEK the worker does not hold yet is retried, not dead-lettered.
+	rotated, _ := testKeyring(t, "k2").Seal(compressed, []byte("job3"))
+	_ = worker.Handle(ctx, kafka.Message{Key: "job3", Value: rotated, Headers: headers})
+	if status := client.Get(ctx, keys.JobKey("job3")).Val(); status != "retrying" {
+		t.Fatalf("unknown key status = %q", status)
+	}
+}